@@ -0,0 +1,123 @@
+// Command safeheron-payload seals a plaintext JSON event into a signed and
+// encrypted webhook or co-signer callback, the way Safeheron does, to test
+// handlers locally.
+//
+//	safeheron-payload -keygen keys
+//	safeheron-payload -kind webhook -mode OAEP_GCM -signer keys/signer_private.pem -recipient keys/recipient_public.pem event.json
+//
+// The event is read from the file given as argument, or from stdin, and the
+// envelope is written to stdout as JSON.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/safeherontest"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, "safeheron-payload:", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	kind := flag.String("kind", "webhook", "envelope to produce: webhook, cosigner or cosigner-v3")
+	mode := flag.String("mode", string(safeherontest.SealOAEPGCM), "encryption of webhook and cosigner envelopes: OAEP_GCM or PKCS1_CBC")
+	signer := flag.String("signer", "", "PEM private key signing the envelope, the Safeheron webhook or co-signer key")
+	recipient := flag.String("recipient", "", "PEM public key encrypting the envelope, the webhook or approval callback service key")
+	timestamp := flag.Int64("timestamp", 0, "envelope timestamp in milliseconds, the current time when 0")
+	keygen := flag.String("keygen", "", "write a signer and a recipient test key pair to this directory and exit")
+	flag.Parse()
+
+	if *keygen != "" {
+		return generateKeys(*keygen)
+	}
+	sealer := safeherontest.Sealer{Mode: safeherontest.SealMode(*mode)}
+	if *timestamp != 0 {
+		sealer.Timestamp = time.UnixMilli(*timestamp)
+	}
+	var err error
+	if sealer.SignerKey.PrivateKeyPem, err = readFlagFile("signer", *signer); err != nil {
+		return err
+	}
+	if *kind != "cosigner-v3" {
+		if sealer.RecipientKey.PublicKeyPem, err = readFlagFile("recipient", *recipient); err != nil {
+			return err
+		}
+	}
+	payLoad, err := readPayLoad(flag.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	var envelope any
+	switch *kind {
+	case "webhook":
+		envelope, err = sealer.WebHook(payLoad)
+	case "cosigner":
+		envelope, err = sealer.CoSignerCallBack(payLoad)
+	case "cosigner-v3":
+		envelope, err = sealer.CoSignerCallBackV3(payLoad)
+	default:
+		return fmt.Errorf("unknown kind %q", *kind)
+	}
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(envelope)
+}
+
+func readFlagFile(name string, path string) ([]byte, error) {
+	if path == "" {
+		return nil, fmt.Errorf("-%s is required", name)
+	}
+	return os.ReadFile(path)
+}
+
+// readPayLoad reads the event from path, or stdin when empty, and checks it is JSON.
+func readPayLoad(path string) ([]byte, error) {
+	var payLoad []byte
+	var err error
+	if path == "" || path == "-" {
+		payLoad, err = io.ReadAll(os.Stdin)
+	} else {
+		payLoad, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !json.Valid(payLoad) {
+		return nil, fmt.Errorf("the event is not valid JSON")
+	}
+	return payLoad, nil
+}
+
+func generateKeys(dir string) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	for _, name := range []string{"signer", "recipient"} {
+		keys, err := safeherontest.GenerateKeyPair()
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, name+"_private.pem"), keys.PrivateKeyPem, 0o600); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, name+"_public.pem"), keys.PublicKeyPem, 0o644); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("wrote the signer and recipient key pairs to %s\n", dir)
+	return nil
+}
@@ -145,27 +145,20 @@ func requestMpcSig(customerRefId string, accountKey string, dataList string) str
 
 func retrieveSig(customerRefId string) string {
 	// As an example, we use the API to get the signature, and you can also use webhooks to get it
-	ticker := time.NewTicker(5 * time.Second)
-	defer ticker.Stop()
-
 	OneMPCSignTransactionsRequest := api.OneMPCSignTransactionsRequest{
 		CustomerRefId: customerRefId,
 	}
 	var MPCSignTransactionsResponse api.MPCSignTransactionsResponse
-	for range ticker.C {
-		if err := mpcSignApi.OneMPCSignTransactions(OneMPCSignTransactionsRequest, &MPCSignTransactionsResponse); err != nil {
-			panic(err)
-		}
-
-		log.Infof(`mpc sign transaction status: %s, sub status: %s`, MPCSignTransactionsResponse.TransactionStatus, MPCSignTransactionsResponse.TransactionSubStatus)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	if err := mpcSignApi.WaitForMPCSign(ctx, OneMPCSignTransactionsRequest, &MPCSignTransactionsResponse, api.WaitOptions{InitialInterval: 5 * time.Second}); err != nil {
+		panic(err)
+	}
 
-		if MPCSignTransactionsResponse.TransactionStatus == "FAILED" || MPCSignTransactionsResponse.TransactionStatus == "REJECTED" {
-			panic(`mpc sign transaction was FAILED or REJECTED`)
-		}
+	log.Infof(`mpc sign transaction status: %s, sub status: %s`, MPCSignTransactionsResponse.TransactionStatus, MPCSignTransactionsResponse.TransactionSubStatus)
 
-		if MPCSignTransactionsResponse.TransactionStatus == "COMPLETED" && MPCSignTransactionsResponse.TransactionSubStatus == "CONFIRMED" {
-			return MPCSignTransactionsResponse.DataList[0].Sig
-		}
+	if MPCSignTransactionsResponse.TransactionStatus == "COMPLETED" && MPCSignTransactionsResponse.TransactionSubStatus == "CONFIRMED" {
+		return MPCSignTransactionsResponse.DataList[0].Sig
 	}
 
 	panic("can't get sig.")
@@ -0,0 +1,89 @@
+package safeherontest_demo
+
+import (
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/api"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/safeherontest"
+)
+
+func TestAmount(t *testing.T) {
+	simulator, err := safeherontest.NewSimulator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer simulator.Close()
+
+	coinApi := api.CoinApi{Client: simulator.Client()}
+	var coins api.CoinResponse
+	if err := coinApi.ListCoin(&coins); err != nil {
+		t.Fatal(err)
+	}
+	var eth api.Coin
+	for _, coin := range coins {
+		if coin.CoinKey == "ETH_GOERLI" {
+			eth = coin
+		}
+	}
+
+	// 0.1 + 0.2 is exact, unlike with float64
+	sum := api.MustParseAmount("0.1").Add(api.MustParseAmount("0.2"))
+	if sum.Cmp(api.MustParseAmount("0.3")) != 0 || sum.String() != "0.3" {
+		t.Fatalf("unexpected sum %s", sum)
+	}
+	wei, err := eth.ToMinimalUnits(api.MustParseAmount("1.000000000000000001"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wei.String() != "1000000000000000001" {
+		t.Fatalf("unexpected wei %s", wei)
+	}
+	if amount := eth.FromMinimalUnits(big.NewInt(1500000000000000000)); amount.Cmp(api.MustParseAmount("1.5")) != 0 {
+		t.Fatalf("unexpected amount %s", amount)
+	}
+	if _, err := api.MustParseAmount("0.1").MinimalUnits(0); err == nil {
+		t.Fatal("expected a precision error")
+	}
+
+	// Split 1 in 3, rounded down to the coin decimals, the remainder stays exact
+	part := api.MustParseAmount("1").Quo(api.NewAmount(3, 0), eth.CoinDecimal, api.RoundDown)
+	remainder := api.MustParseAmount("1").Sub(part.Mul(api.NewAmount(3, 0)))
+	if remainder.String() != "0.000000000000000001" {
+		t.Fatalf("unexpected remainder %s", remainder)
+	}
+
+	var decoded struct {
+		Amount api.Amount `json:"amount"`
+	}
+	if err := json.Unmarshal([]byte(`{"amount":"12.50"}`), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	encoded, _ := json.Marshal(decoded)
+	if string(encoded) != `{"amount":"12.50"}` {
+		t.Fatalf("unexpected json %s", encoded)
+	}
+	if scientific := api.MustParseAmount("1E-8"); scientific.String() != "0.00000001" {
+		t.Fatalf("unexpected amount %s", scientific)
+	}
+	if negative := api.MustParseAmount("-0.05").Round(1, api.RoundHalfUp); negative.String() != "-0.1" {
+		t.Fatalf("unexpected rounding %s", negative)
+	}
+
+	// Exponents are bounded, they neither wrap around nor take forever
+	for _, s := range []string{"1e-2147483648", "1e20000000", "1e1001", "0." + strings.Repeat("0", 1000) + "1", "1e99999999999"} {
+		start := time.Now()
+		if _, err := api.ParseAmount(s); err == nil {
+			t.Errorf("expected %.20s to be out of range", s)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("parsing %.20s took %s", s, elapsed)
+		}
+	}
+	if large := api.MustParseAmount("1e1000"); len(large.String()) != 1001 {
+		t.Fatalf("unexpected amount %.20s", large)
+	}
+}
@@ -0,0 +1,87 @@
+package safeherontest_demo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/api"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/safeherontest"
+)
+
+// countingTransport counts the round trips it forwards.
+type countingTransport struct {
+	next  http.RoundTripper
+	count int32
+}
+
+func (t *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&t.count, 1)
+	return t.next.RoundTrip(r)
+}
+
+func TestClientContext(t *testing.T) {
+	fake, err := safeherontest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	release := make(chan struct{})
+	defer fake.Close()
+	defer close(release)
+	fake.Handle("/v1/transactions/one", func(json.RawMessage) (any, error) {
+		<-release
+		return api.OneTransactionsResponse{}, nil
+	})
+
+	transactionApi := api.TransactionApi{Client: fake.Client()}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	var res api.OneTransactionsResponse
+	err = transactionApi.OneTransactionsCtx(ctx, api.OneTransactionsRequest{TxKey: "tx"}, &res)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline to abort the request, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("the request was not aborted, it took %s", elapsed)
+	}
+}
+
+func TestClientTransport(t *testing.T) {
+	fake, err := safeherontest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fake.Close()
+	fake.HandleResponse("/v1/transactions/one", api.OneTransactionsResponse{TxKey: "tx"})
+
+	// Transport is used with a client owned by the SDK
+	transport := &countingTransport{next: fake.Server.Client().Transport}
+	config := fake.Config()
+	config.HttpClient = nil
+	config.Transport = transport
+	transactionApi := api.TransactionApi{Client: safeheron.Client{Config: config}}
+	var res api.OneTransactionsResponse
+	if err := transactionApi.OneTransactions(api.OneTransactionsRequest{TxKey: "tx"}, &res); err != nil || res.TxKey != "tx" {
+		t.Fatalf("unexpected response %+v %v", res, err)
+	}
+	if atomic.LoadInt32(&transport.count) != 1 {
+		t.Fatalf("expected the transport to be used once, got %d", transport.count)
+	}
+
+	// HttpClient takes precedence over Transport
+	clientTransport := &countingTransport{next: fake.Server.Client().Transport}
+	config.HttpClient = &http.Client{Transport: clientTransport}
+	transactionApi = api.TransactionApi{Client: safeheron.Client{Config: config}}
+	if err := transactionApi.OneTransactions(api.OneTransactionsRequest{TxKey: "tx"}, &res); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&clientTransport.count) != 1 || atomic.LoadInt32(&transport.count) != 1 {
+		t.Fatalf("expected only the HttpClient to be used, got %d and %d", clientTransport.count, transport.count)
+	}
+}
@@ -0,0 +1,160 @@
+package safeherontest_demo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/api"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/safeherontest"
+)
+
+func TestCoinRegistry(t *testing.T) {
+	simulator, err := safeherontest.NewSimulator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer simulator.Close()
+	simulator.AddCoin(safeherontest.Coin{Coin: api.Coin{CoinKey: "USDT_ERC20_GOERLI", Symbol: "USDT", CoinDecimal: 6, FeeCoinKey: "ETH_GOERLI",
+		FeeDecimal: 18, BlockChain: "Ethereum", Network: "Goerli", IsMemo: "0", IsUtxo: "0", BlockchainType: "EVM",
+		TokenIdentifier: "0x509Ee0d083DdF8AC028f2a56731412edD63223B9"}})
+	simulator.AddMaintenance("BTC_TESTNET", time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+
+	registry := api.NewCoinRegistry(api.CoinApi{Client: simulator.Client()}, time.Minute)
+	usdt, err := registry.CoinBySymbol("usdt", "goerli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usdt.CoinKey != "USDT_ERC20_GOERLI" {
+		t.Fatalf("unexpected coin %s", usdt.CoinKey)
+	}
+	byToken, err := registry.CoinsByToken("0x509ee0d083ddf8ac028f2a56731412edd63223b9")
+	if err != nil || len(byToken) != 1 || byToken[0].CoinKey != usdt.CoinKey {
+		t.Fatalf("unexpected coins by token %v, %v", byToken, err)
+	}
+	if isUtxo, _ := registry.IsUtxo("BTC_TESTNET"); !isUtxo {
+		t.Error("expected BTC_TESTNET to be UTXO based")
+	}
+	if isUtxo, _ := registry.IsUtxo("ETH_GOERLI"); isUtxo {
+		t.Error("expected ETH_GOERLI not to be UTXO based")
+	}
+	if underMaintenance, _ := registry.UnderMaintenance("BTC_TESTNET"); !underMaintenance {
+		t.Error("expected BTC_TESTNET to be under maintenance")
+	}
+	if underMaintenance, _ := registry.UnderMaintenance("ETH_GOERLI"); underMaintenance {
+		t.Error("expected ETH_GOERLI not to be under maintenance")
+	}
+	if _, err := registry.Coin("DOGE"); !errors.Is(err, api.ErrCoinNotFound) {
+		t.Fatalf("expected ErrCoinNotFound, got %v", err)
+	}
+
+	// Loaded once and served from the cache afterwards
+	listed := 0
+	for _, request := range simulator.Requests() {
+		if request.Path == "/v1/coin/list" {
+			listed++
+		}
+	}
+	if listed != 1 {
+		t.Fatalf("expected the coin list to be loaded once, loaded %d times", listed)
+	}
+}
+
+func TestCoinRegistryLoading(t *testing.T) {
+	fake, err := safeherontest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fake.Close()
+	var mu sync.Mutex
+	var listErr error
+	var delay time.Duration
+	coins := api.CoinResponse{{CoinKey: "ETH_GOERLI"}}
+	fake.Handle("/v1/coin/list", func(json.RawMessage) (any, error) {
+		mu.Lock()
+		err, d, res := listErr, delay, append(api.CoinResponse(nil), coins...)
+		mu.Unlock()
+		time.Sleep(d)
+		if err != nil {
+			return nil, err
+		}
+		return res, nil
+	})
+	fake.HandleResponse("/v1/coin/maintain/list", api.CoinMaintainResponse{})
+	listed := func() int {
+		n := 0
+		for _, request := range fake.Requests() {
+			if request.Path == "/v1/coin/list" {
+				n++
+			}
+		}
+		return n
+	}
+
+	// A lookup waiting for the first load gives up with its context
+	mu.Lock()
+	delay = time.Second
+	mu.Unlock()
+	registry := api.NewCoinRegistry(api.CoinApi{Client: fake.Client()}, 100*time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := registry.CoinCtx(ctx, "ETH_GOERLI"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the lookup to time out, got %v", err)
+	}
+	if _, err := registry.IsUtxoCtx(ctx, "ETH_GOERLI"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected IsUtxoCtx to time out, got %v", err)
+	}
+	if _, err := registry.RequiresMemoCtx(ctx, "ETH_GOERLI"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected RequiresMemoCtx to time out, got %v", err)
+	}
+
+	// A failed load is not retried by every lookup
+	mu.Lock()
+	delay, listErr = 0, &safeheron.SafeheronError{Code: 1000, Message: "unavailable"}
+	mu.Unlock()
+	registry = api.NewCoinRegistry(api.CoinApi{Client: fake.Client()}, 100*time.Millisecond)
+	before := listed()
+	for i := 0; i < 3; i++ {
+		if _, err := registry.Coin("ETH_GOERLI"); !safeheron.IsRejected(err) {
+			t.Fatalf("expected the load error, got %v", err)
+		}
+	}
+	if listed()-before != 1 {
+		t.Fatalf("expected one load while backing off, got %d", listed()-before)
+	}
+	mu.Lock()
+	listErr = nil
+	mu.Unlock()
+	time.Sleep(time.Second)
+	if _, err := registry.Coin("ETH_GOERLI"); err != nil {
+		t.Fatalf("expected the load to be retried after the backoff, got %v", err)
+	}
+
+	// Stale lists keep being served while they are loaded again in the background
+	mu.Lock()
+	delay = 300 * time.Millisecond
+	coins = append(coins, api.Coin{CoinKey: "BTC_TESTNET"})
+	mu.Unlock()
+	time.Sleep(150 * time.Millisecond)
+	start := time.Now()
+	if _, err := registry.Coin("BTC_TESTNET"); !errors.Is(err, api.ErrCoinNotFound) {
+		t.Fatalf("expected the stale list, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("lookup waited %s for the refresh", elapsed)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := registry.Coin("BTC_TESTNET"); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the list was not refreshed in the background")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,63 @@
+package safeherontest_demo
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/api"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/safeherontest"
+)
+
+func TestIterateWhitelist(t *testing.T) {
+	simulator, err := safeherontest.NewSimulator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer simulator.Close()
+
+	whitelistApi := api.WhitelistApi{Client: simulator.Client()}
+	var whitelistKeys []string
+	for i := 0; i < 7; i++ {
+		var res api.CreateWhitelistResponse
+		err := whitelistApi.CreateWhitelist(api.CreateWhitelistRequest{
+			WhitelistName: fmt.Sprintf("whitelist-%d", i),
+			ChainType:     "EVM",
+			Address:       fmt.Sprintf("0x%040d", i),
+		}, &res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		whitelistKeys = append(whitelistKeys, res.WhitelistKey)
+	}
+
+	// The list is served newest first, NEXT walks towards the oldest whitelist
+	pager := whitelistApi.IterateWhitelist(context.Background(), api.ListWhitelistRequest{Direct: "NEXT", Limit: 3})
+	pager.Prefetch = true
+	whitelists, err := pager.Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(whitelists) != len(whitelistKeys) {
+		t.Fatalf("expected %d whitelists, got %d", len(whitelistKeys), len(whitelists))
+	}
+	for i, whitelist := range whitelists {
+		if whitelist.WhitelistKey != whitelistKeys[len(whitelistKeys)-1-i] {
+			t.Errorf("whitelist %d: expected %s, got %s", i, whitelistKeys[len(whitelistKeys)-1-i], whitelist.WhitelistKey)
+		}
+	}
+
+	// PREV walks back from the oldest whitelist towards the newest one
+	pager = whitelistApi.IterateWhitelist(context.Background(), api.ListWhitelistRequest{Direct: "PREV", Limit: 3, FromId: whitelistKeys[0]})
+	defer pager.Close()
+	count := 0
+	for pager.Next() {
+		count++
+	}
+	if err := pager.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if count != len(whitelistKeys)-1 {
+		t.Fatalf("expected %d whitelists, got %d", len(whitelistKeys)-1, count)
+	}
+}
@@ -0,0 +1,158 @@
+package safeherontest_demo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/api"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/safeherontest"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/utils"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+var server *safeherontest.Server
+var transactionApi api.TransactionApi
+
+func TestCreateTransactionOffline(t *testing.T) {
+	server.Handle("/v3/transactions/create", func(bizContent json.RawMessage) (any, error) {
+		var req api.CreateTransactionsRequest
+		if err := json.Unmarshal(bizContent, &req); err != nil {
+			return nil, err
+		}
+		return api.CreateTransactionV3Response{TxKey: "tx-" + req.CustomerRefId, CustomerRefId: req.CustomerRefId}, nil
+	})
+
+	createTransactionsRequest := api.CreateTransactionsRequest{
+		SourceAccountKey:       "account-key",
+		SourceAccountType:      "VAULT_ACCOUNT",
+		DestinationAccountType: "ONE_TIME_ADDRESS",
+		DestinationAddress:     "0x0000000000000000000000000000000000000001",
+		CoinKey:                "ETH_GOERLI",
+		TxAmount:               "0.001",
+		TxFeeLevel:             "MIDDLE",
+		CustomerRefId:          uuid.New().String(),
+	}
+
+	var createTransactionV3Response api.CreateTransactionV3Response
+	if err := transactionApi.CreateTransactionsV3(createTransactionsRequest, &createTransactionV3Response); err != nil {
+		t.Fatalf("failed to send transaction, %s", err)
+	}
+	if createTransactionV3Response.TxKey != "tx-"+createTransactionsRequest.CustomerRefId {
+		t.Fatalf("unexpected txKey: %s", createTransactionV3Response.TxKey)
+	}
+	log.Infof("transaction has been created, txKey: %s", createTransactionV3Response.TxKey)
+}
+
+func TestApiErrorOffline(t *testing.T) {
+	server.Handle("/v1/transactions/one", func(json.RawMessage) (any, error) {
+		return nil, &safeheron.SafeheronError{Code: 4321, Message: "transaction does not exist"}
+	})
+
+	var oneTransactionsResponse api.OneTransactionsResponse
+	err := transactionApi.OneTransactions(api.OneTransactionsRequest{TxKey: "tx"}, &oneTransactionsResponse)
+	// The error keeps its meaning through wrapping
+	wrapped := fmt.Errorf("refresh payout: %w", err)
+	var apiErr *safeheron.SafeheronError
+	if !errors.As(wrapped, &apiErr) || apiErr.Code != 4321 || apiErr.Message != "transaction does not exist" ||
+		apiErr.Endpoint != "/v1/transactions/one" || apiErr.RequestId == "" {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !errors.Is(wrapped, &safeheron.SafeheronError{Code: 4321}) || errors.Is(wrapped, &safeheron.SafeheronError{Code: 1234}) {
+		t.Fatalf("unexpected errors.Is result for %v", err)
+	}
+	if !safeheron.IsRejected(wrapped) || safeheron.IsRateLimited(wrapped) || safeheron.IsSignatureInvalid(wrapped) {
+		t.Fatalf("unexpected classification of %v", err)
+	}
+}
+
+func TestRateLimitedOffline(t *testing.T) {
+	throttled := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte("Too Many Requests"))
+	}))
+	defer throttled.Close()
+	config := server.Config()
+	config.BaseUrl = throttled.URL
+	throttledApi := api.TransactionApi{Client: safeheron.Client{Config: config}}
+
+	var oneTransactionsResponse api.OneTransactionsResponse
+	err := throttledApi.OneTransactions(api.OneTransactionsRequest{TxKey: "tx"}, &oneTransactionsResponse)
+	wrapped := fmt.Errorf("refresh payout: %w", err)
+	if !safeheron.IsRateLimited(wrapped) || !errors.Is(wrapped, safeheron.ErrRateLimited) || safeheron.IsRejected(wrapped) {
+		t.Fatalf("expected a rate limited error, got %v", err)
+	}
+	var apiErr *safeheron.SafeheronError
+	if !errors.As(wrapped, &apiErr) || apiErr.HttpStatus != http.StatusTooManyRequests {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestErrorCodesOffline(t *testing.T) {
+	server.Handle("/v1/account/one", func(json.RawMessage) (any, error) {
+		return nil, &safeheron.SafeheronError{Code: safeherontest.CodeInsufficientBalance, Message: "insufficient balance"}
+	})
+	server.Handle("/v1/transactions/one", func(json.RawMessage) (any, error) {
+		return nil, &safeheron.SafeheronError{Code: 4290, Message: "too many requests"}
+	})
+	config := server.Config()
+	config.ErrorCodes.RateLimited = []int64{4290}
+	accountApi := api.AccountApi{Client: safeheron.Client{Config: config}}
+	codesApi := api.TransactionApi{Client: safeheron.Client{Config: config}}
+
+	var account api.AccountResponse
+	err := fmt.Errorf("load account: %w", accountApi.OneAccounts(api.OneAccountRequest{AccountKey: "account"}, &account))
+	if !safeheron.IsInsufficientBalance(err) || safeheron.IsDuplicateCustomerRefId(err) || safeheron.IsRateLimited(err) {
+		t.Fatalf("unexpected classification of %v", err)
+	}
+	// The throttling code of the table is retried like HTTP status 429
+	var tx api.OneTransactionsResponse
+	err = codesApi.OneTransactions(api.OneTransactionsRequest{TxKey: "tx"}, &tx)
+	if !safeheron.IsRateLimited(err) || !safeheron.DefaultRetryable(err) || safeheron.IsInsufficientBalance(err) {
+		t.Fatalf("expected a rate limited error, got %v", err)
+	}
+
+	// Without codes the predicates only see a rejection
+	accountApi.Client.Config.ErrorCodes = safeheron.ErrorCodes{}
+	err = accountApi.OneAccounts(api.OneAccountRequest{AccountKey: "account"}, &account)
+	if !safeheron.IsRejected(err) || safeheron.IsInsufficientBalance(err) {
+		t.Fatalf("unexpected classification of %v", err)
+	}
+
+	// A request signed with another key
+	keys, err := safeherontest.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	codesApi.Client.Config.RsaPrivateKeySource = utils.NewRsaKey(utils.PemKeySource(keys.PrivateKeyPem), 0)
+	err = codesApi.OneTransactions(api.OneTransactionsRequest{TxKey: "tx"}, &tx)
+	if !safeheron.IsSignatureInvalid(err) || !safeheron.IsRejected(err) {
+		t.Fatalf("expected an invalid signature, got %v", err)
+	}
+}
+
+func setup() {
+	var err error
+	server, err = safeherontest.NewServer()
+	if err != nil {
+		panic(fmt.Errorf("failed to start fake server, %w", err))
+	}
+	transactionApi = api.TransactionApi{Client: server.Client()}
+}
+
+func teardown() {
+	server.Close()
+}
+
+func TestMain(m *testing.M) {
+	setup()
+	code := m.Run()
+	teardown()
+	os.Exit(code)
+}
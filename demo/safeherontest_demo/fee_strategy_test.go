@@ -0,0 +1,135 @@
+package safeherontest_demo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/api"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/safeherontest"
+	"github.com/google/uuid"
+)
+
+func TestEstimateFee(t *testing.T) {
+	simulator, err := safeherontest.NewSimulator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer simulator.Close()
+	registry := api.NewCoinRegistry(api.CoinApi{Client: simulator.Client()}, time.Minute)
+	transactionApi := api.TransactionApi{Client: simulator.Client(), Coins: registry}
+	eth, err := registry.Coin("ETH_GOERLI")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prices := func(ctx context.Context, feeCoinKey string) (api.Amount, error) {
+		return api.NewAmount(2000, 0), nil
+	}
+	request := api.TransactionsFeeRateRequest{CoinKey: "ETH_GOERLI", DestinationAddress: "0x0000000000000000000000000000000000000001"}
+
+	// middle is 100 Gwei for a 0.0021 ETH fee
+	estimate, err := transactionApi.EstimateFee(context.Background(), request, eth, api.FeeStrategy{MarkupPercent: api.NewAmount(10, 0), FeeCoinPrice: prices})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if estimate.FeeRateDto != (api.FeeRateDto{MaxFee: "110", MaxPriorityFee: "11", GasLimit: "21000"}) || estimate.Capped {
+		t.Fatalf("unexpected fee rate %+v", estimate)
+	}
+	if estimate.Fee.Cmp(api.MustParseAmount("0.00231")) != 0 || estimate.FeeUsd.Cmp(api.MustParseAmount("4.62")) != 0 || estimate.FeeCoinKey != "ETH_GOERLI" {
+		t.Fatalf("unexpected fee %s %s USD", estimate.Fee, estimate.FeeUsd)
+	}
+
+	// middle plus 10% costs 4.62 USD, the cap lowers it to 4 USD
+	estimate, err = transactionApi.EstimateFee(context.Background(), request, eth,
+		api.FeeStrategy{MarkupPercent: api.NewAmount(10, 0), MaxFeeUsd: api.NewAmount(4, 0), FeeCoinPrice: prices})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !estimate.Capped || estimate.FeeRateDto.MaxFee != "95.238" || estimate.FeeUsd.Cmp(api.NewAmount(4, 0)) > 0 {
+		t.Fatalf("expected the fee to be capped at 4 USD, got %+v", estimate)
+	}
+
+	estimate, err = transactionApi.EstimateFee(context.Background(), request, eth, api.FeeStrategy{Level: api.FeeLevelHigh, MaxRates: api.FeeRateDto{MaxFee: "120"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !estimate.Capped || estimate.FeeRateDto.MaxFee != "120" || estimate.FeeRateDto.MaxPriorityFee != "12" {
+		t.Fatalf("expected MaxFee to be capped at 120, got %+v", estimate)
+	}
+	// Each rate is capped in its own unit, MaxTxFeeRate only caps FeeRate
+	estimate, err = transactionApi.EstimateFee(context.Background(), request, eth,
+		api.FeeStrategy{Level: api.FeeLevelHigh, MaxTxFeeRate: api.NewAmount(1, 0), MaxRates: api.FeeRateDto{MaxPriorityFee: "12", GasBudget: "1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !estimate.Capped || estimate.FeeRateDto.MaxFee != "120" || estimate.FeeRateDto.MaxPriorityFee != "12" {
+		t.Fatalf("expected MaxPriorityFee to be capped at 12, got %+v", estimate)
+	}
+
+	// min is 50 Gwei
+	_, err = transactionApi.EstimateFee(context.Background(), request, eth, api.FeeStrategy{MaxRates: api.FeeRateDto{MaxFee: "40"}})
+	if !errors.Is(err, api.ErrFeeBelowMinimum) {
+		t.Fatalf("expected ErrFeeBelowMinimum, got %v", err)
+	}
+
+	// UTXO coins get a fee rate in sat/b, middle is 4
+	btc, err := registry.Coin("BTC_TESTNET")
+	if err != nil {
+		t.Fatal(err)
+	}
+	estimate, err = transactionApi.EstimateFee(context.Background(), api.TransactionsFeeRateRequest{CoinKey: "BTC_TESTNET"}, btc, api.FeeStrategy{MarkupPercent: api.NewAmount(10, 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if estimate.FeeRateDto != (api.FeeRateDto{FeeRate: "4.4"}) || estimate.Fee.Cmp(api.MustParseAmount("0.000011")) != 0 {
+		t.Fatalf("unexpected fee rate %+v", estimate)
+	}
+	capped, err := transactionApi.EstimateFee(context.Background(), api.TransactionsFeeRateRequest{CoinKey: "BTC_TESTNET"}, btc,
+		api.FeeStrategy{MarkupPercent: api.NewAmount(10, 0), MaxTxFeeRate: api.NewAmount(3, 0), MaxRates: api.FeeRateDto{MaxFee: "1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !capped.Capped || capped.FeeRateDto != (api.FeeRateDto{FeeRate: "3"}) {
+		t.Fatalf("expected FeeRate to be capped at 3, got %+v", capped)
+	}
+
+	// A small rate is raised by the markup, not rounded up to the next unit
+	if raised, err := (api.FeeRateDto{FeeRate: "1"}).Raise(api.NewAmount(1, 0)); err != nil || raised.FeeRate != "1.01" {
+		t.Fatalf("expected 1 sat/b plus 1%% to be 1.01, got %+v %v", raised, err)
+	}
+	if raised, err := (api.FeeRateDto{MaxFee: "1", MaxPriorityFee: "0.1", GasLimit: "21000"}).Raise(api.NewAmount(10, 0)); err != nil ||
+		raised != (api.FeeRateDto{MaxFee: "1.1", MaxPriorityFee: "0.11", GasLimit: "21000"}) {
+		t.Fatalf("expected 1 Gwei plus 10%% to be 1.1, got %+v %v", raised, err)
+	}
+	if raised, err := (api.FeeRateDto{GasBudget: "2000000"}).Raise(api.NewAmount(1, 0)); err != nil || raised.GasBudget != "2020000" {
+		t.Fatalf("expected a Sui gas budget to stay in MIST, got %+v %v", raised, err)
+	}
+
+	var account api.CreateAccountResponse
+	if err := (&api.AccountApi{Client: simulator.Client()}).CreateAccount(api.CreateAccountRequest{AccountName: "fees", CoinKeyList: []string{"BTC_TESTNET"}}, &account); err != nil {
+		t.Fatal(err)
+	}
+	if err := simulator.SetBalance(account.AccountKey, "BTC_TESTNET", "1"); err != nil {
+		t.Fatal(err)
+	}
+	create := api.CreateTransactionsRequest{
+		CustomerRefId:          uuid.New().String(),
+		CoinKey:                "BTC_TESTNET",
+		TxAmount:               "0.001",
+		SourceAccountKey:       account.AccountKey,
+		SourceAccountType:      "VAULT_ACCOUNT",
+		DestinationAddress:     "tb1qexampleaddress0",
+		DestinationAccountType: "ONE_TIME_ADDRESS",
+		TxFeeLevel:             "MIDDLE",
+		MaxTxFeeRate:           "10",
+	}
+	estimate.Apply(&create)
+	if create.TxFeeLevel != "" || create.MaxTxFeeRate != "" {
+		t.Fatalf("expected the fee level and its cap to be replaced, got %+v", create)
+	}
+	var res api.CreateTransactionV3Response
+	if err := transactionApi.CreateTransactionsV3(create, &res); err != nil {
+		t.Fatal(err)
+	}
+}
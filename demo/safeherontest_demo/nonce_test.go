@@ -0,0 +1,308 @@
+package safeherontest_demo
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/api"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/nonce"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/safeherontest"
+)
+
+func TestNonceManager(t *testing.T) {
+	simulator, err := safeherontest.NewSimulator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer simulator.Close()
+	accountApi := api.AccountApi{Client: simulator.Client()}
+	transactionApi := api.TransactionApi{Client: simulator.Client(), Coins: api.NewCoinRegistry(api.CoinApi{Client: simulator.Client()}, time.Minute)}
+	var source api.CreateAccountResponse
+	if err := accountApi.CreateAccount(api.CreateAccountRequest{AccountName: "hot", CoinKeyList: []string{"ETH_GOERLI"}}, &source); err != nil {
+		t.Fatal(err)
+	}
+	simulator.SetBalance(source.AccountKey, "ETH_GOERLI", "1")
+	request := func(customerRefId string, amount string) api.CreateTransactionsRequest {
+		return api.CreateTransactionsRequest{CustomerRefId: customerRefId, CoinKey: "ETH_GOERLI", TxFeeLevel: "MIDDLE", TxAmount: amount,
+			SourceAccountKey: source.AccountKey, SourceAccountType: "VAULT_ACCOUNT",
+			DestinationAccountType: "ONE_TIME_ADDRESS", DestinationAddress: "0x0000000000000000000000000000000000000001"}
+	}
+
+	// A transaction sent outside the manager takes nonce 0
+	var res api.CreateTransactionV3Response
+	if err := transactionApi.CreateTransactionsV3(request("outside", "0.01"), &res); err != nil {
+		t.Fatal(err)
+	}
+	simulator.Advance(30 * time.Second)
+
+	// Two managers sharing a FileStore, as two processes would
+	dir := t.TempDir()
+	managers := []*nonce.Manager{
+		{Store: &nonce.FileStore{Dir: dir}, Transactions: &transactionApi},
+		{Store: &nonce.FileStore{Dir: dir}, Transactions: &transactionApi},
+	}
+	var wg sync.WaitGroup
+	txKeys := make([]string, 6)
+	errs := make([]error, 6)
+	for i := range txKeys {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var res api.CreateTransactionV3Response
+			errs[i] = managers[i%2].CreateTransaction(context.Background(), request(fmt.Sprintf("tx-%d", i), "0.01"), &res)
+			txKeys[i] = res.TxKey
+		}(i)
+	}
+	wg.Wait()
+	var nonces []string
+	byNonce := map[string]string{}
+	for i, txKey := range txKeys {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		var tx api.OneTransactionsResponse
+		transactionApi.OneTransactions(api.OneTransactionsRequest{TxKey: txKey}, &tx)
+		nonces = append(nonces, tx.Nonce)
+		byNonce[tx.Nonce] = txKey
+	}
+	sort.Strings(nonces)
+	if fmt.Sprint(nonces) != "[1 2 3 4 5 6]" {
+		t.Fatalf("expected nonces 1 to 6, got %v", nonces)
+	}
+
+	// A rejected request gives its nonce back
+	manager := managers[0]
+	key := nonce.TransactionKey(source.AccountKey, "ETH_GOERLI")
+	if err := manager.CreateTransaction(context.Background(), request("too-much", "100"), &res); err == nil {
+		t.Fatal("expected an insufficient balance")
+	}
+	if state, _ := manager.State(context.Background(), key); state.Next != 7 || len(state.Free) != 0 || len(state.Pending) != 6 {
+		t.Fatalf("unexpected state %+v", state)
+	}
+
+	// Nonce 3 fails before being broadcast and leaves a gap
+	simulator.FailTransaction(byNonce["3"], api.TransactionSubStatusSignFailed)
+	simulator.Advance(30 * time.Second)
+	gaps, err := manager.Sync(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(gaps) != "[3]" {
+		t.Fatalf("expected the gap 3, got %v", gaps)
+	}
+	var stuck api.OneTransactionsResponse
+	transactionApi.OneTransactions(api.OneTransactionsRequest{TxKey: byNonce["4"]}, &stuck)
+	if stuck.TransactionStatus != api.TransactionStatusBroadcasting {
+		t.Fatalf("expected nonce 4 to wait for the gap, got %s", stuck.TransactionStatus)
+	}
+	filled, err := manager.FillGaps(context.Background(), key, func(ctx context.Context, n int64) (string, error) {
+		replacement := request(fmt.Sprintf("gap-%d", n), "0.000001")
+		replacement.Nonce = n
+		var res api.CreateTransactionV3Response
+		err := transactionApi.CreateTransactionsV3Ctx(ctx, replacement, &res)
+		return res.TxKey, err
+	})
+	if err != nil || fmt.Sprint(filled) != "[3]" {
+		t.Fatalf("expected the gap 3 to be filled, got %v %v", filled, err)
+	}
+	var replacement api.OneTransactionsResponse
+	transactionApi.OneTransactions(api.OneTransactionsRequest{CustomerRefId: "gap-3"}, &replacement)
+	if replacement.Nonce != "3" {
+		t.Fatalf("unexpected replacement nonce %s", replacement.Nonce)
+	}
+
+	simulator.Advance(30 * time.Second)
+	if gaps, _ := manager.Sync(context.Background(), key); len(gaps) != 0 {
+		t.Fatalf("unexpected gaps %v", gaps)
+	}
+	if state, _ := manager.State(context.Background(), key); state.Next != 7 || len(state.Pending) != 0 {
+		t.Fatalf("unexpected state %+v", state)
+	}
+	if n, _ := manager.Reserve(context.Background(), key); n != 7 {
+		t.Fatalf("expected nonce 7, got %d", n)
+	}
+}
+
+func TestNonceManagerTimeout(t *testing.T) {
+	simulator, err := safeherontest.NewSimulator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer simulator.Close()
+	accountApi := api.AccountApi{Client: simulator.Client()}
+	var source api.CreateAccountResponse
+	if err := accountApi.CreateAccount(api.CreateAccountRequest{AccountName: "hot", CoinKeyList: []string{"ETH_GOERLI"}}, &source); err != nil {
+		t.Fatal(err)
+	}
+	simulator.SetBalance(source.AccountKey, "ETH_GOERLI", "1")
+
+	// The transaction is created but its response comes after the client gave up
+	target, _ := url.Parse(simulator.URL)
+	forward := httputil.NewSingleHostReverseProxy(target)
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v3/transactions/create" {
+			forward.ServeHTTP(w, r)
+			return
+		}
+		recorder := httptest.NewRecorder()
+		forward.ServeHTTP(recorder, r)
+		time.Sleep(200 * time.Millisecond)
+		w.WriteHeader(recorder.Code)
+		w.Write(recorder.Body.Bytes())
+	}))
+	defer slow.Close()
+	config := simulator.Config()
+	config.BaseUrl = slow.URL
+	config.RequestTimeout = 50
+	transactionApi := api.TransactionApi{Client: safeheron.Client{Config: config}}
+	manager := nonce.Manager{Store: &nonce.MemoryStore{}, Transactions: &transactionApi}
+	key := nonce.TransactionKey(source.AccountKey, "ETH_GOERLI")
+
+	var res api.CreateTransactionV3Response
+	err = manager.CreateTransaction(context.Background(), api.CreateTransactionsRequest{CustomerRefId: "timeout", CoinKey: "ETH_GOERLI",
+		TxFeeLevel: "MIDDLE", TxAmount: "0.01", SourceAccountKey: source.AccountKey, SourceAccountType: "VAULT_ACCOUNT",
+		DestinationAccountType: "ONE_TIME_ADDRESS", DestinationAddress: "0x0000000000000000000000000000000000000001"}, &res)
+	if err == nil || safeheron.IsRejected(err) {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+
+	// The nonce stays reserved until Sync finds the transaction by customerRefId
+	if state, _ := manager.State(context.Background(), key); len(state.Free) != 0 || len(state.Pending) != 1 {
+		t.Fatalf("unexpected state %+v", state)
+	}
+	simulator.Advance(30 * time.Second)
+	gaps, err := manager.Sync(context.Background(), key)
+	if err != nil || len(gaps) != 0 {
+		t.Fatalf("unexpected gaps %v %v", gaps, err)
+	}
+	var created api.OneTransactionsResponse
+	if err := transactionApi.OneTransactions(api.OneTransactionsRequest{CustomerRefId: "timeout"}, &created); err != nil {
+		t.Fatal(err)
+	}
+	if state, _ := manager.State(context.Background(), key); len(state.Free) != 0 || len(state.Pending) != 0 || fmt.Sprint(state.Next-1) != created.Nonce {
+		t.Fatalf("unexpected state %+v, the transaction has nonce %s", state, created.Nonce)
+	}
+}
+
+func TestNonceManagerSyncInFlight(t *testing.T) {
+	simulator, err := safeherontest.NewSimulator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer simulator.Close()
+	accountApi := api.AccountApi{Client: simulator.Client()}
+	transactionApi := api.TransactionApi{Client: simulator.Client()}
+	var source api.CreateAccountResponse
+	if err := accountApi.CreateAccount(api.CreateAccountRequest{AccountName: "hot", CoinKeyList: []string{"ETH_GOERLI"}}, &source); err != nil {
+		t.Fatal(err)
+	}
+	simulator.SetBalance(source.AccountKey, "ETH_GOERLI", "1")
+	manager := nonce.Manager{Store: &nonce.MemoryStore{}, Transactions: &transactionApi}
+	key := nonce.TransactionKey(source.AccountKey, "ETH_GOERLI")
+	if _, err := manager.Sync(context.Background(), key); err != nil {
+		t.Fatal(err)
+	}
+	send := func(customerRefId string) string {
+		var res api.CreateTransactionV3Response
+		if err := transactionApi.CreateTransactionsV3(api.CreateTransactionsRequest{CustomerRefId: customerRefId, CoinKey: "ETH_GOERLI", TxFeeLevel: "MIDDLE",
+			TxAmount: "0.001", SourceAccountKey: source.AccountKey, SourceAccountType: "VAULT_ACCOUNT",
+			DestinationAccountType: "ONE_TIME_ADDRESS", DestinationAddress: "0x0000000000000000000000000000000000000001"}, &res); err != nil {
+			t.Fatal(err)
+		}
+		return res.TxKey
+	}
+
+	// A transaction sent outside the manager is stuck with nonce 0, more than a
+	// page of transactions failing before broadcast follows it
+	if err := simulator.StallTransaction(send("stuck")); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 60; i++ {
+		simulator.FailTransaction(send(fmt.Sprintf("failed-%d", i)), api.TransactionSubStatusSignFailed)
+	}
+	simulator.Advance(30 * time.Second)
+
+	gaps, err := manager.Sync(context.Background(), key)
+	if err != nil || len(gaps) != 0 {
+		t.Fatalf("unexpected gaps %v %v", gaps, err)
+	}
+	if n, err := manager.Reserve(context.Background(), key); err != nil || n != 1 {
+		t.Fatalf("expected nonce 1 past the transaction in flight, got %d %v", n, err)
+	}
+}
+
+func TestFileStoreLock(t *testing.T) {
+	dir := t.TempDir()
+	key := nonce.TransactionKey("account", "ETH")
+	// A lock file left by a process that died does not hold the lock
+	if err := os.WriteFile(filepath.Join(dir, "account_ETH.json.lock"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two stores, as two processes would, contend for the key
+	stores := []*nonce.FileStore{{Dir: dir}, {Dir: dir}}
+	var wg sync.WaitGroup
+	errs := make([]error, 8)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for n := 0; n < 25 && errs[i] == nil; n++ {
+				errs[i] = stores[i%2].Update(context.Background(), key, func(state *nonce.State) error {
+					next := state.Next
+					time.Sleep(time.Millisecond)
+					state.Next = next + 1
+					return nil
+				})
+			}
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var next int64
+	stores[0].Update(context.Background(), key, func(state *nonce.State) error {
+		next = state.Next
+		return nil
+	})
+	if next != 200 {
+		t.Fatalf("expected 200 updates, got %d", next)
+	}
+
+	// A locker waits for the holder until its context is done
+	held := make(chan struct{})
+	release := make(chan struct{})
+	holderDone := make(chan error, 1)
+	go func() {
+		holderDone <- stores[0].Update(context.Background(), key, func(state *nonce.State) error {
+			close(held)
+			<-release
+			return nil
+		})
+	}()
+	<-held
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := stores[1].Update(ctx, key, func(state *nonce.State) error { return nil })
+	close(release)
+	if holderErr := <-holderDone; holderErr != nil {
+		t.Fatal(holderErr)
+	}
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected the lock to be held, got %v", err)
+	}
+}
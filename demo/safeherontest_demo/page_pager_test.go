@@ -0,0 +1,63 @@
+package safeherontest_demo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/api"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/safeherontest"
+)
+
+func TestIterateAccounts(t *testing.T) {
+	simulator, err := safeherontest.NewSimulator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer simulator.Close()
+
+	accountApi := api.AccountApi{Client: simulator.Client()}
+	var accountKeys []string
+	for i := 0; i < 25; i++ {
+		var res api.CreateAccountResponse
+		if err := accountApi.CreateAccount(api.CreateAccountRequest{AccountName: fmt.Sprintf("account-%d", i)}, &res); err != nil {
+			t.Fatal(err)
+		}
+		accountKeys = append(accountKeys, res.AccountKey)
+	}
+
+	pager := accountApi.IterateAccounts(context.Background(), api.ListAccountRequest{PageSize: 10})
+	pager.Concurrency = 3
+	accounts, err := pager.Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != len(accountKeys) {
+		t.Fatalf("expected %d accounts, got %d", len(accountKeys), len(accounts))
+	}
+	for i, account := range accounts {
+		if account.AccountKey != accountKeys[i] {
+			t.Errorf("account %d: expected %s, got %s", i, accountKeys[i], account.AccountKey)
+		}
+	}
+	if pager.Changed() {
+		t.Error("expected no change to be detected")
+	}
+
+	// An account created during the scan changes totalElements of the next page
+	pager = accountApi.IterateAccounts(context.Background(), api.ListAccountRequest{PageSize: 10})
+	pager.FailOnChange = true
+	defer pager.Close()
+	for pager.Next() {
+		if pager.Item().AccountKey == accountKeys[0] {
+			var res api.CreateAccountResponse
+			if err := accountApi.CreateAccount(api.CreateAccountRequest{AccountName: "late"}, &res); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if !errors.Is(pager.Err(), api.ErrListChanged) {
+		t.Fatalf("expected ErrListChanged, got %v", pager.Err())
+	}
+}
@@ -0,0 +1,206 @@
+package safeherontest_demo
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/api"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/payout"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/safeherontest"
+)
+
+func TestPayoutEngine(t *testing.T) {
+	simulator, err := safeherontest.NewSimulator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer simulator.Close()
+	accountApi := api.AccountApi{Client: simulator.Client()}
+	transactionApi := api.TransactionApi{Client: simulator.Client(), Coins: api.NewCoinRegistry(api.CoinApi{Client: simulator.Client()}, time.Minute)}
+	var source api.CreateAccountResponse
+	if err := accountApi.CreateAccount(api.CreateAccountRequest{AccountName: "payouts", CoinKeyList: []string{"ETH_GOERLI"}}, &source); err != nil {
+		t.Fatal(err)
+	}
+	simulator.SetBalance(source.AccountKey, "ETH_GOERLI", "1")
+
+	dir := t.TempDir()
+	payoutFile := filepath.Join(dir, "payouts.csv")
+	os.WriteFile(payoutFile, []byte("id,coinKey,amount,destinationAddress,note\n"+
+		"a,ETH_GOERLI,0.01,0x0000000000000000000000000000000000000001,first\n"+
+		"b,ETH_GOERLI,0.02,0x0000000000000000000000000000000000000002,second\n"+
+		"c,ETH_GOERLI,0.03,0x0000000000000000000000000000000000000003,third\n"), 0o600)
+	payouts, err := payout.ReadFile(payoutFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	countCreated := func() int {
+		created := 0
+		for _, request := range simulator.Requests() {
+			if request.Path == "/v3/transactions/create" {
+				created++
+			}
+		}
+		return created
+	}
+
+	// A crash right after row b was sent, while row c was being journaled
+	journalFile := filepath.Join(dir, "payouts.journal")
+	var res api.CreateTransactionV3Response
+	if err := transactionApi.CreateTransactionsV3(api.CreateTransactionsRequest{CustomerRefId: "batch-1-b", CoinKey: "ETH_GOERLI", TxFeeLevel: "MIDDLE",
+		TxAmount: "0.02", SourceAccountKey: source.AccountKey, SourceAccountType: "VAULT_ACCOUNT",
+		DestinationAccountType: "ONE_TIME_ADDRESS", DestinationAddress: "0x0000000000000000000000000000000000000002"}, &res); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(journalFile, []byte(`{"id":"b","customerRefId":"batch-1-b","state":"SUBMITTING","time":"2024-01-01T00:00:00Z"}`+"\n"+`{"id":"c","custo`), 0o600)
+
+	journal, err := payout.OpenJournal(journalFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := payout.Engine{Transactions: &transactionApi, Journal: journal, BatchId: "batch-1", SourceAccountKey: source.AccountKey, Concurrency: 2, SkipWait: true}
+
+	invalid := append([]payout.Payout{{Id: "d", CoinKey: "ETH_GOERLI", Amount: "-1", DestinationAddress: "0x0000000000000000000000000000000000000004"}}, payouts...)
+	var invalidBatch *payout.InvalidBatchError
+	if _, err := engine.Run(context.Background(), invalid); !errors.As(err, &invalidBatch) || len(invalidBatch.Rows) != 1 || invalidBatch.Rows[0].Id != "d" {
+		t.Fatalf("expected row d to be invalid, got %v", err)
+	}
+	if created := countCreated(); created != 1 {
+		t.Fatalf("an invalid batch was sent")
+	}
+
+	report, err := engine.Run(context.Background(), payouts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created := countCreated(); created != 4 {
+		t.Fatalf("expected 3 create requests, got %d", created-1)
+	}
+	for _, row := range report.Rows {
+		if row.State != payout.StateSubmitted || row.TxKey == "" || row.IdempotentRequest != (row.Id == "b") {
+			t.Fatalf("unexpected row %+v", row)
+		}
+	}
+	if report.Rows[1].TxKey != res.TxKey {
+		t.Fatalf("row b was paid twice")
+	}
+	journal.Close()
+
+	// Resume and wait for the final status
+	simulator.Advance(30 * time.Second)
+	journal, err = payout.OpenJournal(journalFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+	engine.Journal, engine.SkipWait = journal, false
+	report, err = engine.Run(context.Background(), payouts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created := countCreated(); created != 4 {
+		t.Fatalf("resuming sent %d rows again", created-4)
+	}
+	for _, row := range report.Rows {
+		if row.State != payout.StateFinished || row.TransactionStatus != api.TransactionStatusCompleted || row.TxFee != "0.0021" {
+			t.Fatalf("unexpected row %+v", row)
+		}
+	}
+	if fees, _ := report.TotalFees(); fees["ETH_GOERLI"].Cmp(api.MustParseAmount("0.0063")) != 0 {
+		t.Fatalf("unexpected fees %v", fees)
+	}
+	if len(report.Failed()) != 0 {
+		t.Fatalf("unexpected failed rows %+v", report.Failed())
+	}
+	var csv strings.Builder
+	if err := report.WriteCSV(&csv); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(csv.String()), "\n"); len(lines) != 4 || !strings.Contains(lines[2], ",COMPLETED,") {
+		t.Fatalf("unexpected report\n%s", csv.String())
+	}
+	// Resuming refuses rows changed since they were sent, and rows numbered by position
+	changed := append([]payout.Payout(nil), payouts...)
+	changed[0].Amount = "0.5"
+	if _, err := engine.Run(context.Background(), changed); !errors.As(err, &invalidBatch) || len(invalidBatch.Rows) != 1 || invalidBatch.Rows[0].Id != "a" {
+		t.Fatalf("expected row a to be refused, got %v", err)
+	}
+	numbered, err := payout.ReadCSV(strings.NewReader("coinKey,amount,destinationAddress\n" +
+		"ETH_GOERLI,0.01,0x0000000000000000000000000000000000000001\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.Run(context.Background(), numbered); !errors.As(err, &invalidBatch) || invalidBatch.Rows[0].Id != "1" {
+		t.Fatalf("expected the numbered row to be refused, got %v", err)
+	}
+	if created := countCreated(); created != 4 {
+		t.Fatalf("a refused batch was sent")
+	}
+}
+
+func TestPayoutEngineSubmitsBeforeWaiting(t *testing.T) {
+	simulator, err := safeherontest.NewSimulator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer simulator.Close()
+	accountApi := api.AccountApi{Client: simulator.Client()}
+	transactionApi := api.TransactionApi{Client: simulator.Client()}
+	var source api.CreateAccountResponse
+	if err := accountApi.CreateAccount(api.CreateAccountRequest{AccountName: "payouts", CoinKeyList: []string{"ETH_GOERLI"}}, &source); err != nil {
+		t.Fatal(err)
+	}
+	simulator.SetBalance(source.AccountKey, "ETH_GOERLI", "1")
+	journal, err := payout.OpenJournal(filepath.Join(t.TempDir(), "payouts.journal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+	engine := payout.Engine{Transactions: &transactionApi, Journal: journal, BatchId: "batch-2", SourceAccountKey: source.AccountKey,
+		Concurrency: 1, WaitOptions: api.WaitOptions{InitialInterval: 10 * time.Millisecond, MaxInterval: 10 * time.Millisecond}}
+	payouts := []payout.Payout{
+		{Id: "a", CoinKey: "ETH_GOERLI", Amount: "0.01", DestinationAddress: "0x0000000000000000000000000000000000000001"},
+		{Id: "b", CoinKey: "ETH_GOERLI", Amount: "0.02", DestinationAddress: "0x0000000000000000000000000000000000000002"},
+		{Id: "c", CoinKey: "ETH_GOERLI", Amount: "0.03", DestinationAddress: "0x0000000000000000000000000000000000000003"},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	done := make(chan error, 1)
+	var report *payout.Report
+	go func() {
+		var err error
+		report, err = engine.Run(ctx, payouts)
+		done <- err
+	}()
+
+	// A single worker sends every row before it waits for the first one
+	for {
+		created := 0
+		for _, request := range simulator.Requests() {
+			if request.Path == "/v3/transactions/create" {
+				created++
+			}
+		}
+		if created == len(payouts) {
+			break
+		}
+		select {
+		case err := <-done:
+			t.Fatalf("run ended before sending every row, %v", err)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	simulator.Advance(30 * time.Second)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range report.Rows {
+		if row.State != payout.StateFinished || row.TransactionStatus != api.TransactionStatusCompleted {
+			t.Fatalf("unexpected row %+v", row)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package safeherontest_demo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/api"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/safeherontest"
+)
+
+// flakyProxy forwards requests to a fake server after failing the first ones.
+type flakyProxy struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	failures int
+	fail     func(w http.ResponseWriter)
+	attempts int
+}
+
+func newFlakyProxy(target string) *flakyProxy {
+	targetURL, _ := url.Parse(target)
+	proxy := httputil.NewSingleHostReverseProxy(targetURL)
+	p := &flakyProxy{}
+	p.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		p.attempts++
+		fail := p.failures > 0
+		if fail {
+			p.failures--
+		}
+		p.mu.Unlock()
+		if fail {
+			p.fail(w)
+			return
+		}
+		proxy.ServeHTTP(w, r)
+	}))
+	return p
+}
+
+func (p *flakyProxy) reset(failures int, fail func(w http.ResponseWriter)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failures, p.fail, p.attempts = failures, fail, 0
+}
+
+func (p *flakyProxy) Attempts() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.attempts
+}
+
+func TestRetryPolicy(t *testing.T) {
+	fake, err := safeherontest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fake.Close()
+	fake.HandleResponse("/v1/transactions/one", api.OneTransactionsResponse{TxKey: "tx"})
+	fake.Handle("/v3/transactions/create", func(bizContent json.RawMessage) (any, error) {
+		var req api.CreateTransactionsRequest
+		json.Unmarshal(bizContent, &req)
+		return api.CreateTransactionV3Response{TxKey: "tx-" + req.CustomerRefId}, nil
+	})
+	fake.Handle("/v1/account/one", func(json.RawMessage) (any, error) {
+		return nil, &safeheron.SafeheronError{Code: 1000, Message: "account does not exist"}
+	})
+	proxy := newFlakyProxy(fake.URL)
+	defer proxy.Close()
+	config := fake.Config()
+	config.BaseUrl = proxy.URL
+	config.RetryPolicy = &safeheron.RetryPolicy{MaxAttempts: 3, InitialBackoff: 20 * time.Millisecond, Multiplier: 2}
+	client := safeheron.Client{Config: config}
+	transactionApi := api.TransactionApi{Client: client}
+	accountApi := api.AccountApi{Client: client}
+
+	status := func(code int) func(w http.ResponseWriter) {
+		return func(w http.ResponseWriter) {
+			w.WriteHeader(code)
+			fmt.Fprint(w, http.StatusText(code))
+		}
+	}
+	closeConnection := func(w http.ResponseWriter) {
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	}
+	one := func(ctx context.Context) error {
+		var res api.OneTransactionsResponse
+		return transactionApi.OneTransactionsCtx(ctx, api.OneTransactionsRequest{TxKey: "tx"}, &res)
+	}
+	create := func(customerRefId string) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			var res api.CreateTransactionV3Response
+			return transactionApi.CreateTransactionsV3Ctx(ctx, api.CreateTransactionsRequest{CustomerRefId: customerRefId, CoinKey: "ETH_GOERLI",
+				TxAmount: "0.1", SourceAccountKey: "account", SourceAccountType: "VAULT_ACCOUNT",
+				DestinationAccountType: "ONE_TIME_ADDRESS", DestinationAddress: "0x0000000000000000000000000000000000000001"}, &res)
+		}
+	}
+	for _, test := range []struct {
+		name     string
+		failures int
+		fail     func(w http.ResponseWriter)
+		call     func(ctx context.Context) error
+		attempts int
+		ok       bool
+	}{
+		{"5xx on a read", 2, status(http.StatusBadGateway), one, 3, true},
+		{"429 on a read", 1, status(http.StatusTooManyRequests), one, 2, true},
+		{"transport error on a read", 1, closeConnection, one, 2, true},
+		{"too many failures", 5, status(http.StatusServiceUnavailable), one, 3, false},
+		{"5xx on a create with customerRefId", 1, status(http.StatusInternalServerError), create("retry-1"), 2, true},
+		{"5xx on a create without customerRefId", 1, status(http.StatusInternalServerError), create(""), 1, false},
+		{"API rejection", 0, nil, func(ctx context.Context) error {
+			var res api.AccountResponse
+			return accountApi.OneAccountsCtx(ctx, api.OneAccountRequest{AccountKey: "missing"}, &res)
+		}, 1, false},
+	} {
+		proxy.reset(test.failures, test.fail)
+		start := time.Now()
+		err := test.call(context.Background())
+		if (err == nil) != test.ok || proxy.Attempts() != test.attempts {
+			t.Fatalf("%s: expected %d attempts and success %v, got %d attempts and %v", test.name, test.attempts, test.ok, proxy.Attempts(), err)
+		}
+		// Backoff waits 20ms then 40ms
+		if minimum := []time.Duration{0, 0, 20 * time.Millisecond, 60 * time.Millisecond}[test.attempts]; time.Since(start) < minimum {
+			t.Fatalf("%s: expected a backoff of at least %s, took %s", test.name, minimum, time.Since(start))
+		}
+	}
+
+	// Cancelling the context stops the backoff
+	config.RetryPolicy = &safeheron.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Minute}
+	transactionApi.Client = safeheron.Client{Config: config}
+	proxy.reset(5, status(http.StatusServiceUnavailable))
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := one(ctx); err == nil || proxy.Attempts() != 1 || time.Since(start) > 5*time.Second {
+		t.Fatalf("expected the backoff to stop, got %d attempts in %s and %v", proxy.Attempts(), time.Since(start), err)
+	}
+}
+
+func TestDefaultRetryable(t *testing.T) {
+	for _, test := range []struct {
+		err       error
+		retryable bool
+	}{
+		{&safeheron.SafeheronError{HttpStatus: http.StatusInternalServerError}, true},
+		{&safeheron.SafeheronError{HttpStatus: http.StatusBadGateway}, true},
+		{fmt.Errorf("wrapped: %w", &safeheron.SafeheronError{HttpStatus: http.StatusTooManyRequests}), true},
+		{&safeheron.SafeheronError{Code: 1000, Message: "invalid parameter", HttpStatus: http.StatusOK}, false},
+		{&safeheron.SafeheronError{HttpStatus: http.StatusBadRequest}, false},
+		{&safeheron.SafeheronError{Err: context.Canceled}, false},
+		{&safeheron.SafeheronError{Err: context.DeadlineExceeded}, false},
+		{errors.New("not a request error"), false},
+	} {
+		if got := safeheron.DefaultRetryable(test.err); got != test.retryable {
+			t.Fatalf("%v: expected retryable %v, got %v", test.err, test.retryable, got)
+		}
+	}
+}
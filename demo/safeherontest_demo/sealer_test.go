@@ -0,0 +1,65 @@
+package safeherontest_demo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/cosigner"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/safeherontest"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/utils"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/webhook"
+)
+
+func TestSealer(t *testing.T) {
+	signerKeys, err := safeherontest.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipientKeys, err := safeherontest.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	payLoad := `{"eventType":"TRANSACTION_CREATED","eventDetail":{"txKey":"tx-1","transactionStatus":"SUBMITTED"}}`
+	webhookConverter := webhook.WebhookConverter{Config: webhook.WebHookConfig{
+		SafeheronWebHookRsaPublicKeySource: utils.NewRsaKey(utils.PemKeySource(signerKeys.PublicKeyPem), 0),
+		WebHookRsaDecrypter:                utils.NewRsaKey(utils.PemKeySource(recipientKeys.PrivateKeyPem), 0),
+	}}
+	coSignerConverter := cosigner.CoSignerConverter{Config: cosigner.CoSignerConfig{
+		CoSignerPubKeySource:          utils.NewRsaKey(utils.PemKeySource(signerKeys.PublicKeyPem), 0),
+		ApprovalCallbackServiceSigner: utils.NewRsaKey(utils.PemKeySource(recipientKeys.PrivateKeyPem), 0),
+	}}
+
+	for _, mode := range []safeherontest.SealMode{safeherontest.SealOAEPGCM, safeherontest.SealPKCS1CBC} {
+		sealer := safeherontest.Sealer{SignerKey: signerKeys, RecipientKey: recipientKeys, Mode: mode, Timestamp: time.UnixMilli(1700000000000)}
+		d, err := sealer.WebHook([]byte(payLoad))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if content, err := webhookConverter.Convert(d); err != nil || content != payLoad || d.Timestamp != "1700000000000" {
+			t.Fatalf("%s webhook: unexpected content %q %v", mode, content, err)
+		}
+		callBack, err := sealer.CoSignerCallBack([]byte(payLoad))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if content, err := coSignerConverter.RequestConvert(callBack); err != nil || content != payLoad {
+			t.Fatalf("%s co-signer callback: unexpected content %q %v", mode, content, err)
+		}
+		// A tampered envelope is rejected
+		d.Timestamp = "1700000000001"
+		if _, err := webhookConverter.Convert(d); err == nil {
+			t.Fatalf("%s webhook: expected the tampered timestamp to be rejected", mode)
+		}
+	}
+
+	callBackV3, err := safeherontest.Sealer{SignerKey: signerKeys}.CoSignerCallBackV3([]byte(payLoad))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content, err := coSignerConverter.RequestV3Convert(callBackV3); err != nil || content != payLoad {
+		t.Fatalf("v3 co-signer callback: unexpected content %q %v", content, err)
+	}
+	if _, err := (safeherontest.Sealer{SignerKey: signerKeys, RecipientKey: recipientKeys, Mode: "RSA_ECB"}).WebHook([]byte(payLoad)); err == nil {
+		t.Fatal("expected an unknown mode to be rejected")
+	}
+}
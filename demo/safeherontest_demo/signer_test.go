@@ -0,0 +1,87 @@
+package safeherontest_demo
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/cosigner"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/safeherontest"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/utils"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/webhook"
+)
+
+func TestFakeSignerDecrypter(t *testing.T) {
+	fake, err := safeherontest.NewFakeSignerDecrypter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	platformKeys, err := safeherontest.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	payLoad := `{"eventType":"TRANSACTION_CREATED","eventDetail":{"txKey":"tx-1"}}`
+
+	// Webhooks are decrypted with the fake, in both modes
+	webhookConverter := webhook.WebhookConverter{Config: webhook.WebHookConfig{
+		SafeheronWebHookRsaPublicKeySource: utils.NewRsaKey(utils.PemKeySource(platformKeys.PublicKeyPem), 0),
+		WebHookRsaDecrypter:                fake,
+	}}
+	for _, mode := range []safeherontest.SealMode{safeherontest.SealOAEPGCM, safeherontest.SealPKCS1CBC} {
+		d, err := safeherontest.Sealer{SignerKey: platformKeys, RecipientKey: fake.KeyPair, Mode: mode}.WebHook([]byte(payLoad))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if content, err := webhookConverter.Convert(d); err != nil || content != payLoad {
+			t.Fatalf("%s: unexpected content %q %v", mode, content, err)
+		}
+	}
+	if calls := fmt.Sprint(fake.Calls()); calls != "[DecryptOAEP DecryptPKCS1v15]" {
+		t.Fatalf("unexpected calls %s", calls)
+	}
+
+	// Co-signer responses are signed with the fake and verified with its public key
+	coSignerConverter := cosigner.CoSignerConverter{Config: cosigner.CoSignerConfig{
+		CoSignerPubKeySource:          utils.NewRsaKey(utils.PemKeySource(platformKeys.PublicKeyPem), 0),
+		ApprovalCallbackServiceSigner: fake,
+	}}
+	response, err := coSignerConverter.ResponseV3Converter(cosigner.CoSignerResponseV3{Action: "APPROVE", ApprovalId: "approval-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := map[string]string{}
+	for key, value := range response {
+		if key != "sig" {
+			signed[key] = value
+		}
+	}
+	publicKey, _ := utils.NewRsaKey(utils.PemKeySource(fake.KeyPair.PublicKeyPem), 0).PublicKey()
+	if !utils.VerifySignWithRSAPSSKey(serializeParams(signed), response["sig"], publicKey) {
+		t.Fatal("expected the response to be signed with the fake key")
+	}
+	if calls := fake.Calls(); calls[len(calls)-1] != "SignPSS" {
+		t.Fatalf("unexpected calls %v", calls)
+	}
+
+	// A failing HSM fails the conversion
+	fake.FailWith(errors.New("hsm unavailable"))
+	d, _ := safeherontest.Sealer{SignerKey: platformKeys, RecipientKey: fake.KeyPair}.WebHook([]byte(payLoad))
+	if _, err := webhookConverter.Convert(d); err == nil {
+		t.Fatal("expected the decryption to fail")
+	}
+	if _, err := coSignerConverter.ResponseV3Converter(nil); err == nil || !strings.Contains(err.Error(), "hsm unavailable") {
+		t.Fatalf("expected the signature to fail, got %v", err)
+	}
+}
+
+// serializeParams serializes params the way Safeheron signs them.
+func serializeParams(params map[string]string) string {
+	var data []string
+	for key, value := range params {
+		data = append(data, key+"="+value)
+	}
+	sort.Strings(data)
+	return strings.Join(data, "&")
+}
@@ -0,0 +1,102 @@
+package safeherontest_demo
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/api"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/safeherontest"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/webhook"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestSimulatedTransactionLifecycle(t *testing.T) {
+	simulator, err := safeherontest.NewSimulator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer simulator.Close()
+
+	// Receive the webhooks of the simulator like a customer service would
+	var mu sync.Mutex
+	var statuses []api.TransactionStatus
+	webhookConverter := webhook.WebhookConverter{Config: simulator.WebHookConfig()}
+	webhookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var webHook webhook.WebHook
+		json.NewDecoder(r.Body).Decode(&webHook)
+		webHookBizContent, err := webhookConverter.Convert(webHook)
+		if err != nil {
+			t.Errorf("failed to convert webhook, %s", err)
+		}
+		var event struct {
+			EventDetail api.TransactionsResponse `json:"eventDetail"`
+		}
+		json.Unmarshal([]byte(webHookBizContent), &event)
+		mu.Lock()
+		var last api.TransactionStatus
+		if len(statuses) > 0 {
+			last = statuses[len(statuses)-1]
+		}
+		if err := api.ValidateTransition(event.EventDetail.TxKey, last, event.EventDetail.TransactionStatus); err != nil {
+			t.Error(err)
+		}
+		statuses = append(statuses, event.EventDetail.TransactionStatus)
+		mu.Unlock()
+		json.NewEncoder(w).Encode(webhook.WebHookResponse{Code: "200", Message: "SUCCESS"})
+	}))
+	defer webhookServer.Close()
+	simulator.WebhookURL = webhookServer.URL
+
+	accountApi := api.AccountApi{Client: simulator.Client()}
+	transactionApi := api.TransactionApi{Client: simulator.Client()}
+
+	var source, destination api.CreateAccountResponse
+	if err := accountApi.CreateAccount(api.CreateAccountRequest{AccountName: "source", CoinKeyList: []string{"ETH_GOERLI"}}, &source); err != nil {
+		t.Fatal(err)
+	}
+	if err := accountApi.CreateAccount(api.CreateAccountRequest{AccountName: "destination"}, &destination); err != nil {
+		t.Fatal(err)
+	}
+	simulator.SetBalance(source.AccountKey, "ETH_GOERLI", "1")
+
+	var createTransactionV3Response api.CreateTransactionV3Response
+	err = transactionApi.CreateTransactionsV3(api.CreateTransactionsRequest{
+		CustomerRefId:          uuid.New().String(),
+		CoinKey:                "ETH_GOERLI",
+		TxAmount:               "0.5",
+		SourceAccountKey:       source.AccountKey,
+		SourceAccountType:      "VAULT_ACCOUNT",
+		DestinationAccountKey:  destination.AccountKey,
+		DestinationAccountType: "VAULT_ACCOUNT",
+	}, &createTransactionV3Response)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	simulator.Advance(30 * time.Second)
+
+	var oneTransactionsResponse api.OneTransactionsResponse
+	if err := transactionApi.OneTransactions(api.OneTransactionsRequest{TxKey: createTransactionV3Response.TxKey}, &oneTransactionsResponse); err != nil {
+		t.Fatal(err)
+	}
+	if oneTransactionsResponse.TransactionStatus != "COMPLETED" {
+		t.Fatalf("unexpected status %s", oneTransactionsResponse.TransactionStatus)
+	}
+	sourceBalance, _ := simulator.Balance(source.AccountKey, "ETH_GOERLI")
+	destinationBalance, _ := simulator.Balance(destination.AccountKey, "ETH_GOERLI")
+	if sourceBalance != "0.4979" || destinationBalance != "0.5" {
+		t.Fatalf("unexpected balances %s, %s", sourceBalance, destinationBalance)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	log.Infof("webhook statuses: %v", statuses)
+	if len(statuses) != 4 || statuses[3] != api.TransactionStatusCompleted {
+		t.Fatalf("unexpected webhooks %v", statuses)
+	}
+}
@@ -0,0 +1,211 @@
+package safeherontest_demo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/api"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/safeherontest"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/speedup"
+	"github.com/google/uuid"
+)
+
+func TestSpeedUpManager(t *testing.T) {
+	simulator, err := safeherontest.NewSimulator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer simulator.Close()
+	accountApi := api.AccountApi{Client: simulator.Client()}
+	transactionApi := api.TransactionApi{Client: simulator.Client()}
+	var source api.CreateAccountResponse
+	if err := accountApi.CreateAccount(api.CreateAccountRequest{AccountName: "source", CoinKeyList: []string{"ETH_GOERLI"}}, &source); err != nil {
+		t.Fatal(err)
+	}
+	simulator.SetBalance(source.AccountKey, "ETH_GOERLI", "1")
+	sent := api.FeeRateDto{MaxFee: "100", MaxPriorityFee: "10", GasLimit: "21000"}
+	createTransaction := func() string {
+		req := api.CreateTransactionsRequest{
+			CustomerRefId:          uuid.New().String(),
+			CoinKey:                "ETH_GOERLI",
+			TxAmount:               "0.01",
+			SourceAccountKey:       source.AccountKey,
+			SourceAccountType:      "VAULT_ACCOUNT",
+			DestinationAddress:     "0x0000000000000000000000000000000000000001",
+			DestinationAccountType: "ONE_TIME_ADDRESS",
+			FeeRateDto:             sent,
+		}
+		var res api.CreateTransactionV3Response
+		if err := transactionApi.CreateTransactionsV3(req, &res); err != nil {
+			t.Fatal(err)
+		}
+		return res.TxKey
+	}
+
+	var events []speedup.Event
+	manager := speedup.Manager{
+		Transactions: &transactionApi,
+		MaxAge:       2 * time.Minute,
+		Strategy:     api.FeeStrategy{Level: api.FeeLevelMiddle, MaxRates: api.FeeRateDto{MaxFee: "125"}},
+		Now:          simulator.Now,
+		OnEvent:      func(event speedup.Event) { events = append(events, event) },
+	}
+	check := func(advance time.Duration) {
+		simulator.Advance(advance)
+		if err := manager.Check(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	txKey := createTransaction()
+	simulator.StallTransaction(txKey)
+	manager.Watch(txKey, sent)
+	check(20 * time.Second)
+	check(time.Minute)
+	if len(events) != 0 {
+		t.Fatalf("sped up too early, %+v", events)
+	}
+
+	// Middle is 100 Gwei, the speed up pays 10% more than the fee sent
+	check(time.Minute)
+	if len(events) != 1 || events[0].Type != speedup.EventSpeedUp || events[0].ReplacedTxKey != txKey {
+		t.Fatalf("expected a speed up, got %+v", events)
+	}
+	if events[0].FeeRateDto != (api.FeeRateDto{MaxFee: "110", MaxPriorityFee: "11", GasLimit: "21000"}) {
+		t.Fatalf("unexpected fee %+v", events[0].FeeRateDto)
+	}
+	replacement := events[0].TxKey
+	if watching := manager.Watching(); len(watching) != 1 || watching[0] != replacement {
+		t.Fatalf("expected the replacement to be watched, got %v", watching)
+	}
+	if original, _ := simulator.Transaction(txKey); original.TransactionStatus != api.TransactionStatusFailed {
+		t.Fatalf("expected the original transaction to fail, got %s", original.TransactionStatus)
+	}
+
+	check(30 * time.Second)
+	check(0)
+	if len(events) != 2 || events[1].Type != speedup.EventDone || events[1].TxKey != replacement {
+		t.Fatalf("expected the replacement to be done, got %+v", events)
+	}
+	done := events[1].Transaction
+	if done.TransactionStatus != api.TransactionStatusCompleted || done.ReplacedTxKey != txKey || len(done.SpeedUpHistory) != 1 {
+		t.Fatalf("unexpected replacement %+v", done)
+	}
+	for _, key := range []string{txKey, replacement} {
+		if lineage := manager.Lineage(key); len(lineage) != 1 || lineage[0].ReplacedTxKey != txKey || lineage[0].TxKey != replacement {
+			t.Fatalf("unexpected lineage of %s, %+v", key, lineage)
+		}
+	}
+	if balance, _ := simulator.Balance(source.AccountKey, "ETH_GOERLI"); balance != "0.9879" {
+		t.Fatalf("expected one debit, got balance %s", balance)
+	}
+
+	// 10% over 120 Gwei is over the ceiling
+	events = nil
+	txKey = createTransaction()
+	simulator.StallTransaction(txKey)
+	manager.Watch(txKey, api.FeeRateDto{MaxFee: "120", MaxPriorityFee: "10", GasLimit: "21000"})
+	check(20 * time.Second)
+	check(2 * time.Minute)
+	check(2 * time.Minute)
+	if len(events) != 1 || events[0].Type != speedup.EventFeeCeiling || events[0].TxKey != txKey {
+		t.Fatalf("expected one fee ceiling event, got %+v", events)
+	}
+	manager.Unwatch(txKey)
+
+	// Without the fee it was sent with, a transaction is reported, not sped up
+	events = nil
+	txKey = createTransaction()
+	simulator.StallTransaction(txKey)
+	manager.Watch(txKey, api.FeeRateDto{})
+	check(20 * time.Second)
+	check(2 * time.Minute)
+	check(2 * time.Minute)
+	if len(events) != 1 || events[0].Type != speedup.EventUnknownFee || events[0].TxKey != txKey {
+		t.Fatalf("expected one unknown fee event, got %+v", events)
+	}
+	if stalled, _ := simulator.Transaction(txKey); stalled.TransactionStatus != api.TransactionStatusBroadcasting {
+		t.Fatalf("expected the transaction to be left alone, got %s", stalled.TransactionStatus)
+	}
+	manager.Unwatch(txKey)
+
+	// Cancel transactions stuck before they are broadcast
+	events = nil
+	simulator.StageDuration = time.Minute
+	manager.CancelAfter = 30 * time.Second
+	txKey = createTransaction()
+	manager.Watch(txKey, sent)
+	check(0)
+	check(30 * time.Second)
+	if len(events) != 1 || events[0].Type != speedup.EventCancelled || events[0].TxKey != txKey {
+		t.Fatalf("expected a cancellation, got %+v", events)
+	}
+	if cancelled, _ := simulator.Transaction(txKey); cancelled.TransactionStatus != api.TransactionStatusCancelled {
+		t.Fatalf("expected the transaction to be cancelled, got %s", cancelled.TransactionStatus)
+	}
+}
+
+func TestSpeedUpManagerRestart(t *testing.T) {
+	simulator, err := safeherontest.NewSimulator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer simulator.Close()
+	accountApi := api.AccountApi{Client: simulator.Client()}
+	transactionApi := api.TransactionApi{Client: simulator.Client()}
+	var source api.CreateAccountResponse
+	if err := accountApi.CreateAccount(api.CreateAccountRequest{AccountName: "source", CoinKeyList: []string{"ETH_GOERLI"}}, &source); err != nil {
+		t.Fatal(err)
+	}
+	simulator.SetBalance(source.AccountKey, "ETH_GOERLI", "1")
+	sent := api.FeeRateDto{MaxFee: "100", MaxPriorityFee: "10", GasLimit: "21000"}
+	var res api.CreateTransactionV3Response
+	if err := transactionApi.CreateTransactionsV3(api.CreateTransactionsRequest{CustomerRefId: uuid.New().String(), CoinKey: "ETH_GOERLI", TxAmount: "0.01",
+		SourceAccountKey: source.AccountKey, SourceAccountType: "VAULT_ACCOUNT", DestinationAddress: "0x0000000000000000000000000000000000000001",
+		DestinationAccountType: "ONE_TIME_ADDRESS", FeeRateDto: sent}, &res); err != nil {
+		t.Fatal(err)
+	}
+	original := res.TxKey
+	simulator.StallTransaction(original)
+
+	newManager := func(events *[]speedup.Event) *speedup.Manager {
+		return &speedup.Manager{Transactions: &transactionApi, MaxAge: 2 * time.Minute,
+			Strategy: api.FeeStrategy{Level: api.FeeLevelMiddle}, Now: simulator.Now,
+			OnEvent: func(event speedup.Event) { *events = append(*events, event) }}
+	}
+	check := func(manager *speedup.Manager, advance time.Duration) {
+		simulator.Advance(advance)
+		if err := manager.Check(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Sped up twice before the restart
+	var events []speedup.Event
+	manager := newManager(&events)
+	manager.Watch(original, sent)
+	txKeys := []string{original}
+	for len(txKeys) < 3 {
+		check(manager, 20*time.Second)
+		check(manager, 2*time.Minute)
+		if len(events) != len(txKeys) || events[len(events)-1].Type != speedup.EventSpeedUp {
+			t.Fatalf("expected a speed up, got %+v", events)
+		}
+		txKeys = append(txKeys, events[len(events)-1].TxKey)
+		simulator.StallTransaction(txKeys[len(txKeys)-1])
+	}
+
+	// The manager restarted with the last replacement knows its whole lineage
+	var restartedEvents []speedup.Event
+	restarted := newManager(&restartedEvents)
+	restarted.Watch(txKeys[2], events[1].FeeRateDto)
+	check(restarted, 0)
+	for _, key := range txKeys {
+		lineage := restarted.Lineage(key)
+		if len(lineage) != 2 || lineage[0].ReplacedTxKey != original || lineage[0].TxKey != txKeys[1] ||
+			lineage[1].ReplacedTxKey != txKeys[1] || lineage[1].TxKey != txKeys[2] {
+			t.Fatalf("unexpected lineage of %s, %+v", key, lineage)
+		}
+	}
+}
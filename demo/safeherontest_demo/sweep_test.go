@@ -0,0 +1,293 @@
+package safeherontest_demo
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/api"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/safeherontest"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/sweep"
+)
+
+func TestSweeper(t *testing.T) {
+	simulator, err := safeherontest.NewSimulator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer simulator.Close()
+	simulator.AddCoin(safeherontest.Coin{Coin: api.Coin{CoinKey: "USDT_GOERLI", CoinName: "USDT", CoinFullName: "Tether USD Goerli", Symbol: "USDT", CoinDecimal: 6, ShowCoinDecimal: 6,
+		FeeCoinKey: "ETH_GOERLI", FeeUnit: "Gwei", FeeDecimal: 18, CoinType: "ERC20", MinTransferAmount: "0", BlockChain: "Ethereum",
+		Network: "Goerli", IsMemo: "0", IsUtxo: "0", BlockchainType: "EVM"}, Fee: "0.0021"})
+	simulator.SetGasBalance("ETH", "1")
+	accountApi := api.AccountApi{Client: simulator.Client()}
+	transactionApi := api.TransactionApi{Client: simulator.Client(), Coins: api.NewCoinRegistry(api.CoinApi{Client: simulator.Client()}, time.Minute)}
+
+	createAccount := func(name string, autoFuel bool, balances map[string]string) string {
+		var account api.CreateAccountResponse
+		if err := accountApi.CreateAccount(api.CreateAccountRequest{AccountName: name, AutoFuel: &autoFuel}, &account); err != nil {
+			t.Fatal(err)
+		}
+		for coinKey, balance := range balances {
+			if err := simulator.SetBalance(account.AccountKey, coinKey, balance); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return account.AccountKey
+	}
+	treasury := createAccount("treasury", false, nil)
+	withGas := createAccount("deposit-1", false, map[string]string{"USDT_GOERLI": "100", "ETH_GOERLI": "1"})
+	autoFuel := createAccount("deposit-2", true, map[string]string{"USDT_GOERLI": "50"})
+	noGas := createAccount("deposit-3", false, map[string]string{"USDT_GOERLI": "20"})
+	bitcoin := createAccount("deposit-4", false, map[string]string{"BTC_TESTNET": "0.5"})
+	small := createAccount("deposit-5", false, map[string]string{"USDT_GOERLI": "5"})
+
+	sweeper := sweep.Sweeper{
+		Accounts:           &accountApi,
+		Transactions:       &transactionApi,
+		Gas:                &api.GasApi{Client: simulator.Client()},
+		TreasuryAccountKey: treasury,
+		AccountFilter:      api.ListAccountRequest{NamePrefix: "deposit-"},
+		Rules: []sweep.Rule{
+			{CoinKey: "ETH_GOERLI", MinAmount: api.MustParseAmount("0.1"), Reserve: api.MustParseAmount("0.01")},
+			{CoinKey: "USDT_GOERLI", MinAmount: api.MustParseAmount("10")},
+			{CoinKey: "BTC_TESTNET", MinAmount: api.MustParseAmount("0.01")},
+		},
+		SkipWait: true,
+	}
+	report, err := sweeper.Run(context.Background(), "run-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := map[string]sweep.Result{}
+	for _, result := range report.Results {
+		results[result.AccountKey+" "+result.CoinKey] = result
+	}
+	if len(report.Results) != 6 {
+		t.Fatalf("unexpected results %+v", report.Results)
+	}
+	if result := results[withGas+" USDT_GOERLI"]; !result.Sent() || result.Fueled {
+		t.Fatalf("unexpected token sweep %+v", result)
+	}
+	// The ETH sweep leaves the reserve and what the token sweep spends
+	if result := results[withGas+" ETH_GOERLI"]; !result.Sent() || result.Amount.Cmp(api.MustParseAmount("0.9879")) != 0 {
+		t.Fatalf("unexpected ETH sweep %+v", result)
+	}
+	if result := results[autoFuel+" USDT_GOERLI"]; !result.Sent() || !result.Fueled {
+		t.Fatalf("expected the gas station to pay the fee, got %+v", result)
+	}
+	if result := results[noGas+" USDT_GOERLI"]; result.Sent() || !strings.Contains(result.Skipped, "does not cover the fee") {
+		t.Fatalf("expected the sweep without gas to be skipped, got %+v", result)
+	}
+	if result := results[small+" USDT_GOERLI"]; result.Sent() || !strings.Contains(result.Skipped, "below") {
+		t.Fatalf("expected the small balance to be skipped, got %+v", result)
+	}
+	if result := results[bitcoin+" BTC_TESTNET"]; !result.Sent() || result.Amount.Cmp(api.MustParseAmount("0.5")) != 0 {
+		t.Fatalf("unexpected collection %+v", result)
+	}
+
+	// Running the same run again sends nothing
+	again, err := sweeper.Run(context.Background(), "run-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range again.Results {
+		if result.Sent() {
+			t.Fatalf("swept twice %+v", result)
+		}
+	}
+	// A deposit made since is not swept by the same run, its earlier sweep is reported
+	simulator.SetBalance(withGas, "USDT_GOERLI", "30")
+	again, err = sweeper.Run(context.Background(), "run-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range again.Results {
+		if result.AccountKey == withGas && result.CoinKey == "USDT_GOERLI" &&
+			(!result.AlreadySent || result.TxKey != results[withGas+" USDT_GOERLI"].TxKey || result.Amount.Cmp(api.NewAmount(100, 0)) != 0) {
+			t.Fatalf("expected the earlier sweep to be reported, got %+v", result)
+		}
+	}
+	// A run id too long for the customerRefIds fails the sweeps before they are sent
+	long, err := sweeper.Run(context.Background(), strings.Repeat("x", api.MaxCustomerRefIdLength))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range long.Results {
+		if result.AccountKey == withGas && result.CoinKey == "USDT_GOERLI" && (result.Err == nil || !strings.Contains(result.Err.Error(), "longer than")) {
+			t.Fatalf("expected the customerRefId to be too long, got %+v", result)
+		}
+	}
+
+	simulator.Advance(30 * time.Second)
+	if err := sweeper.Refresh(context.Background(), report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Failed()) != 0 {
+		t.Fatalf("unexpected failed sweeps %+v", report.Failed())
+	}
+	collected, _ := report.Collected()
+	if collected["USDT_GOERLI"].Cmp(api.MustParseAmount("150")) != 0 || collected["ETH_GOERLI"].Cmp(api.MustParseAmount("0.9858")) != 0 ||
+		collected["BTC_TESTNET"].Cmp(api.MustParseAmount("0.49999")) != 0 {
+		t.Fatalf("unexpected collected amounts %v", collected)
+	}
+	fees, _ := report.Fees()
+	if fees["ETH_GOERLI"].Cmp(api.MustParseAmount("0.0063")) != 0 || fees["BTC_TESTNET"].Cmp(api.MustParseAmount("0.00001")) != 0 {
+		t.Fatalf("unexpected fees %v", fees)
+	}
+	for coinKey, expected := range map[string]string{"USDT_GOERLI": "150", "ETH_GOERLI": "0.9858", "BTC_TESTNET": "0.49999"} {
+		if balance, _ := simulator.Balance(treasury, coinKey); balance != expected {
+			t.Fatalf("unexpected treasury %s balance %s", coinKey, balance)
+		}
+	}
+	if balance, _ := simulator.Balance(withGas, "ETH_GOERLI"); balance != "0.01" {
+		t.Fatalf("expected the reserve to stay, got %s", balance)
+	}
+	var csv strings.Builder
+	if err := report.WriteCSV(&csv); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(csv.String()), "\n"); len(lines) != 7 {
+		t.Fatalf("unexpected report\n%s", csv.String())
+	}
+
+	// A collection rejected for another reason than its customerRefId fails, even
+	// when a transaction with the customerRefId exists
+	simulator.SetBalance(bitcoin, "BTC_TESTNET", "0.2")
+	var existing api.CreateTransactionV3Response
+	if err := transactionApi.CreateTransactionsV3(api.CreateTransactionsRequest{CustomerRefId: "run-2-" + bitcoin + "-BTC_TESTNET", CoinKey: "BTC_TESTNET",
+		TxFeeLevel: "MIDDLE", TxAmount: "0.01", SourceAccountKey: bitcoin, SourceAccountType: "VAULT_ACCOUNT",
+		DestinationAccountType: "ONE_TIME_ADDRESS", DestinationAddress: "tb1qexampleaddress1"}, &existing); err != nil {
+		t.Fatal(err)
+	}
+	simulator.Handle("/v1/transactions/utxo/collection", func(json.RawMessage) (any, error) {
+		return nil, &safeheron.SafeheronError{Code: safeherontest.CodeInsufficientBalance, Message: "insufficient balance"}
+	})
+	rejected, err := sweeper.Run(context.Background(), "run-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range rejected.Results {
+		if result.AccountKey == bitcoin && (!safeheron.IsInsufficientBalance(result.Err) || result.TxKey != "") {
+			t.Fatalf("expected the collection to fail, got %+v", result)
+		}
+	}
+}
+
+func TestSweeperSubmitsBeforeWaiting(t *testing.T) {
+	simulator, err := safeherontest.NewSimulator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer simulator.Close()
+	accountApi := api.AccountApi{Client: simulator.Client()}
+	transactionApi := api.TransactionApi{Client: simulator.Client(), Coins: api.NewCoinRegistry(api.CoinApi{Client: simulator.Client()}, time.Minute)}
+	var treasury api.CreateAccountResponse
+	if err := accountApi.CreateAccount(api.CreateAccountRequest{AccountName: "treasury"}, &treasury); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"deposit-1", "deposit-2"} {
+		var account api.CreateAccountResponse
+		if err := accountApi.CreateAccount(api.CreateAccountRequest{AccountName: name}, &account); err != nil {
+			t.Fatal(err)
+		}
+		simulator.SetBalance(account.AccountKey, "ETH_GOERLI", "1")
+	}
+	sweeper := sweep.Sweeper{
+		Accounts:           &accountApi,
+		Transactions:       &transactionApi,
+		TreasuryAccountKey: treasury.AccountKey,
+		AccountFilter:      api.ListAccountRequest{NamePrefix: "deposit-"},
+		Rules:              []sweep.Rule{{CoinKey: "ETH_GOERLI", MinAmount: api.MustParseAmount("0.1")}},
+		Concurrency:        1,
+		WaitOptions:        api.WaitOptions{InitialInterval: 10 * time.Millisecond, MaxInterval: 10 * time.Millisecond},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	done := make(chan error, 1)
+	var report *sweep.Report
+	go func() {
+		var err error
+		report, err = sweeper.Run(ctx, "run-1")
+		done <- err
+	}()
+
+	// A single worker sends every sweep before it waits for the first one
+	for {
+		created := 0
+		for _, request := range simulator.Requests() {
+			if request.Path == "/v3/transactions/create" {
+				created++
+			}
+		}
+		if created == 2 {
+			break
+		}
+		select {
+		case err := <-done:
+			t.Fatalf("run ended before sending every sweep, %v", err)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	simulator.Advance(30 * time.Second)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Results) != 2 {
+		t.Fatalf("unexpected results %+v", report.Results)
+	}
+	for _, result := range report.Results {
+		if result.TransactionStatus != api.TransactionStatusCompleted {
+			t.Fatalf("unexpected result %+v", result)
+		}
+	}
+}
+
+func TestSweeperScheduleRunId(t *testing.T) {
+	simulator, err := safeherontest.NewSimulator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer simulator.Close()
+	accountApi := api.AccountApi{Client: simulator.Client()}
+	var treasury api.CreateAccountResponse
+	if err := accountApi.CreateAccount(api.CreateAccountRequest{AccountName: "treasury"}, &treasury); err != nil {
+		t.Fatal(err)
+	}
+	sweeper := sweep.Sweeper{
+		Accounts:           &accountApi,
+		Transactions:       &api.TransactionApi{Client: simulator.Client()},
+		Coins:              api.NewCoinRegistry(api.CoinApi{Client: simulator.Client()}, time.Minute),
+		TreasuryAccountKey: treasury.AccountKey,
+		AccountFilter:      api.ListAccountRequest{NamePrefix: "deposit-"},
+		SkipWait:           true,
+	}
+
+	// A restart within the same slot runs it under the same id
+	slot := func() string {
+		return "sweep-" + time.Now().UTC().Truncate(time.Hour).Format("20060102150405")
+	}
+	for restart := 0; restart < 2; restart++ {
+		before := slot()
+		ctx, cancel := context.WithCancel(context.Background())
+		var runId string
+		err := sweeper.Schedule(ctx, time.Hour, func(report *sweep.Report, err error) {
+			if err != nil {
+				t.Error(err)
+			}
+			runId = report.RunId
+			cancel()
+		})
+		cancel()
+		if err != context.Canceled {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if runId != before && runId != slot() {
+			t.Fatalf("unexpected run id %s, expected %s", runId, before)
+		}
+	}
+}
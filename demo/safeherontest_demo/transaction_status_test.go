@@ -0,0 +1,35 @@
+package safeherontest_demo
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/api"
+)
+
+func TestValidateTransition(t *testing.T) {
+	for _, test := range []struct {
+		from api.TransactionStatus
+		to   api.TransactionStatus
+		ok   bool
+	}{
+		{"", api.TransactionStatusSigning, true},
+		{api.TransactionStatusSubmitted, api.TransactionStatusSigning, true},
+		{api.TransactionStatusSubmitted, api.TransactionStatusCompleted, true},
+		{api.TransactionStatusSigning, api.TransactionStatusSigning, true},
+		{api.TransactionStatusConfirming, api.TransactionStatusFailed, true},
+		{api.TransactionStatusCompleted, api.TransactionStatusSigning, false},
+		{api.TransactionStatusCompleted, api.TransactionStatusFailed, false},
+		{api.TransactionStatusConfirming, api.TransactionStatusBroadcasting, false},
+		{api.TransactionStatusCancelled, api.TransactionStatusSubmitted, false},
+	} {
+		err := api.ValidateTransition("tx", test.from, test.to)
+		if (err == nil) != test.ok {
+			t.Errorf("%s to %s: unexpected error %v", test.from, test.to, err)
+		}
+		var invalid *api.InvalidTransitionError
+		if err != nil && (!errors.As(err, &invalid) || invalid.TxKey != "tx" || invalid.From != test.from || invalid.To != test.to) {
+			t.Errorf("%s to %s: unexpected error %#v", test.from, test.to, err)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package safeherontest_demo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/api"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/payout"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/safeherontest"
+)
+
+func TestUTXOPlanner(t *testing.T) {
+	simulator, err := safeherontest.NewSimulator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer simulator.Close()
+	accountApi := api.AccountApi{Client: simulator.Client()}
+	transactionApi := api.TransactionApi{Client: simulator.Client(), Coins: api.NewCoinRegistry(api.CoinApi{Client: simulator.Client()}, time.Minute)}
+	var source api.CreateAccountResponse
+	if err := accountApi.CreateAccount(api.CreateAccountRequest{AccountName: "payouts", CoinKeyList: []string{"BTC_TESTNET"}}, &source); err != nil {
+		t.Fatal(err)
+	}
+	simulator.SetBalance(source.AccountKey, "BTC_TESTNET", "1")
+
+	var payouts []payout.Payout
+	for i := 1; i <= 6; i++ {
+		payouts = append(payouts, payout.Payout{Id: fmt.Sprint(i), Amount: "0.001", DestinationAddress: fmt.Sprintf("tb1qexampleaddress%d", i)})
+	}
+	payouts = append(payouts, payout.Payout{Id: "7", Amount: "0.002", DestinationAddress: "tb1qexampleaddress1"})
+	planner := payout.UTXOPlanner{Transactions: &transactionApi, BatchId: "utxo-1", CoinKey: "BTC_TESTNET", SourceAccountKey: source.AccountKey, MaxOutputs: 4}
+
+	invalid := append([]payout.Payout{{Id: "8", Amount: "0.000000001", DestinationAddress: "tb1qexampleaddress8"}}, payouts...)
+	var invalidBatch *payout.InvalidBatchError
+	if _, err := planner.Plan(context.Background(), invalid); !errors.As(err, &invalidBatch) || len(invalidBatch.Rows) != 1 || invalidBatch.Rows[0].Id != "8" {
+		t.Fatalf("expected row 8 to be invalid, got %v", err)
+	}
+
+	// 6 addresses, payouts 1 and 7 are merged, in 2 transactions of 3 outputs
+	batch, err := planner.Plan(context.Background(), payouts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batch.Transactions) != 2 || len(batch.Transactions[0].Request.DestinationAddressList) != 3 || len(batch.Transactions[1].Request.DestinationAddressList) != 3 {
+		t.Fatalf("unexpected plan %+v", batch.Transactions)
+	}
+	first := batch.Transactions[0]
+	if first.Request.DestinationAddressList[0].Amount != "0.003" || fmt.Sprint(first.PayoutIds[0]) != "[1 7]" {
+		t.Fatalf("expected payouts 1 and 7 to be merged, got %+v", first)
+	}
+	if first.Request.FeeRateDto.FeeRate != "4" || first.Request.CustomerRefId != "utxo-1-1" {
+		t.Fatalf("unexpected request %+v", first.Request)
+	}
+	if estimated := batch.EstimatedFee(); estimated.Cmp(api.MustParseAmount("0.00002544")) != 0 {
+		t.Fatalf("unexpected estimated fee %s", estimated)
+	}
+
+	if err := planner.Submit(context.Background(), batch); err != nil {
+		t.Fatal(err)
+	}
+	// Planning and submitting again after a crash finds the same transactions
+	again, err := planner.Plan(context.Background(), payouts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := planner.Submit(context.Background(), again); err != nil {
+		t.Fatal(err)
+	}
+	for i := range batch.Transactions {
+		if batch.Transactions[i].TxKey == "" || again.Transactions[i].TxKey != batch.Transactions[i].TxKey {
+			t.Fatalf("transaction %d was sent twice", i)
+		}
+	}
+
+	// Changed payouts are not matched to the transactions sent under the same customerRefIds
+	changed := append([]payout.Payout(nil), payouts...)
+	changed[1].Amount = "0.005"
+	replanned, err := planner.Plan(context.Background(), changed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := planner.Submit(context.Background(), replanned); !errors.Is(err, payout.ErrPlanChanged) {
+		t.Fatalf("expected ErrPlanChanged, got %v", err)
+	}
+
+	// Rejections other than the customerRefId are failures, even when a
+	// transaction with the customerRefId exists
+	simulator.Handle("/v1/transactions/utxo/multidest/create", func(json.RawMessage) (any, error) {
+		return nil, &safeheron.SafeheronError{Code: safeherontest.CodeInsufficientBalance, Message: "insufficient balance"}
+	})
+	rejected, err := planner.Plan(context.Background(), payouts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := planner.Submit(context.Background(), rejected); !safeheron.IsInsufficientBalance(err) || rejected.Transactions[0].TxKey != "" {
+		t.Fatalf("expected an insufficient balance, got %v", err)
+	}
+
+	simulator.Advance(30 * time.Second)
+	if err := planner.Refresh(context.Background(), batch); err != nil {
+		t.Fatal(err)
+	}
+	if !batch.Done() || len(batch.Failed()) != 0 {
+		t.Fatalf("expected the batch to complete, got %+v", batch.Transactions)
+	}
+	if total, _ := batch.TotalFee(); total.Cmp(batch.EstimatedFee()) != 0 {
+		t.Fatalf("unexpected total fee %s", total)
+	}
+	if balance, _ := simulator.Balance(source.AccountKey, "BTC_TESTNET"); balance != "0.99197456" {
+		t.Fatalf("unexpected balance %s", balance)
+	}
+}
+
+func TestUTXOPlannerPlanPath(t *testing.T) {
+	simulator, err := safeherontest.NewSimulator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer simulator.Close()
+	accountApi := api.AccountApi{Client: simulator.Client()}
+	transactionApi := api.TransactionApi{Client: simulator.Client()}
+	var source api.CreateAccountResponse
+	if err := accountApi.CreateAccount(api.CreateAccountRequest{AccountName: "payouts", CoinKeyList: []string{"BTC_TESTNET"}}, &source); err != nil {
+		t.Fatal(err)
+	}
+	simulator.SetBalance(source.AccountKey, "BTC_TESTNET", "1")
+	planPath := filepath.Join(t.TempDir(), "utxo-2.plan")
+	planner := payout.UTXOPlanner{Transactions: &transactionApi, BatchId: "utxo-2", CoinKey: "BTC_TESTNET", SourceAccountKey: source.AccountKey, PlanPath: planPath}
+	payouts := []payout.Payout{
+		{Id: "1", Amount: "0.001", DestinationAddress: "tb1qexampleaddress1"},
+		{Id: "2", Amount: "0.002", DestinationAddress: "tb1qexampleaddress2"},
+	}
+	batch, err := planner.Plan(context.Background(), payouts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := planner.Submit(context.Background(), batch); err != nil {
+		t.Fatal(err)
+	}
+	countCreated := func() int {
+		created := 0
+		for _, request := range simulator.Requests() {
+			if request.Path == "/v1/transactions/utxo/multidest/create" {
+				created++
+			}
+		}
+		return created
+	}
+
+	// The same payouts planned again after a restart match the recorded plan
+	again, err := planner.Plan(context.Background(), payouts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Digest() != batch.Digest() {
+		t.Fatal("planning the same payouts gave another digest")
+	}
+	if err := planner.Submit(context.Background(), again); err != nil || again.Transactions[0].TxKey != batch.Transactions[0].TxKey {
+		t.Fatalf("expected the sent transaction to be adopted, got %v", err)
+	}
+
+	// Changed payouts are refused before anything is sent
+	payouts = append(payouts, payout.Payout{Id: "3", Amount: "0.003", DestinationAddress: "tb1qexampleaddress3"})
+	changed, err := planner.Plan(context.Background(), payouts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := countCreated()
+	if err := planner.Submit(context.Background(), changed); !errors.Is(err, payout.ErrPlanChanged) {
+		t.Fatalf("expected ErrPlanChanged, got %v", err)
+	}
+	if countCreated() != created {
+		t.Fatal("a changed plan was sent")
+	}
+}
@@ -0,0 +1,98 @@
+package safeherontest_demo
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/api"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/safeherontest"
+	"github.com/google/uuid"
+)
+
+func TestValidateCreateTransactions(t *testing.T) {
+	simulator, err := safeherontest.NewSimulator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer simulator.Close()
+	simulator.AddCoin(safeherontest.Coin{Coin: api.Coin{CoinKey: "XLM_TESTNET", Symbol: "XLM", CoinDecimal: 7, FeeCoinKey: "XLM_TESTNET", FeeDecimal: 7,
+		MinTransferAmount: "1", BlockChain: "Stellar", Network: "Testnet", IsMemo: "1", IsUtxo: "0", BlockchainType: "STELLAR"}})
+
+	registry := api.NewCoinRegistry(api.CoinApi{Client: simulator.Client()}, time.Minute)
+	transactionApi := api.TransactionApi{Client: simulator.Client(), Coins: registry, ValidateCreate: true}
+
+	isRbf := true
+	var res api.CreateTransactionV3Response
+	err = transactionApi.CreateTransactionsV3(api.CreateTransactionsRequest{
+		CustomerRefId:          uuid.New().String(),
+		CoinKey:                "XLM_TESTNET",
+		TxAmount:               "0.12345678",
+		SourceAccountKey:       "account-1",
+		SourceAccountType:      "VAULT_ACCOUNT",
+		DestinationAccountKey:  "account-2",
+		DestinationAccountType: "ONE_TIME_ADDRESS",
+		IsRbf:                  &isRbf,
+	}, &res)
+	var validationErr *api.ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+	for _, field := range []string{"txAmount", "destinationAddress", "destinationAccountKey", "memo", "isRbf"} {
+		if _, ok := validationErr.Field(field); !ok {
+			t.Errorf("expected an error on %s, got %s", field, validationErr)
+		}
+	}
+	for _, request := range simulator.Requests() {
+		if request.Path == "/v3/transactions/create" {
+			t.Fatal("an invalid request was sent")
+		}
+	}
+
+	valid := api.CreateTransactionsUTXOMultiDestRequest{
+		CustomerRefId:     uuid.New().String(),
+		CoinKey:           "BTC_TESTNET",
+		SourceAccountKey:  "account-1",
+		SourceAccountType: "VAULT_ACCOUNT",
+		DestinationAddressList: []api.DestinationAddress{
+			{Address: "tb1qexampleaddress0", Amount: "0.001"},
+			{Address: "tb1qexampleaddress1", Amount: "0.0000001"},
+		},
+	}
+	btc, _ := registry.Coin("BTC_TESTNET")
+	if err := valid.Validate(btc); !errors.As(err, &validationErr) || len(validationErr.Errors) != 1 {
+		t.Fatalf("expected the dust amount to be rejected, got %v", err)
+	}
+	valid.DestinationAddressList[1].Amount = "0.00001"
+	if err := valid.Validate(btc); err != nil {
+		t.Fatal(err)
+	}
+
+	// A memo on a coin without memos is left to the API
+	eth, _ := registry.Coin("ETH_GOERLI")
+	withMemo := api.CreateTransactionsRequest{
+		CustomerRefId:          uuid.New().String(),
+		CoinKey:                "ETH_GOERLI",
+		TxAmount:               "0.1",
+		SourceAccountKey:       "account-1",
+		SourceAccountType:      "VAULT_ACCOUNT",
+		DestinationAddress:     "0x0000000000000000000000000000000000000001",
+		DestinationAccountType: "ONE_TIME_ADDRESS",
+		Memo:                   "invoice 42",
+	}
+	if err := withMemo.Validate(eth); err != nil {
+		t.Fatalf("expected the memo to be accepted, got %v", err)
+	}
+
+	// Coins alone does not validate, the invalid request reaches the API
+	transactionApi.ValidateCreate = false
+	transactionApi.CreateTransactionsV3(api.CreateTransactionsRequest{CustomerRefId: uuid.New().String(), CoinKey: "XLM_TESTNET",
+		TxAmount: "0.12345678", SourceAccountKey: "account-1", SourceAccountType: "VAULT_ACCOUNT", DestinationAccountType: "ONE_TIME_ADDRESS"}, &res)
+	sent := false
+	for _, request := range simulator.Requests() {
+		sent = sent || request.Path == "/v3/transactions/create"
+	}
+	if !sent {
+		t.Fatal("expected the request to be sent without ValidateCreate")
+	}
+}
@@ -0,0 +1,191 @@
+package safeherontest_demo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/api"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/safeherontest"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/webhook"
+	"github.com/google/uuid"
+)
+
+func TestWaitForTransaction(t *testing.T) {
+	simulator, err := safeherontest.NewSimulator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer simulator.Close()
+
+	// Forward the txKey of every webhook to the waiters
+	notifier := &api.Notifier{}
+	webhookConverter := webhook.WebhookConverter{Config: simulator.WebHookConfig()}
+	webhookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var webHook webhook.WebHook
+		json.NewDecoder(r.Body).Decode(&webHook)
+		webHookBizContent, err := webhookConverter.Convert(webHook)
+		if err != nil {
+			t.Errorf("failed to convert webhook, %s", err)
+		}
+		var event struct {
+			EventDetail api.TransactionsResponse `json:"eventDetail"`
+		}
+		json.Unmarshal([]byte(webHookBizContent), &event)
+		notifier.Notify(event.EventDetail.TxKey)
+		json.NewEncoder(w).Encode(webhook.WebHookResponse{Code: "200", Message: "SUCCESS"})
+	}))
+	defer webhookServer.Close()
+	simulator.WebhookURL = webhookServer.URL
+
+	accountApi := api.AccountApi{Client: simulator.Client()}
+	transactionApi := api.TransactionApi{Client: simulator.Client()}
+	var source, destination api.CreateAccountResponse
+	if err := accountApi.CreateAccount(api.CreateAccountRequest{AccountName: "source", CoinKeyList: []string{"ETH_GOERLI"}}, &source); err != nil {
+		t.Fatal(err)
+	}
+	if err := accountApi.CreateAccount(api.CreateAccountRequest{AccountName: "destination"}, &destination); err != nil {
+		t.Fatal(err)
+	}
+	simulator.SetBalance(source.AccountKey, "ETH_GOERLI", "1")
+
+	createTransaction := func() string {
+		var res api.CreateTransactionV3Response
+		err := transactionApi.CreateTransactionsV3(api.CreateTransactionsRequest{
+			CustomerRefId:          uuid.New().String(),
+			CoinKey:                "ETH_GOERLI",
+			TxAmount:               "0.1",
+			SourceAccountKey:       source.AccountKey,
+			SourceAccountType:      "VAULT_ACCOUNT",
+			DestinationAccountKey:  destination.AccountKey,
+			DestinationAccountType: "VAULT_ACCOUNT",
+		}, &res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.TxKey
+	}
+	// Polling on the interval alone would not finish before the deadline, the webhooks wake the waiter up
+	opts := api.WaitOptions{InitialInterval: time.Hour, Notifier: notifier}
+
+	txKey := createTransaction()
+	done := make(chan error, 1)
+	var completed api.OneTransactionsResponse
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go func() {
+		done <- transactionApi.WaitForTransaction(ctx, api.OneTransactionsRequest{TxKey: txKey}, &completed, opts)
+	}()
+	simulator.Advance(30 * time.Second)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if completed.TransactionStatus != api.TransactionStatusCompleted {
+		t.Fatalf("expected COMPLETED, got %s", completed.TransactionStatus)
+	}
+
+	// Waiters sharing the notifier are each woken up by their own transaction
+	txKeys := []string{createTransaction(), createTransaction(), createTransaction()}
+	results := make(chan error, len(txKeys))
+	for _, txKey := range txKeys {
+		go func(txKey string) {
+			var res api.OneTransactionsResponse
+			err := transactionApi.WaitForTransaction(ctx, api.OneTransactionsRequest{TxKey: txKey}, &res, opts)
+			if err == nil && res.TxKey != txKey {
+				err = fmt.Errorf("waited for %s, got %s", txKey, res.TxKey)
+			}
+			results <- err
+		}(txKey)
+	}
+	simulator.Advance(30 * time.Second)
+	for range txKeys {
+		if err := <-results; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	txKey = createTransaction()
+	simulator.FailTransaction(txKey, api.TransactionSubStatusFailedOnChain)
+	var failed api.OneTransactionsResponse
+	go func() {
+		done <- transactionApi.WaitForTransaction(ctx, api.OneTransactionsRequest{TxKey: txKey}, &failed, opts)
+	}()
+	simulator.Advance(30 * time.Second)
+	var failedErr *api.TransactionFailedError
+	if err := <-done; !errors.As(err, &failedErr) {
+		t.Fatalf("expected TransactionFailedError, got %v", err)
+	}
+	if failedErr.TxKey != txKey || failedErr.TransactionSubStatus != api.TransactionSubStatusFailedOnChain {
+		t.Fatalf("unexpected failure %+v", failedErr)
+	}
+}
+
+func TestWaitForTransactionPolls(t *testing.T) {
+	fake, err := safeherontest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fake.Close()
+	var mu sync.Mutex
+	var responses []api.OneTransactionsResponse
+	fake.Handle("/v1/transactions/one", func(json.RawMessage) (any, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		res := responses[0]
+		if len(responses) > 1 {
+			responses = responses[1:]
+		}
+		if res.TxKey == "" {
+			return nil, &safeheron.SafeheronError{Code: 1000, Message: "transaction does not exist"}
+		}
+		return res, nil
+	})
+	proxy := newFlakyProxy(fake.URL)
+	defer proxy.Close()
+	config := fake.Config()
+	config.BaseUrl = proxy.URL
+	transactionApi := api.TransactionApi{Client: safeheron.Client{Config: config}}
+	opts := api.WaitOptions{InitialInterval: 10 * time.Millisecond, MaxInterval: 10 * time.Millisecond}
+
+	badGateway := func(w http.ResponseWriter) { w.WriteHeader(http.StatusBadGateway) }
+	confirming := api.OneTransactionsResponse{TxKey: "tx", TransactionStatus: api.TransactionStatusCompleted, TransactionSubStatus: api.TransactionSubStatusConfirming}
+	confirmed := api.OneTransactionsResponse{TxKey: "tx", TransactionStatus: api.TransactionStatusCompleted, TransactionSubStatus: api.TransactionSubStatusConfirmed}
+	for _, test := range []struct {
+		name      string
+		failures  int
+		responses []api.OneTransactionsResponse
+		attempts  int
+		ok        bool
+	}{
+		{"transient errors are retried", 2, []api.OneTransactionsResponse{confirmed}, 3, true},
+		{"COMPLETED waits for CONFIRMED", 0, []api.OneTransactionsResponse{confirming, confirming, confirmed}, 3, true},
+		{"API rejections stop the wait", 0, []api.OneTransactionsResponse{{}}, 1, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			mu.Lock()
+			responses = test.responses
+			mu.Unlock()
+			proxy.reset(test.failures, badGateway)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			var res api.OneTransactionsResponse
+			err := transactionApi.WaitForTransaction(ctx, api.OneTransactionsRequest{TxKey: "tx"}, &res, opts)
+			if (err == nil) != test.ok {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if !test.ok && !safeheron.IsRejected(err) {
+				t.Fatalf("expected the API rejection, got %v", err)
+			}
+			if proxy.Attempts() != test.attempts {
+				t.Fatalf("expected %d polls, got %d", test.attempts, proxy.Attempts())
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package safeherontest_demo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/api"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/safeherontest"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/webhook"
+)
+
+func TestWebhookDedup(t *testing.T) {
+	simulator, err := safeherontest.NewSimulator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer simulator.Close()
+
+	var mu sync.Mutex
+	var calls []api.TransactionStatus
+	var failures []error
+	handler := webhook.NewHandler(simulator.WebHookConfig())
+	handler.Now = simulator.Now
+	handler.Dedup = webhook.NewLRUDedupStore(100)
+	handler.OnTransactionStatusChanged(func(ctx context.Context, tx api.TransactionsResponse) error {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, tx.TransactionStatus)
+		return nil
+	})
+	handler.OnError = func(event webhook.Event, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		failures = append(failures, err)
+	}
+	// Keep the bodies received to replay them
+	var bodies [][]byte
+	webhookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, body)
+		mu.Unlock()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		handler.ServeHTTP(w, r)
+	}))
+	defer webhookServer.Close()
+	simulator.WebhookURL = webhookServer.URL
+
+	accountApi := api.AccountApi{Client: simulator.Client()}
+	transactionApi := api.TransactionApi{Client: simulator.Client()}
+	var source api.CreateAccountResponse
+	if err := accountApi.CreateAccount(api.CreateAccountRequest{AccountName: "source", CoinKeyList: []string{"ETH_GOERLI"}}, &source); err != nil {
+		t.Fatal(err)
+	}
+	simulator.SetBalance(source.AccountKey, "ETH_GOERLI", "1")
+	var res api.CreateTransactionV3Response
+	if err := transactionApi.CreateTransactionsV3(api.CreateTransactionsRequest{CustomerRefId: "dedup-1", CoinKey: "ETH_GOERLI", TxAmount: "0.1",
+		SourceAccountKey: source.AccountKey, SourceAccountType: "VAULT_ACCOUNT",
+		DestinationAccountType: "ONE_TIME_ADDRESS", DestinationAddress: "0x0000000000000000000000000000000000000001"}, &res); err != nil {
+		t.Fatal(err)
+	}
+	simulator.Advance(30 * time.Second)
+	mu.Lock()
+	received := append([][]byte(nil), bodies...)
+	if len(calls) != 3 || len(failures) != 0 {
+		t.Fatalf("unexpected calls %v failures %v", calls, failures)
+	}
+	mu.Unlock()
+
+	post := func(body []byte) int {
+		response, err := http.Post(webhookServer.URL, "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		return response.StatusCode
+	}
+	// Redeliveries are acknowledged without calling the callbacks again
+	var wg sync.WaitGroup
+	for _, body := range received {
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func(body []byte) {
+				defer wg.Done()
+				if status := post(body); status != http.StatusOK {
+					t.Errorf("unexpected status %d", status)
+				}
+			}(body)
+		}
+	}
+	wg.Wait()
+	mu.Lock()
+	if len(calls) != 3 {
+		t.Fatalf("expected no new calls, got %v", calls)
+	}
+	mu.Unlock()
+
+	// A redelivery outside the clock skew is still acknowledged, up to MaxResendAge
+	simulator.Advance(10 * time.Minute)
+	if status := post(received[0]); status != http.StatusOK {
+		t.Fatalf("expected a resent webhook to be acknowledged, got %d", status)
+	}
+	mu.Lock()
+	if len(calls) != 3 || len(failures) != 0 {
+		t.Fatalf("unexpected calls %v failures %v", calls, failures)
+	}
+	mu.Unlock()
+
+	// A replay older than MaxResendAge is rejected
+	simulator.Advance(webhook.DefaultMaxResendAge)
+	if status := post(received[0]); status != http.StatusBadRequest {
+		t.Fatalf("expected a stale webhook to be rejected, got %d", status)
+	}
+	mu.Lock()
+	if len(failures) != 1 || !errors.Is(failures[0], webhook.ErrStaleWebHook) {
+		t.Fatalf("unexpected failures %v", failures)
+	}
+	mu.Unlock()
+}
+
+func TestWebhookDedupStores(t *testing.T) {
+	ctx := context.Background()
+	lru := webhook.NewLRUDedupStore(2)
+	lru.Mark(ctx, "a")
+	lru.Mark(ctx, "b")
+	lru.Seen(ctx, "a")
+	lru.Mark(ctx, "c")
+	for key, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		if seen, _ := lru.Seen(ctx, key); seen != want {
+			t.Fatalf("%s: expected seen %v", key, want)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "webhooks.dedup")
+	store, err := webhook.OpenFileDedupStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Mark(ctx, "TRANSACTION_STATUS_CHANGED|tx-1|COMPLETED|CONFIRMATION_SUCCEEDED"); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+	// A line cut by a crash is dropped
+	file, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	file.WriteString(`"TRANSACTION_STATUS_CHANGED|tx-2`)
+	file.Close()
+	store, err = webhook.OpenFileDedupStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seen, _ := store.Seen(ctx, "TRANSACTION_STATUS_CHANGED|tx-1|COMPLETED|CONFIRMATION_SUCCEEDED"); !seen {
+		t.Fatal("expected the key to survive a reopen")
+	}
+	if err := store.Mark(ctx, "TRANSACTION_STATUS_CHANGED|tx-2|COMPLETED|CONFIRMATION_SUCCEEDED"); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+	if store, err = webhook.OpenFileDedupStore(path); err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if seen, _ := store.Seen(ctx, "TRANSACTION_STATUS_CHANGED|tx-2|COMPLETED|CONFIRMATION_SUCCEEDED"); !seen {
+		t.Fatal("expected the key marked after the cut line")
+	}
+}
+
+func TestWebhookEventKey(t *testing.T) {
+	event := func(txHash string, sentAt time.Time) webhook.Event {
+		detail, _ := json.Marshal(api.TransactionsResponse{TxKey: "tx-1", TransactionStatus: api.TransactionStatusConfirming,
+			TransactionSubStatus: api.TransactionSubStatusConfirming, TxHash: txHash})
+		return webhook.Event{EventType: webhook.EventTransactionStatusChanged, EventDetail: detail, Timestamp: sentAt}
+	}
+	sentAt := time.UnixMilli(1700000000000)
+	confirming := webhook.EventKey(event("0x01", sentAt))
+	// A resend sealed again later is the same event
+	if resent := webhook.EventKey(event("0x01", sentAt.Add(time.Hour))); resent != confirming {
+		t.Fatalf("expected a resend to have the key %s, got %s", confirming, resent)
+	}
+	// The status reached again after a speed-up is a new event
+	if spedUp := webhook.EventKey(event("0x02", sentAt.Add(time.Minute))); spedUp == confirming {
+		t.Fatalf("expected the status repeated with a new txHash to have a new key, got %s", spedUp)
+	}
+}
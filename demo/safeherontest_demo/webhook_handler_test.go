@@ -0,0 +1,108 @@
+package safeherontest_demo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/api"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/safeherontest"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/webhook"
+)
+
+func TestWebhookHandler(t *testing.T) {
+	simulator, err := safeherontest.NewSimulator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer simulator.Close()
+
+	var mu sync.Mutex
+	var created []string
+	var statuses []api.TransactionStatus
+	var failures []error
+	handler := webhook.NewHandler(simulator.WebHookConfig())
+	handler.OnTransactionCreated(func(ctx context.Context, tx api.TransactionsResponse) error {
+		mu.Lock()
+		defer mu.Unlock()
+		created = append(created, tx.TxKey)
+		return nil
+	})
+	handler.OnTransactionStatusChanged(func(ctx context.Context, tx api.TransactionsResponse) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if tx.TransactionStatus == api.TransactionStatusCompleted {
+			return errors.New("ledger unavailable")
+		}
+		statuses = append(statuses, tx.TransactionStatus)
+		return nil
+	})
+	handler.OnError = func(event webhook.Event, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		failures = append(failures, err)
+	}
+	webhookServer := httptest.NewServer(handler)
+	defer webhookServer.Close()
+	simulator.WebhookURL = webhookServer.URL
+
+	accountApi := api.AccountApi{Client: simulator.Client()}
+	transactionApi := api.TransactionApi{Client: simulator.Client()}
+	var source api.CreateAccountResponse
+	if err := accountApi.CreateAccount(api.CreateAccountRequest{AccountName: "source", CoinKeyList: []string{"ETH_GOERLI"}}, &source); err != nil {
+		t.Fatal(err)
+	}
+	simulator.SetBalance(source.AccountKey, "ETH_GOERLI", "1")
+	var res api.CreateTransactionV3Response
+	if err := transactionApi.CreateTransactionsV3(api.CreateTransactionsRequest{CustomerRefId: "webhook-1", CoinKey: "ETH_GOERLI", TxAmount: "0.1",
+		SourceAccountKey: source.AccountKey, SourceAccountType: "VAULT_ACCOUNT",
+		DestinationAccountType: "ONE_TIME_ADDRESS", DestinationAddress: "0x0000000000000000000000000000000000000001"}, &res); err != nil {
+		t.Fatal(err)
+	}
+	simulator.Advance(30 * time.Second)
+
+	mu.Lock()
+	if len(created) != 1 || created[0] != res.TxKey {
+		t.Fatalf("unexpected created events %v", created)
+	}
+	if len(statuses) != 2 || statuses[0] != api.TransactionStatusSigning || statuses[1] != api.TransactionStatusBroadcasting {
+		t.Fatalf("unexpected status events %v", statuses)
+	}
+	if len(failures) != 1 || !strings.Contains(failures[0].Error(), "ledger unavailable") {
+		t.Fatalf("unexpected failures %v", failures)
+	}
+	mu.Unlock()
+	// The failed callback is answered with an error for Safeheron to send it again
+	deliveries := simulator.Deliveries()
+	if last := deliveries[len(deliveries)-1]; last.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("unexpected delivery %+v", last)
+	}
+
+	for _, test := range []struct {
+		method string
+		body   string
+		status int
+	}{
+		{http.MethodGet, "", http.StatusMethodNotAllowed},
+		{http.MethodPost, "not json", http.StatusBadRequest},
+		{http.MethodPost, `{"timestamp":"1","sig":"forged","key":"","bizContent":""}`, http.StatusBadRequest},
+	} {
+		request, _ := http.NewRequest(test.method, webhookServer.URL, strings.NewReader(test.body))
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var webHookResponse webhook.WebHookResponse
+		json.NewDecoder(response.Body).Decode(&webHookResponse)
+		response.Body.Close()
+		if response.StatusCode != test.status || webHookResponse.Code == "200" || webHookResponse.Message == "" {
+			t.Fatalf("%s %q: unexpected response %d %+v", test.method, test.body, response.StatusCode, webHookResponse)
+		}
+	}
+}
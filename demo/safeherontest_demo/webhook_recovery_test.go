@@ -0,0 +1,172 @@
+package safeherontest_demo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/api"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/safeherontest"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/webhook"
+)
+
+func TestWebhookRecovery(t *testing.T) {
+	simulator, err := safeherontest.NewSimulator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer simulator.Close()
+	accountApi := api.AccountApi{Client: simulator.Client()}
+	transactionApi := api.TransactionApi{Client: simulator.Client()}
+	checkpointPath := filepath.Join(t.TempDir(), "webhook.checkpoint")
+	recovery := &webhook.Recovery{Webhooks: &api.WebhookApi{Client: simulator.Client()}, Transactions: &transactionApi,
+		CheckpointPath: checkpointPath, Now: simulator.Now}
+
+	var mu sync.Mutex
+	completed := map[string]int{}
+	handler := webhook.NewHandler(simulator.WebHookConfig())
+	handler.Now = simulator.Now
+	handler.Dedup = webhook.NewLRUDedupStore(1000)
+	handler.OnAcknowledged = recovery.Observe
+	handler.OnTransactionStatusChanged(func(ctx context.Context, tx api.TransactionsResponse) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if tx.TransactionStatus == api.TransactionStatusCompleted {
+			completed[tx.TxKey]++
+		}
+		return nil
+	})
+	// The endpoint answers 503 while it is down
+	var down int32
+	webhookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&down) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer webhookServer.Close()
+	simulator.WebhookURL = webhookServer.URL
+
+	var source api.CreateAccountResponse
+	if err := accountApi.CreateAccount(api.CreateAccountRequest{AccountName: "source", CoinKeyList: []string{"ETH_GOERLI"}}, &source); err != nil {
+		t.Fatal(err)
+	}
+	simulator.SetBalance(source.AccountKey, "ETH_GOERLI", "1")
+	seq := 0
+	send := func() string {
+		seq++
+		var res api.CreateTransactionV3Response
+		if err := transactionApi.CreateTransactionsV3(api.CreateTransactionsRequest{CustomerRefId: fmt.Sprintf("recovery-%d", seq), CoinKey: "ETH_GOERLI", TxAmount: "0.01",
+			SourceAccountKey: source.AccountKey, SourceAccountType: "VAULT_ACCOUNT",
+			DestinationAccountType: "ONE_TIME_ADDRESS", DestinationAddress: "0x0000000000000000000000000000000000000001"}, &res); err != nil {
+			t.Fatal(err)
+		}
+		return res.TxKey
+	}
+	check := func() *webhook.RecoveryReport {
+		report, err := recovery.Check(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return report
+	}
+
+	// The first check only sets the checkpoint
+	if report := check(); report.Checked != 0 {
+		t.Fatalf("unexpected first report %+v", report)
+	}
+	simulator.Advance(time.Minute)
+	first := send()
+	simulator.Advance(30 * time.Second)
+	simulator.Advance(2 * time.Minute)
+	if report := check(); report.Checked != 1 || len(report.Missing) != 0 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	// The webhooks of transactions sent while the endpoint is down are resent one by one
+	atomic.StoreInt32(&down, 1)
+	missed := []string{send(), send()}
+	simulator.Advance(30 * time.Second)
+	atomic.StoreInt32(&down, 0)
+	simulator.Advance(2 * time.Minute)
+	report := check()
+	if len(report.Missing) != 2 || report.ResendFailed || report.MessagesCount != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if report := check(); len(report.Missing) != 0 {
+		t.Fatalf("expected the webhooks to be recovered, got %+v", report)
+	}
+
+	// Too many missing transactions resend the failed webhooks of the window,
+	// with their original timestamp after an outage longer than the clock skew
+	recovery.MaxResends = 1
+	atomic.StoreInt32(&down, 1)
+	missed = append(missed, send(), send())
+	simulator.Advance(30 * time.Second)
+	simulator.Advance(2 * webhook.DefaultMaxClockSkew)
+	atomic.StoreInt32(&down, 0)
+	simulator.Advance(2 * time.Minute)
+	report = check()
+	// Every transaction failed its TRANSACTION_CREATED and three TRANSACTION_STATUS_CHANGED
+	if len(report.Missing) != 2 || !report.ResendFailed || report.MessagesCount != 8 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	var resendFailed api.ResendFailedRequest
+	for _, request := range simulator.Requests() {
+		if request.Path == "/v1/webhook/resend/failed" {
+			if err := json.Unmarshal(request.BizContent, &resendFailed); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if resendFailed.StartTime != report.Start.UnixMilli() || resendFailed.EndTime != report.End.UnixMilli() {
+		t.Fatalf("expected the failed webhooks of the window to be resent, got %+v", resendFailed)
+	}
+	if report := check(); len(report.Missing) != 0 {
+		t.Fatalf("expected the webhooks to be recovered, got %+v", report)
+	}
+
+	mu.Lock()
+	for _, txKey := range append(missed, first) {
+		if completed[txKey] != 1 {
+			t.Fatalf("expected %s to complete once, got %d", txKey, completed[txKey])
+		}
+	}
+	mu.Unlock()
+
+	// A transaction stuck in progress before the window and one received in it
+	stuck := send()
+	if err := simulator.StallTransaction(stuck); err != nil {
+		t.Fatal(err)
+	}
+	simulator.Advance(time.Minute)
+	received := send()
+	simulator.Advance(30 * time.Second)
+	simulator.Advance(2 * time.Minute)
+	if report := check(); len(report.Missing) != 0 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	// The checkpoint and the statuses received survive a restart
+	checkpoint, _ := recovery.Checkpoint()
+	restarted := &webhook.Recovery{Webhooks: &api.WebhookApi{Client: simulator.Client()}, Transactions: &transactionApi,
+		CheckpointPath: checkpointPath, Lookback: 2 * time.Minute, Now: simulator.Now}
+	if got, err := restarted.Checkpoint(); err != nil || !got.Equal(checkpoint) {
+		t.Fatalf("expected checkpoint %s, got %s %v", checkpoint, got, err)
+	}
+	report, err = restarted.Check(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Checked != 2 || len(report.Missing) != 0 || report.MessagesCount != 0 {
+		t.Fatalf("expected %s and %s to be known after the restart, got %+v", stuck, received, report)
+	}
+}
@@ -1,6 +1,8 @@
 package api
 
 import (
+	"context"
+
 	"github.com/Safeheron/safeheron-api-sdk-go/safeheron"
 )
 
@@ -44,7 +46,11 @@ type ListAccountResponse struct {
 }
 
 func (e *AccountApi) ListAccounts(d ListAccountRequest, r *ListAccountResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/account/list")
+	return e.ListAccountsCtx(context.Background(), d, r)
+}
+
+func (e *AccountApi) ListAccountsCtx(ctx context.Context, d ListAccountRequest, r *ListAccountResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/account/list")
 }
 
 type OneAccountRequest struct {
@@ -53,7 +59,11 @@ type OneAccountRequest struct {
 }
 
 func (e *AccountApi) OneAccounts(d OneAccountRequest, r *AccountResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/account/one")
+	return e.OneAccountsCtx(context.Background(), d, r)
+}
+
+func (e *AccountApi) OneAccountsCtx(ctx context.Context, d OneAccountRequest, r *AccountResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/account/one")
 }
 
 type OneAccountByAddressRequest struct {
@@ -61,7 +71,11 @@ type OneAccountByAddressRequest struct {
 }
 
 func (e *AccountApi) GetAccountByAddress(d OneAccountByAddressRequest, r *AccountResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/account/getByAddress")
+	return e.GetAccountByAddressCtx(context.Background(), d, r)
+}
+
+func (e *AccountApi) GetAccountByAddressCtx(ctx context.Context, d OneAccountByAddressRequest, r *AccountResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/account/getByAddress")
 }
 
 type CreateAccountRequest struct {
@@ -92,7 +106,11 @@ type CreateAccountResponse struct {
 }
 
 func (e *AccountApi) CreateAccount(d CreateAccountRequest, r *CreateAccountResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/account/create")
+	return e.CreateAccountCtx(context.Background(), d, r)
+}
+
+func (e *AccountApi) CreateAccountCtx(ctx context.Context, d CreateAccountRequest, r *CreateAccountResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/account/create")
 }
 
 type BatchCreateAccountRequest struct {
@@ -108,11 +126,19 @@ type BatchCreateAccountResponse struct {
 }
 
 func (e *AccountApi) BatchCreateAccount(d BatchCreateAccountRequest, r *BatchCreateAccountResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/account/batch/create")
+	return e.BatchCreateAccountCtx(context.Background(), d, r)
+}
+
+func (e *AccountApi) BatchCreateAccountCtx(ctx context.Context, d BatchCreateAccountRequest, r *BatchCreateAccountResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/account/batch/create")
 }
 
 func (e *AccountApi) BatchCreateAccountV2(d BatchCreateAccountRequest, r *[]CreateAccountResponse) error {
-	return e.Client.SendRequest(d, r, "/v2/account/batch/create")
+	return e.BatchCreateAccountV2Ctx(context.Background(), d, r)
+}
+
+func (e *AccountApi) BatchCreateAccountV2Ctx(ctx context.Context, d BatchCreateAccountRequest, r *[]CreateAccountResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v2/account/batch/create")
 }
 
 type UpdateAccountShowStateRequest struct {
@@ -125,7 +151,11 @@ type ResultResponse struct {
 }
 
 func (e *AccountApi) UpdateAccountShowState(d UpdateAccountShowStateRequest, r *ResultResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/account/update/show/state")
+	return e.UpdateAccountShowStateCtx(context.Background(), d, r)
+}
+
+func (e *AccountApi) UpdateAccountShowStateCtx(ctx context.Context, d UpdateAccountShowStateRequest, r *ResultResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/account/update/show/state")
 }
 
 type BatchUpdateAccountTagRequest struct {
@@ -134,7 +164,11 @@ type BatchUpdateAccountTagRequest struct {
 }
 
 func (e *AccountApi) BatchUpdateAccountTag(d BatchUpdateAccountTagRequest, r *ResultResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/account/batch/update/tag")
+	return e.BatchUpdateAccountTagCtx(context.Background(), d, r)
+}
+
+func (e *AccountApi) BatchUpdateAccountTagCtx(ctx context.Context, d BatchUpdateAccountTagRequest, r *ResultResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/account/batch/update/tag")
 }
 
 type BatchUpdateAccountFuelRequest struct {
@@ -143,7 +177,11 @@ type BatchUpdateAccountFuelRequest struct {
 }
 
 func (e *AccountApi) BatchUpdateAccountAutofuel(d BatchUpdateAccountFuelRequest, r *ResultResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/account/batch/update/autofuel")
+	return e.BatchUpdateAccountAutofuelCtx(context.Background(), d, r)
+}
+
+func (e *AccountApi) BatchUpdateAccountAutofuelCtx(ctx context.Context, d BatchUpdateAccountFuelRequest, r *ResultResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/account/batch/update/autofuel")
 }
 
 type AddCoinRequest struct {
@@ -158,7 +196,11 @@ type AddCoinResponse []struct {
 }
 
 func (e *AccountApi) AddCoin(d AddCoinRequest, r *AddCoinResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/account/coin/create")
+	return e.AddCoinCtx(context.Background(), d, r)
+}
+
+func (e *AccountApi) AddCoinCtx(ctx context.Context, d AddCoinRequest, r *AddCoinResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/account/coin/create")
 }
 
 type AddCoinV2Request struct {
@@ -181,7 +223,11 @@ type AddCoinV2Response struct {
 }
 
 func (e *AccountApi) AddCoinV2(d AddCoinV2Request, r *AddCoinV2Response) error {
-	return e.Client.SendRequest(d, r, "/v2/account/coin/create")
+	return e.AddCoinV2Ctx(context.Background(), d, r)
+}
+
+func (e *AccountApi) AddCoinV2Ctx(ctx context.Context, d AddCoinV2Request, r *AddCoinV2Response) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v2/account/coin/create")
 }
 
 type BatchCreateAccountCoinRequest struct {
@@ -202,14 +248,20 @@ type BatchCreateAccountCoinResponse []struct {
 }
 
 func (e *AccountApi) BatchCreateAccountCoin(d BatchCreateAccountCoinRequest, r *BatchCreateAccountCoinResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/account/batch/coin/create")
+	return e.BatchCreateAccountCoinCtx(context.Background(), d, r)
+}
+
+func (e *AccountApi) BatchCreateAccountCoinCtx(ctx context.Context, d BatchCreateAccountCoinRequest, r *BatchCreateAccountCoinResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/account/batch/coin/create")
 }
 
 type ListAccountCoinRequest struct {
 	AccountKey string `json:"accountKey"`
 }
 
-type AccountCoinResponse []struct {
+type AccountCoinResponse []AccountCoin
+
+type AccountCoin struct {
 	CoinKey           string `json:"coinKey"`
 	CoinFullName      string `json:"coinFullName"`
 	CoinName          string `json:"coinName"`
@@ -234,7 +286,11 @@ type AccountCoinResponse []struct {
 }
 
 func (e *AccountApi) ListAccountCoin(d ListAccountCoinRequest, r *AccountCoinResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/account/coin/list")
+	return e.ListAccountCoinCtx(context.Background(), d, r)
+}
+
+func (e *AccountApi) ListAccountCoinCtx(ctx context.Context, d ListAccountCoinRequest, r *AccountCoinResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/account/coin/list")
 }
 
 type ListAccountCoinAddressRequest struct {
@@ -246,24 +302,30 @@ type ListAccountCoinAddressRequest struct {
 }
 
 type AccountCoinAddressResponse struct {
-	PageNumber    int32 `json:"pageNumber"`
-	PageSize      int32 `json:"pageSize"`
-	TotalElements int64 `json:"totalElements"`
-	Content       []struct {
-		AddressGroupKey  string `json:"addressGroupKey"`
-		AddressGroupName string `json:"addressGroupName"`
-		CustomerRefId    string `json:"customerRefId"`
-		AddressList      []struct {
-			Address        string `json:"address"`
-			AddressType    string `json:"addressType"`
-			DerivePath     string `json:"derivePath"`
-			AddressBalance string `json:"addressBalance"`
-		} `json:"addressList"`
-	} `json:"content"`
+	PageNumber    int32                     `json:"pageNumber"`
+	PageSize      int32                     `json:"pageSize"`
+	TotalElements int64                     `json:"totalElements"`
+	Content       []AccountCoinAddressGroup `json:"content"`
+}
+
+type AccountCoinAddressGroup struct {
+	AddressGroupKey  string `json:"addressGroupKey"`
+	AddressGroupName string `json:"addressGroupName"`
+	CustomerRefId    string `json:"customerRefId"`
+	AddressList      []struct {
+		Address        string `json:"address"`
+		AddressType    string `json:"addressType"`
+		DerivePath     string `json:"derivePath"`
+		AddressBalance string `json:"addressBalance"`
+	} `json:"addressList"`
 }
 
 func (e *AccountApi) ListAccountCoinAddress(d ListAccountCoinAddressRequest, r *AccountCoinAddressResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/account/coin/address/list")
+	return e.ListAccountCoinAddressCtx(context.Background(), d, r)
+}
+
+func (e *AccountApi) ListAccountCoinAddressCtx(ctx context.Context, d ListAccountCoinAddressRequest, r *AccountCoinAddressResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/account/coin/address/list")
 }
 
 type InfoAccountCoinAddressRequest struct {
@@ -280,7 +342,11 @@ type InfoAccountCoinAddressResponse struct {
 }
 
 func (e *AccountApi) InfoAccountCoinAddress(d InfoAccountCoinAddressRequest, r *InfoAccountCoinAddressResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/account/coin/address/info")
+	return e.InfoAccountCoinAddressCtx(context.Background(), d, r)
+}
+
+func (e *AccountApi) InfoAccountCoinAddressCtx(ctx context.Context, d InfoAccountCoinAddressRequest, r *InfoAccountCoinAddressResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/account/coin/address/info")
 }
 
 type AccountCoinBalanceRequest struct {
@@ -295,7 +361,11 @@ type AccountCoinBalanceResponse struct {
 }
 
 func (e *AccountApi) AccountCoinBalance(d AccountCoinBalanceRequest, r *AccountCoinBalanceResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/account/coin/balance")
+	return e.AccountCoinBalanceCtx(context.Background(), d, r)
+}
+
+func (e *AccountApi) AccountCoinBalanceCtx(ctx context.Context, d AccountCoinBalanceRequest, r *AccountCoinBalanceResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/account/coin/balance")
 }
 
 type RenameAccountCoinAddressRequest struct {
@@ -304,7 +374,11 @@ type RenameAccountCoinAddressRequest struct {
 }
 
 func (e *AccountApi) RenameAccountCoinAddress(d RenameAccountCoinAddressRequest, r *ResultResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/account/coin/address/name")
+	return e.RenameAccountCoinAddressCtx(context.Background(), d, r)
+}
+
+func (e *AccountApi) RenameAccountCoinAddressCtx(ctx context.Context, d RenameAccountCoinAddressRequest, r *ResultResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/account/coin/address/name")
 }
 
 type CreateAccountCoinAddressRequest struct {
@@ -321,7 +395,11 @@ type CreateAccountCoinAddressResponse struct {
 }
 
 func (e *AccountApi) CreateAccountCoinAddress(d CreateAccountCoinAddressRequest, r *CreateAccountCoinAddressResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/account/coin/address/create")
+	return e.CreateAccountCoinAddressCtx(context.Background(), d, r)
+}
+
+func (e *AccountApi) CreateAccountCoinAddressCtx(ctx context.Context, d CreateAccountCoinAddressRequest, r *CreateAccountCoinAddressResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/account/coin/address/create")
 }
 
 type CreateAccountCoinAddressV2Response struct {
@@ -336,7 +414,11 @@ type CreateAccountCoinAddressV2Response struct {
 }
 
 func (e *AccountApi) CreateAccountCoinAddressV2(d CreateAccountCoinAddressRequest, r *CreateAccountCoinAddressV2Response) error {
-	return e.Client.SendRequest(d, r, "/v2/account/coin/address/create")
+	return e.CreateAccountCoinAddressV2Ctx(context.Background(), d, r)
+}
+
+func (e *AccountApi) CreateAccountCoinAddressV2Ctx(ctx context.Context, d CreateAccountCoinAddressRequest, r *CreateAccountCoinAddressV2Response) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v2/account/coin/address/create")
 }
 
 type BatchCreateAccountCoinUTXORequest struct {
@@ -358,5 +440,9 @@ type BatchCreateAccountCoinUTXOResponse []struct {
 }
 
 func (e *AccountApi) BatchCreateAccountCoinUTXO(d BatchCreateAccountCoinUTXORequest, r *BatchCreateAccountCoinUTXOResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/account/coin/utxo/batch/create")
+	return e.BatchCreateAccountCoinUTXOCtx(context.Background(), d, r)
+}
+
+func (e *AccountApi) BatchCreateAccountCoinUTXOCtx(ctx context.Context, d BatchCreateAccountCoinUTXORequest, r *BatchCreateAccountCoinUTXOResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/account/coin/utxo/batch/create")
 }
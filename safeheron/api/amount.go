@@ -0,0 +1,347 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// ErrAmountPrecision is returned when an amount has more fraction digits than
+// the coin supports, converting it to minimal units would lose precision.
+var ErrAmountPrecision = errors.New("amount has more fraction digits than supported")
+
+// maxAmountScale bounds the number of fraction digits, and of trailing zeros,
+// ParseAmount accepts. Larger exponents would take unbounded memory and time.
+const maxAmountScale = 1000
+
+// RoundingMode selects how Round and Quo drop fraction digits.
+type RoundingMode int
+
+const (
+	// RoundDown drops the extra digits, rounding towards zero.
+	RoundDown RoundingMode = iota
+	// RoundUp rounds away from zero when any dropped digit is not zero.
+	RoundUp
+	// RoundHalfUp rounds to the nearest value, halves away from zero.
+	RoundHalfUp
+)
+
+// Amount is an exact decimal number such as an amount, a balance or a fee rate.
+// It marshals to and from the JSON strings used by the Safeheron API without
+// losing precision or the number of fraction digits. The zero value is 0.
+type Amount struct {
+	// unscaled * 10^-scale is the value, nil is 0
+	unscaled *big.Int
+	scale    int32
+}
+
+// ParseAmount parses a decimal string such as "12", "-0.001" or "1E-8". The
+// scale, the number of fraction digits minus the exponent, must be within ±1000.
+func ParseAmount(s string) (Amount, error) {
+	str := strings.TrimSpace(s)
+	mantissa, exponent := str, int64(0)
+	if i := strings.IndexAny(str, "eE"); i >= 0 {
+		var err error
+		if exponent, err = strconv.ParseInt(str[i+1:], 10, 32); err != nil {
+			return Amount{}, fmt.Errorf("invalid amount %q", s)
+		}
+		mantissa = str[:i]
+	}
+	integer, fraction := mantissa, ""
+	if i := strings.IndexByte(mantissa, '.'); i >= 0 {
+		integer, fraction = mantissa[:i], mantissa[i+1:]
+	}
+	digits := strings.TrimLeft(integer, "+-")
+	if len(integer)-len(digits) > 1 || digits+fraction == "" || strings.ContainsAny(digits+fraction, "+-") {
+		return Amount{}, fmt.Errorf("invalid amount %q", s)
+	}
+	unscaled, ok := new(big.Int).SetString(integer+fraction, 10)
+	if !ok {
+		return Amount{}, fmt.Errorf("invalid amount %q", s)
+	}
+	scale := int64(len(fraction)) - exponent
+	if scale > maxAmountScale || scale < -maxAmountScale {
+		return Amount{}, fmt.Errorf("amount %q out of range, its scale must be within ±%d", s, maxAmountScale)
+	}
+	if scale < 0 {
+		unscaled.Mul(unscaled, pow10(int32(-scale)))
+		scale = 0
+	}
+	return Amount{unscaled: unscaled, scale: int32(scale)}, nil
+}
+
+// MustParseAmount is like ParseAmount but panics on invalid input, for constants.
+func MustParseAmount(s string) Amount {
+	a, err := ParseAmount(s)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// NewAmount returns unscaled * 10^-scale.
+func NewAmount(unscaled int64, scale int32) Amount {
+	if scale < 0 {
+		return Amount{unscaled: new(big.Int).Mul(big.NewInt(unscaled), pow10(-scale))}
+	}
+	return Amount{unscaled: big.NewInt(unscaled), scale: scale}
+}
+
+// AmountFromMinimalUnits converts an integer amount of minimal units, wei or
+// satoshi for example, to an Amount for a coin with the given decimals.
+func AmountFromMinimalUnits(units *big.Int, decimals int32) Amount {
+	return Amount{unscaled: new(big.Int).Set(units), scale: decimals}
+}
+
+// MinimalUnits converts the amount to an integer amount of minimal units of a
+// coin with the given decimals. It fails with ErrAmountPrecision when the
+// amount has more fraction digits than decimals.
+func (a Amount) MinimalUnits(decimals int32) (*big.Int, error) {
+	rounded := a.Round(decimals, RoundDown)
+	if rounded.Cmp(a) != 0 {
+		return nil, fmt.Errorf("%w: %s with %d decimals", ErrAmountPrecision, a, decimals)
+	}
+	return rounded.int(), nil
+}
+
+func (a Amount) int() *big.Int {
+	if a.unscaled == nil {
+		return new(big.Int)
+	}
+	return new(big.Int).Set(a.unscaled)
+}
+
+// Scale returns the number of fraction digits.
+func (a Amount) Scale() int32 {
+	return a.scale
+}
+
+// rescale returns the unscaled value of a at a larger scale.
+func (a Amount) rescale(scale int32) *big.Int {
+	return new(big.Int).Mul(a.int(), pow10(scale-a.scale))
+}
+
+// Add returns a + b.
+func (a Amount) Add(b Amount) Amount {
+	scale := maxScale(a, b)
+	return Amount{unscaled: new(big.Int).Add(a.rescale(scale), b.rescale(scale)), scale: scale}
+}
+
+// Sub returns a - b.
+func (a Amount) Sub(b Amount) Amount {
+	scale := maxScale(a, b)
+	return Amount{unscaled: new(big.Int).Sub(a.rescale(scale), b.rescale(scale)), scale: scale}
+}
+
+// Mul returns a * b, exactly.
+func (a Amount) Mul(b Amount) Amount {
+	return Amount{unscaled: new(big.Int).Mul(a.int(), b.int()), scale: a.scale + b.scale}
+}
+
+// Quo returns a / b with scale fraction digits, rounded with mode. It panics if b is zero.
+func (a Amount) Quo(b Amount, scale int32, mode RoundingMode) Amount {
+	num, den := a.int(), b.int()
+	if e := scale + b.scale - a.scale; e >= 0 {
+		num.Mul(num, pow10(e))
+	} else {
+		den.Mul(den, pow10(-e))
+	}
+	return Amount{unscaled: roundQuo(num, den, mode), scale: scale}
+}
+
+// Round returns a with scale fraction digits, rounded with mode when digits are dropped.
+func (a Amount) Round(scale int32, mode RoundingMode) Amount {
+	if scale >= a.scale {
+		return Amount{unscaled: a.rescale(scale), scale: scale}
+	}
+	return Amount{unscaled: roundQuo(a.int(), pow10(a.scale-scale), mode), scale: scale}
+}
+
+// Neg returns -a.
+func (a Amount) Neg() Amount {
+	return Amount{unscaled: new(big.Int).Neg(a.int()), scale: a.scale}
+}
+
+// Abs returns |a|.
+func (a Amount) Abs() Amount {
+	return Amount{unscaled: new(big.Int).Abs(a.int()), scale: a.scale}
+}
+
+// Cmp compares a and b and returns -1, 0 or +1. Trailing zeros do not matter, 1.50 equals 1.5.
+func (a Amount) Cmp(b Amount) int {
+	scale := maxScale(a, b)
+	return a.rescale(scale).Cmp(b.rescale(scale))
+}
+
+// Sign returns -1, 0 or +1 depending on the sign of a.
+func (a Amount) Sign() int {
+	if a.unscaled == nil {
+		return 0
+	}
+	return a.unscaled.Sign()
+}
+
+// IsZero reports whether a is 0.
+func (a Amount) IsZero() bool {
+	return a.Sign() == 0
+}
+
+// Rat returns a as a big.Rat.
+func (a Amount) Rat() *big.Rat {
+	return new(big.Rat).SetFrac(a.int(), pow10(a.scale))
+}
+
+// Float64 returns the nearest float64, for display only.
+func (a Amount) Float64() float64 {
+	f, _ := a.Rat().Float64()
+	return f
+}
+
+// String formats a in plain notation with Scale fraction digits.
+func (a Amount) String() string {
+	digits := new(big.Int).Abs(a.int()).String()
+	sign := ""
+	if a.Sign() < 0 {
+		sign = "-"
+	}
+	if a.scale <= 0 {
+		return sign + digits
+	}
+	if pad := int(a.scale) + 1 - len(digits); pad > 0 {
+		digits = strings.Repeat("0", pad) + digits
+	}
+	point := len(digits) - int(a.scale)
+	return sign + digits[:point] + "." + digits[point:]
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.String())
+}
+
+// UnmarshalJSON accepts a JSON string or number, an empty string or null is 0.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		*a = Amount{}
+		return nil
+	}
+	if strings.HasPrefix(s, `"`) {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+	}
+	parsed, err := parseAmountField(s)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// parseAmountField parses an amount field of a response, the API leaves some empty.
+func parseAmountField(s string) (Amount, error) {
+	if s == "" {
+		return Amount{}, nil
+	}
+	return ParseAmount(s)
+}
+
+// roundQuo returns num / den rounded with mode.
+func roundQuo(num *big.Int, den *big.Int, mode RoundingMode) *big.Int {
+	q, r := new(big.Int).QuoRem(num, den, new(big.Int))
+	if r.Sign() == 0 {
+		return q
+	}
+	step := big.NewInt(int64(num.Sign() * den.Sign()))
+	switch mode {
+	case RoundUp:
+		q.Add(q, step)
+	case RoundHalfUp:
+		if new(big.Int).Abs(new(big.Int).Lsh(r, 1)).Cmp(new(big.Int).Abs(den)) >= 0 {
+			q.Add(q, step)
+		}
+	}
+	return q
+}
+
+func maxScale(a Amount, b Amount) int32 {
+	if a.scale > b.scale {
+		return a.scale
+	}
+	return b.scale
+}
+
+func pow10(n int32) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// ToMinimalUnits converts an amount of the coin to its minimal units using CoinDecimal.
+func (c Coin) ToMinimalUnits(a Amount) (*big.Int, error) {
+	return a.MinimalUnits(c.CoinDecimal)
+}
+
+// FromMinimalUnits converts minimal units of the coin to an amount using CoinDecimal.
+func (c Coin) FromMinimalUnits(units *big.Int) Amount {
+	return AmountFromMinimalUnits(units, c.CoinDecimal)
+}
+
+// FeeToMinimalUnits converts a fee of the coin to minimal units of FeeUnit using FeeDecimal.
+func (c Coin) FeeToMinimalUnits(a Amount) (*big.Int, error) {
+	return a.MinimalUnits(c.FeeDecimal)
+}
+
+// FeeFromMinimalUnits converts minimal units of FeeUnit to a fee amount using FeeDecimal.
+func (c Coin) FeeFromMinimalUnits(units *big.Int) Amount {
+	return AmountFromMinimalUnits(units, c.FeeDecimal)
+}
+
+func (c Coin) MinTransferAmountValue() (Amount, error) {
+	return parseAmountField(c.MinTransferAmount)
+}
+
+func (c AccountCoin) BalanceValue() (Amount, error) {
+	return parseAmountField(c.Balance)
+}
+
+func (c AccountCoin) UsdBalanceValue() (Amount, error) {
+	return parseAmountField(c.UsdBalance)
+}
+
+func (r TransactionsResponse) TxAmountValue() (Amount, error) {
+	return parseAmountField(r.TxAmount)
+}
+
+func (r TransactionsResponse) TxFeeValue() (Amount, error) {
+	return parseAmountField(r.TxFee)
+}
+
+func (r OneTransactionsResponse) TxAmountValue() (Amount, error) {
+	return parseAmountField(r.TxAmount)
+}
+
+func (r OneTransactionsResponse) TxFeeValue() (Amount, error) {
+	return parseAmountField(r.TxFee)
+}
+
+func (r CreateTransactionsRequest) TxAmountValue() (Amount, error) {
+	return parseAmountField(r.TxAmount)
+}
+
+func (d DestinationAddress) AmountValue() (Amount, error) {
+	return parseAmountField(d.Amount)
+}
+
+func (f FeeRateDto) FeeRateValue() (Amount, error) {
+	return parseAmountField(f.FeeRate)
+}
+
+func (f FeeRate) FeeRateValue() (Amount, error) {
+	return parseAmountField(f.FeeRate)
+}
+
+func (f FeeRate) FeeValue() (Amount, error) {
+	return parseAmountField(f.Fee)
+}
@@ -1,6 +1,8 @@
 package api
 
 import (
+	"context"
+
 	"github.com/Safeheron/safeheron-api-sdk-go/safeheron"
 )
 
@@ -9,5 +11,9 @@ type ApiKeyManagementApi struct {
 }
 
 func (e *ApiKeyManagementApi) DisableApikey(r *ResultResponse) error {
-	return e.Client.SendRequest(nil, r, "/v1/apikey/disable")
+	return e.DisableApikeyCtx(context.Background(), r)
+}
+
+func (e *ApiKeyManagementApi) DisableApikeyCtx(ctx context.Context, r *ResultResponse) error {
+	return e.Client.SendRequestCtx(ctx, nil, r, "/v1/apikey/disable")
 }
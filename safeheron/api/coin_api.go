@@ -1,6 +1,8 @@
 package api
 
 import (
+	"context"
+
 	"github.com/Safeheron/safeheron-api-sdk-go/safeheron"
 )
 
@@ -8,7 +10,9 @@ type CoinApi struct {
 	Client safeheron.Client
 }
 
-type CoinResponse []struct {
+type CoinResponse []Coin
+
+type Coin struct {
 	CoinKey           string `json:"coinKey"`
 	CoinFullName      string `json:"coinFullName"`
 	CoinName          string `json:"coinName"`
@@ -34,10 +38,16 @@ type CoinResponse []struct {
 }
 
 func (e *CoinApi) ListCoin(r *CoinResponse) error {
-	return e.Client.SendRequest(nil, r, "/v1/coin/list")
+	return e.ListCoinCtx(context.Background(), r)
+}
+
+func (e *CoinApi) ListCoinCtx(ctx context.Context, r *CoinResponse) error {
+	return e.Client.SendRequestCtx(ctx, nil, r, "/v1/coin/list")
 }
 
-type CoinMaintainResponse []struct {
+type CoinMaintainResponse []CoinMaintain
+
+type CoinMaintain struct {
 	CoinKey   string `json:"coinKey"`
 	Maintain  bool   `json:"maintain"`
 	Title     string `json:"title"`
@@ -47,7 +57,11 @@ type CoinMaintainResponse []struct {
 }
 
 func (e *CoinApi) ListCoinMaintain(r *CoinMaintainResponse) error {
-	return e.Client.SendRequest(nil, r, "/v1/coin/maintain/list")
+	return e.ListCoinMaintainCtx(context.Background(), r)
+}
+
+func (e *CoinApi) ListCoinMaintainCtx(ctx context.Context, r *CoinMaintainResponse) error {
+	return e.Client.SendRequestCtx(ctx, nil, r, "/v1/coin/maintain/list")
 }
 
 type CheckCoinAddressRequest struct {
@@ -65,7 +79,11 @@ type CheckCoinAddressResponse struct {
 }
 
 func (e *CoinApi) CheckCoinAddress(d CheckCoinAddressRequest, r *CheckCoinAddressResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/coin/address/check")
+	return e.CheckCoinAddressCtx(context.Background(), d, r)
+}
+
+func (e *CoinApi) CheckCoinAddressCtx(ctx context.Context, d CheckCoinAddressRequest, r *CheckCoinAddressResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/coin/address/check")
 }
 
 type CoinBalanceSnapshotRequest struct {
@@ -78,7 +96,11 @@ type CoinBalanceSnapshotResponse []struct {
 }
 
 func (e *CoinApi) CoinBalanceSnapshot(d CoinBalanceSnapshotRequest, r *CoinBalanceSnapshotResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/coin/balance/snapshot")
+	return e.CoinBalanceSnapshotCtx(context.Background(), d, r)
+}
+
+func (e *CoinApi) CoinBalanceSnapshotCtx(ctx context.Context, d CoinBalanceSnapshotRequest, r *CoinBalanceSnapshotResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/coin/balance/snapshot")
 }
 
 type CoinBlockHeightRequest struct {
@@ -91,5 +113,9 @@ type CoinBlockHeightResponse []struct {
 }
 
 func (e *CoinApi) CoinBlockHeight(d CoinBlockHeightRequest, r *CoinBlockHeightResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/coin/block/height")
+	return e.CoinBlockHeightCtx(context.Background(), d, r)
+}
+
+func (e *CoinApi) CoinBlockHeightCtx(ctx context.Context, d CoinBlockHeightRequest, r *CoinBlockHeightResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/coin/block/height")
 }
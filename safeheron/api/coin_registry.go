@@ -0,0 +1,335 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrCoinNotFound is returned by CoinRegistry lookups for unknown coins.
+var ErrCoinNotFound = errors.New("coin not found")
+
+// RequiresMemo reports whether transfers of the coin take a memo or destination tag.
+func (c Coin) RequiresMemo() bool {
+	return isYes(c.IsMemo)
+}
+
+// UtxoBased reports whether the coin is UTXO based, like BTC.
+func (c Coin) UtxoBased() bool {
+	return isYes(c.IsUtxo)
+}
+
+func isYes(flag string) bool {
+	return flag == "1" || strings.EqualFold(flag, "true")
+}
+
+// Active reports whether the maintenance window covers t. A window without
+// start or end time is open on that side.
+func (m CoinMaintain) Active(t time.Time) bool {
+	if !m.Maintain {
+		return false
+	}
+	if start, ok := parseMaintainTime(m.StartTime); ok && t.Before(start) {
+		return false
+	}
+	if end, ok := parseMaintainTime(m.EndTime); ok && !t.Before(end) {
+		return false
+	}
+	return true
+}
+
+// gmt8 is the time zone of the dates returned by the Safeheron API.
+var gmt8 = time.FixedZone("GMT+8", 8*60*60)
+
+// parseMaintainTime parses a maintenance time given in milliseconds, RFC 3339 or
+// as "2006-01-02 15:04:05" in GMT+8.
+func parseMaintainTime(s string) (time.Time, bool) {
+	if s == "" {
+		return time.Time{}, false
+	}
+	if millis, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.UnixMilli(millis), true
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, true
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04:05", s, gmt8); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// CoinRegistry caches ListCoin and ListCoinMaintain, indexed by coinKey,
+// symbol and network, and token contract. The lists are loaded on first use with
+// the context of the lookup. Once older than refreshInterval they are loaded again
+// in the background while lookups keep being served from the cache, a failed
+// refresh keeps the cached lists. Failed loads are retried after a backoff, up to
+// a minute, lookups made in between fail fast with the last error when nothing
+// is cached.
+type CoinRegistry struct {
+	coinApi CoinApi
+	// refreshInterval is how often the lists are loaded again, 0 disables it.
+	refreshInterval time.Duration
+	// loading is held by the load in progress, lists are loaded one at a time
+	// and without holding mu.
+	loading chan struct{}
+
+	mu          sync.Mutex
+	loadedAt    time.Time
+	refreshing  bool
+	failures    int
+	retryAt     time.Time
+	loadErr     error
+	coins       []Coin
+	byKey       map[string]Coin
+	bySymbol    map[string]Coin
+	byToken     map[string][]Coin
+	maintenance map[string][]CoinMaintain
+}
+
+// NewCoinRegistry returns a registry loading the coins through coinApi.
+func NewCoinRegistry(coinApi CoinApi, refreshInterval time.Duration) *CoinRegistry {
+	return &CoinRegistry{coinApi: coinApi, refreshInterval: refreshInterval, loading: make(chan struct{}, 1)}
+}
+
+// Refresh loads the coin and maintenance lists now.
+func (r *CoinRegistry) Refresh(ctx context.Context) error {
+	select {
+	case r.loading <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-r.loading }()
+	return r.load(ctx)
+}
+
+// load fetches the lists and swaps them in, the caller holds loading.
+func (r *CoinRegistry) load(ctx context.Context) error {
+	var coins CoinResponse
+	err := r.coinApi.ListCoinCtx(ctx, &coins)
+	var maintains CoinMaintainResponse
+	if err == nil {
+		err = r.coinApi.ListCoinMaintainCtx(ctx, &maintains)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		if ctx.Err() == nil {
+			// Cancelled lookups say nothing about the API, only real failures back off
+			r.failures++
+			r.retryAt = time.Now().Add(coinRegistryBackoff(r.failures))
+			r.loadErr = err
+		}
+		return err
+	}
+	byKey := map[string]Coin{}
+	bySymbol := map[string]Coin{}
+	byToken := map[string][]Coin{}
+	for _, coin := range coins {
+		byKey[coin.CoinKey] = coin
+		if key := symbolKey(coin.Symbol, coin.Network); bySymbol[key].CoinKey == "" {
+			bySymbol[key] = coin
+		}
+		if coin.TokenIdentifier != "" {
+			key := strings.ToLower(coin.TokenIdentifier)
+			byToken[key] = append(byToken[key], coin)
+		}
+	}
+	maintenance := map[string][]CoinMaintain{}
+	for _, maintain := range maintains {
+		maintenance[maintain.CoinKey] = append(maintenance[maintain.CoinKey], maintain)
+	}
+	r.coins, r.byKey, r.bySymbol, r.byToken, r.maintenance = coins, byKey, bySymbol, byToken, maintenance
+	r.loadedAt, r.failures, r.retryAt, r.loadErr = time.Now(), 0, time.Time{}, nil
+	return nil
+}
+
+// coinRegistryBackoff is the delay before loading again after failures failed loads.
+func coinRegistryBackoff(failures int) time.Duration {
+	if failures > 6 {
+		return time.Minute
+	}
+	return time.Second << (failures - 1)
+}
+
+// refresh loads the lists on first use, and starts loading them again in the
+// background when they are older than refreshInterval. It must be called without mu.
+func (r *CoinRegistry) refresh(ctx context.Context) error {
+	r.mu.Lock()
+	now := time.Now()
+	if r.byKey != nil {
+		if r.refreshInterval > 0 && now.Sub(r.loadedAt) >= r.refreshInterval && !r.refreshing && !now.Before(r.retryAt) {
+			r.refreshing = true
+			go r.refreshInBackground()
+		}
+		r.mu.Unlock()
+		return nil
+	}
+	if now.Before(r.retryAt) {
+		err := r.loadErr
+		r.mu.Unlock()
+		return err
+	}
+	r.mu.Unlock()
+
+	select {
+	case r.loading <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-r.loading }()
+	// Another lookup may have loaded the lists, or failed to, while this one waited
+	r.mu.Lock()
+	loaded, backingOff, err := r.byKey != nil, time.Now().Before(r.retryAt), r.loadErr
+	r.mu.Unlock()
+	if loaded {
+		return nil
+	}
+	if backingOff {
+		return err
+	}
+	return r.load(ctx)
+}
+
+func (r *CoinRegistry) refreshInBackground() {
+	defer func() {
+		r.mu.Lock()
+		r.refreshing = false
+		r.mu.Unlock()
+	}()
+	r.loading <- struct{}{}
+	defer func() { <-r.loading }()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	r.load(ctx)
+}
+
+func symbolKey(symbol string, network string) string {
+	return strings.ToUpper(symbol) + "/" + strings.ToUpper(network)
+}
+
+// Coins returns all coins.
+func (r *CoinRegistry) Coins() ([]Coin, error) {
+	return r.CoinsCtx(context.Background())
+}
+
+func (r *CoinRegistry) CoinsCtx(ctx context.Context) ([]Coin, error) {
+	if err := r.refresh(ctx); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Coin(nil), r.coins...), nil
+}
+
+// Coin returns the coin with coinKey, for example "ETH_GOERLI".
+func (r *CoinRegistry) Coin(coinKey string) (Coin, error) {
+	return r.CoinCtx(context.Background(), coinKey)
+}
+
+func (r *CoinRegistry) CoinCtx(ctx context.Context, coinKey string) (Coin, error) {
+	if err := r.refresh(ctx); err != nil {
+		return Coin{}, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	coin, ok := r.byKey[coinKey]
+	if !ok {
+		return Coin{}, fmt.Errorf("%w: %s", ErrCoinNotFound, coinKey)
+	}
+	return coin, nil
+}
+
+// CoinBySymbol returns the coin with symbol on network, for example "USDT" on "Mainnet", ignoring case.
+func (r *CoinRegistry) CoinBySymbol(symbol string, network string) (Coin, error) {
+	return r.CoinBySymbolCtx(context.Background(), symbol, network)
+}
+
+func (r *CoinRegistry) CoinBySymbolCtx(ctx context.Context, symbol string, network string) (Coin, error) {
+	if err := r.refresh(ctx); err != nil {
+		return Coin{}, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	coin, ok := r.bySymbol[symbolKey(symbol, network)]
+	if !ok {
+		return Coin{}, fmt.Errorf("%w: %s on %s", ErrCoinNotFound, symbol, network)
+	}
+	return coin, nil
+}
+
+// CoinsByToken returns the coins of a token contract, ignoring case. The same
+// contract address can exist on several chains, hence several coins.
+func (r *CoinRegistry) CoinsByToken(tokenIdentifier string) ([]Coin, error) {
+	return r.CoinsByTokenCtx(context.Background(), tokenIdentifier)
+}
+
+func (r *CoinRegistry) CoinsByTokenCtx(ctx context.Context, tokenIdentifier string) ([]Coin, error) {
+	if err := r.refresh(ctx); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	coins, ok := r.byToken[strings.ToLower(tokenIdentifier)]
+	if !ok {
+		return nil, fmt.Errorf("%w: token %s", ErrCoinNotFound, tokenIdentifier)
+	}
+	return append([]Coin(nil), coins...), nil
+}
+
+// IsUtxo reports whether the coin is UTXO based.
+func (r *CoinRegistry) IsUtxo(coinKey string) (bool, error) {
+	return r.IsUtxoCtx(context.Background(), coinKey)
+}
+
+func (r *CoinRegistry) IsUtxoCtx(ctx context.Context, coinKey string) (bool, error) {
+	coin, err := r.CoinCtx(ctx, coinKey)
+	return coin.UtxoBased(), err
+}
+
+// RequiresMemo reports whether transfers of the coin take a memo.
+func (r *CoinRegistry) RequiresMemo(coinKey string) (bool, error) {
+	return r.RequiresMemoCtx(context.Background(), coinKey)
+}
+
+func (r *CoinRegistry) RequiresMemoCtx(ctx context.Context, coinKey string) (bool, error) {
+	coin, err := r.CoinCtx(ctx, coinKey)
+	return coin.RequiresMemo(), err
+}
+
+// Maintenance returns the maintenance windows of the coin.
+func (r *CoinRegistry) Maintenance(coinKey string) ([]CoinMaintain, error) {
+	return r.MaintenanceCtx(context.Background(), coinKey)
+}
+
+func (r *CoinRegistry) MaintenanceCtx(ctx context.Context, coinKey string) ([]CoinMaintain, error) {
+	if err := r.refresh(ctx); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]CoinMaintain(nil), r.maintenance[coinKey]...), nil
+}
+
+// UnderMaintenance reports whether the coin is under maintenance right now.
+func (r *CoinRegistry) UnderMaintenance(coinKey string) (bool, error) {
+	return r.UnderMaintenanceCtx(context.Background(), coinKey)
+}
+
+func (r *CoinRegistry) UnderMaintenanceCtx(ctx context.Context, coinKey string) (bool, error) {
+	maintains, err := r.MaintenanceCtx(ctx, coinKey)
+	if err != nil {
+		return false, err
+	}
+	now := time.Now()
+	for _, maintain := range maintains {
+		if maintain.Active(now) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
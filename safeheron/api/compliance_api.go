@@ -1,6 +1,8 @@
 package api
 
 import (
+	"context"
+
 	"github.com/Safeheron/safeheron-api-sdk-go/safeheron"
 )
 
@@ -30,5 +32,9 @@ type AmlReport struct {
 }
 
 func (e *ComplianceApi) KytReport(d KytReportRequest, r *KytReportResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/compliance/kyt/report")
+	return e.KytReportCtx(context.Background(), d, r)
+}
+
+func (e *ComplianceApi) KytReportCtx(ctx context.Context, d KytReportRequest, r *KytReportResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/compliance/kyt/report")
 }
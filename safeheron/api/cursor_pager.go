@@ -0,0 +1,176 @@
+package api
+
+import (
+	"context"
+)
+
+// CursorPager walks an endpoint paged with direct/fromId/limit, following the
+// cursor from page to page until the list is exhausted.
+//
+//	pager := transactionApi.IterateTransactionsV2(ctx, api.ListTransactionsV2Request{Limit: 100})
+//	defer pager.Close()
+//	for pager.Next() {
+//		tx := pager.Item()
+//	}
+//	if err := pager.Err(); err != nil {
+//	}
+type CursorPager[T any] struct {
+	// Prefetch fetches the next page in the background while the current one is consumed.
+	// It must be set before the first call to Next.
+	Prefetch bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	fetch  func(ctx context.Context, fromId string) ([]T, error)
+	key    func(T) string
+	direct string
+	limit  int32
+
+	fromId   string
+	page     []T
+	index    int
+	item     T
+	last     bool
+	err      error
+	prefetch chan cursorPage[T]
+}
+
+type cursorPage[T any] struct {
+	items []T
+	err   error
+}
+
+func newCursorPager[T any](ctx context.Context, direct string, fromId string, limit int32, key func(T) string, fetch func(ctx context.Context, fromId string) ([]T, error)) *CursorPager[T] {
+	ctx, cancel := context.WithCancel(ctx)
+	return &CursorPager[T]{ctx: ctx, cancel: cancel, fetch: fetch, key: key, direct: direct, limit: limit, fromId: fromId}
+}
+
+// Next advances to the next item, it returns false when there are no more items or an error occurred.
+func (p *CursorPager[T]) Next() bool {
+	for p.index >= len(p.page) {
+		if p.last || p.err != nil {
+			return false
+		}
+		var page cursorPage[T]
+		if p.prefetch != nil {
+			page = <-p.prefetch
+			p.prefetch = nil
+		} else {
+			page.items, page.err = p.fetch(p.ctx, p.fromId)
+		}
+		if page.err != nil {
+			p.err = page.err
+			return false
+		}
+		p.advance(page.items)
+	}
+	p.item = p.page[p.index]
+	p.index++
+	return true
+}
+
+// advance makes items the current page and moves the cursor past it.
+func (p *CursorPager[T]) advance(items []T) {
+	p.page, p.index = items, 0
+	if len(items) == 0 || (p.limit > 0 && int32(len(items)) < p.limit) {
+		p.last = true
+		return
+	}
+	// PREV pages towards the first item of the page, NEXT towards the last one
+	cursor := p.key(items[len(items)-1])
+	if p.direct == "PREV" {
+		cursor = p.key(items[0])
+	}
+	if cursor == "" || cursor == p.fromId {
+		p.last = true
+		return
+	}
+	p.fromId = cursor
+	if p.Prefetch {
+		p.prefetch = make(chan cursorPage[T], 1)
+		go func(prefetch chan<- cursorPage[T], fromId string) {
+			items, err := p.fetch(p.ctx, fromId)
+			prefetch <- cursorPage[T]{items: items, err: err}
+		}(p.prefetch, p.fromId)
+	}
+}
+
+// Item returns the current item.
+func (p *CursorPager[T]) Item() T {
+	return p.item
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (p *CursorPager[T]) Err() error {
+	return p.err
+}
+
+// Close stops a pending prefetch. The pager must not be used afterwards.
+func (p *CursorPager[T]) Close() {
+	p.cancel()
+}
+
+// Collect consumes the pager and returns all remaining items.
+func (p *CursorPager[T]) Collect() ([]T, error) {
+	defer p.Close()
+	var items []T
+	for p.Next() {
+		items = append(items, p.Item())
+	}
+	return items, p.Err()
+}
+
+// IterateTransactionsV2 pages through ListTransactionsV2 starting at d.FromId in direction d.Direct.
+func (e *TransactionApi) IterateTransactionsV2(ctx context.Context, d ListTransactionsV2Request) *CursorPager[TransactionsResponse] {
+	return newCursorPager(ctx, d.Direct, d.FromId, d.Limit, func(tx TransactionsResponse) string { return tx.TxKey },
+		func(ctx context.Context, fromId string) ([]TransactionsResponse, error) {
+			d.FromId = fromId
+			var r TransactionsResponseV2
+			err := e.ListTransactionsV2Ctx(ctx, d, &r)
+			return r, err
+		})
+}
+
+// IterateMPCSignTransactions pages through ListMPCSignTransactions starting at d.FromId in direction d.Direct.
+func (e *MpcSignApi) IterateMPCSignTransactions(ctx context.Context, d ListMPCSignTransactionsRequest) *CursorPager[MPCSignTransactionsResponse] {
+	return newCursorPager(ctx, d.Direct, d.FromId, d.Limit, func(tx MPCSignTransactionsResponse) string { return tx.TxKey },
+		func(ctx context.Context, fromId string) ([]MPCSignTransactionsResponse, error) {
+			d.FromId = fromId
+			var r []MPCSignTransactionsResponse
+			err := e.ListMPCSignTransactionsCtx(ctx, d, &r)
+			return r, err
+		})
+}
+
+// IterateWeb3Sign pages through ListWeb3Sign starting at d.FromId in direction d.Direct.
+func (e *Web3Api) IterateWeb3Sign(ctx context.Context, d ListWeb3SignRequest) *CursorPager[Web3SignQueryResponse] {
+	return newCursorPager(ctx, d.Direct, d.FromId, d.Limit, func(sign Web3SignQueryResponse) string { return sign.TxKey },
+		func(ctx context.Context, fromId string) ([]Web3SignQueryResponse, error) {
+			d.FromId = fromId
+			var r []Web3SignQueryResponse
+			err := e.ListWeb3SignCtx(ctx, d, &r)
+			return r, err
+		})
+}
+
+// IterateWeb3Accounts pages through ListWeb3Accounts starting at d.FromId in direction d.Direct.
+func (e *Web3Api) IterateWeb3Accounts(ctx context.Context, d ListWeb3AccountRequest) *CursorPager[CreateWeb3AccountResponse] {
+	return newCursorPager(ctx, d.Direct, d.FromId, d.Limit, func(account CreateWeb3AccountResponse) string { return account.AccountKey },
+		func(ctx context.Context, fromId string) ([]CreateWeb3AccountResponse, error) {
+			d.FromId = fromId
+			var r []CreateWeb3AccountResponse
+			err := e.ListWeb3AccountsCtx(ctx, d, &r)
+			return r, err
+		})
+}
+
+// IterateWhitelist pages through ListWhitelist starting at d.FromId in direction d.Direct.
+func (e *WhitelistApi) IterateWhitelist(ctx context.Context, d ListWhitelistRequest) *CursorPager[WhitelistResponse] {
+	return newCursorPager(ctx, d.Direct, d.FromId, d.Limit, func(whitelist WhitelistResponse) string { return whitelist.WhitelistKey },
+		func(ctx context.Context, fromId string) ([]WhitelistResponse, error) {
+			d.FromId = fromId
+			var r []WhitelistResponse
+			err := e.ListWhitelistCtx(ctx, d, &r)
+			return r, err
+		})
+}
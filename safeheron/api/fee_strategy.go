@@ -0,0 +1,305 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// FeeLevel selects one of the fee rates returned by TransactionFeeRate.
+type FeeLevel string
+
+const (
+	FeeLevelMin    FeeLevel = "MIN"
+	FeeLevelLow    FeeLevel = "LOW"
+	FeeLevelMiddle FeeLevel = "MIDDLE"
+	FeeLevelHigh   FeeLevel = "HIGH"
+)
+
+// ErrFeeBelowMinimum is returned when a cap of the strategy would lower the fee
+// rate below the minimum rate of the chain, the transaction would not confirm.
+var ErrFeeBelowMinimum = errors.New("capped fee rate is below the minimum fee rate")
+
+// FeeStrategy turns the fee rates of TransactionFeeRate into the FeeRateDto of a
+// create request, for example "middle plus 10%, capped at 5 USD":
+//
+//	api.FeeStrategy{Level: api.FeeLevelMiddle, MarkupPercent: api.NewAmount(10, 0), MaxFeeUsd: api.NewAmount(5, 0), FeeCoinPrice: prices}
+//
+// The rate fields filled in depend on the chain family: MaxFee and MaxPriorityFee
+// for EIP-1559 chains, GasFeeCap and GasPremium for Filecoin, GasBudget for Sui,
+// GasUnitPrice and MaxGasAmount for Aptos, FeeRate for UTXO and other chains.
+type FeeStrategy struct {
+	// Level is the fee rate the strategy starts from, MIDDLE when not set.
+	Level FeeLevel
+	// MarkupPercent raises every rate, 10 for 10%.
+	MarkupPercent Amount
+	// MaxTxFeeRate caps FeeRate, the rate of UTXO and other plain fee rate
+	// chains, like the maxTxFeeRate of a request sent with a TxFeeLevel. The
+	// estimate sets a FeeRateDto instead, Safeheron does not enforce it then.
+	MaxTxFeeRate Amount
+	// MaxRates caps every rate set in it, each in the unit of the rate: MaxFee
+	// in Gwei for EIP-1559 chains, GasBudget in MIST for Sui, and so on. Gas
+	// limits are not capped.
+	MaxRates FeeRateDto
+	// MaxFeeUsd caps the estimated fee in USD, FeeCoinPrice must be set.
+	MaxFeeUsd Amount
+	// FeeCoinPrice returns the USD price of one unit of a fee coin.
+	FeeCoinPrice func(ctx context.Context, feeCoinKey string) (Amount, error)
+}
+
+// FeeEstimate is the outcome of a FeeStrategy.
+type FeeEstimate struct {
+	FeeRateDto FeeRateDto
+	FeeCoinKey string
+	// Fee is the estimated total fee in FeeCoinKey units, zero when the API returned no estimate.
+	Fee Amount
+	// FeeUsd is the estimated fee in USD, zero without FeeCoinPrice.
+	FeeUsd Amount
+	// Capped is true when MaxTxFeeRate, MaxRates or MaxFeeUsd lowered the rate.
+	Capped bool
+}
+
+// Apply sets the fee of a create request, replacing TxFeeLevel and
+// MaxTxFeeRate which only apply together.
+func (e FeeEstimate) Apply(d *CreateTransactionsRequest) {
+	d.TxFeeLevel = ""
+	d.MaxTxFeeRate = ""
+	d.FeeRateDto = e.FeeRateDto
+}
+
+// ApplyUTXOMultiDest sets the fee of a UTXO multi destination create request,
+// replacing TxFeeLevel and MaxTxFeeRate which only apply together.
+func (e FeeEstimate) ApplyUTXOMultiDest(d *CreateTransactionsUTXOMultiDestRequest) {
+	d.TxFeeLevel = ""
+	d.MaxTxFeeRate = ""
+	d.FeeRateDto = e.FeeRateDto
+}
+
+// EstimateFee queries TransactionFeeRate for d and applies strategy for coin.
+func (e *TransactionApi) EstimateFee(ctx context.Context, d TransactionsFeeRateRequest, coin Coin, strategy FeeStrategy) (FeeEstimate, error) {
+	var rates TransactionsFeeRateResponse
+	if err := e.TransactionFeeRateCtx(ctx, d, &rates); err != nil {
+		return FeeEstimate{}, err
+	}
+	return strategy.Estimate(ctx, coin, rates)
+}
+
+// Estimate applies the strategy to fee rates returned by TransactionFeeRate for coin.
+func (s FeeStrategy) Estimate(ctx context.Context, coin Coin, rates TransactionsFeeRateResponse) (FeeEstimate, error) {
+	rate, err := rates.level(s.Level)
+	if err != nil {
+		return FeeEstimate{}, err
+	}
+	primary, err := ParseAmount(rate.primaryRate())
+	if err != nil {
+		return FeeEstimate{}, fmt.Errorf("fee rate of %s: %w", coin.CoinKey, err)
+	}
+	fee, err := parseAmountField(rate.Fee)
+	if err != nil {
+		return FeeEstimate{}, fmt.Errorf("fee of %s: %w", coin.CoinKey, err)
+	}
+	feeCoinKey := coin.FeeCoinKey
+	if feeCoinKey == "" {
+		feeCoinKey = coin.CoinKey
+	}
+
+	hundred := NewAmount(100, 0)
+	factor := hundred.Add(s.MarkupPercent).Quo(hundred, s.MarkupPercent.Scale()+2, RoundDown)
+	capped := false
+	caps := s.caps()
+	for i, value := range rate.rates() {
+		if value == "" || caps[i].Sign() <= 0 {
+			continue
+		}
+		amount, err := ParseAmount(value)
+		if err != nil {
+			return FeeEstimate{}, fmt.Errorf("fee rate of %s: %w", coin.CoinKey, err)
+		}
+		if amount.Sign() > 0 && amount.Mul(factor).Cmp(caps[i]) > 0 {
+			factor, capped = caps[i].Quo(amount, 18, RoundDown), true
+		}
+	}
+	var price Amount
+	if s.FeeCoinPrice != nil {
+		if price, err = s.FeeCoinPrice(ctx, feeCoinKey); err != nil {
+			return FeeEstimate{}, err
+		}
+	}
+	if s.MaxFeeUsd.Sign() > 0 {
+		if s.FeeCoinPrice == nil {
+			return FeeEstimate{}, errors.New("MaxFeeUsd needs FeeCoinPrice")
+		}
+		if fee.IsZero() || price.IsZero() {
+			return FeeEstimate{}, fmt.Errorf("no fee estimate for %s to cap in USD", coin.CoinKey)
+		}
+		if fee.Mul(factor).Mul(price).Cmp(s.MaxFeeUsd) > 0 {
+			factor, capped = s.MaxFeeUsd.Quo(fee.Mul(price), 18, RoundDown), true
+		}
+	}
+	if minimum, err := ParseAmount(rates.MinFeeRate.primaryRate()); err == nil && capped && primary.Mul(factor).Cmp(minimum) < 0 {
+		return FeeEstimate{}, fmt.Errorf("%w: %s %s for %s", ErrFeeBelowMinimum, primary.Mul(factor).Round(primary.Scale(), RoundDown), rates.FeeUnit, coin.CoinKey)
+	}
+
+	// Round towards the cap when capped, up otherwise so the markup is never lost
+	mode := RoundUp
+	if capped {
+		mode = RoundDown
+	}
+	dto, err := rate.scale(factor, mode)
+	if err != nil {
+		return FeeEstimate{}, fmt.Errorf("fee rate of %s: %w", coin.CoinKey, err)
+	}
+	estimate := FeeEstimate{FeeRateDto: dto, FeeCoinKey: feeCoinKey, Capped: capped}
+	estimate.Fee = fee.Mul(factor)
+	if coin.FeeDecimal > 0 {
+		estimate.Fee = estimate.Fee.Round(coin.FeeDecimal, mode)
+	}
+	if !price.IsZero() {
+		estimate.FeeUsd = estimate.Fee.Mul(price).Round(6, RoundUp)
+	}
+	return estimate, nil
+}
+
+// Exceeds reports whether a rate of d is over its cap in the strategy.
+func (s FeeStrategy) Exceeds(d FeeRateDto) bool {
+	caps := s.caps()
+	for i, value := range d.feeRate().rates() {
+		if amount, err := ParseAmount(value); err == nil && caps[i].Sign() > 0 && amount.Cmp(caps[i]) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// caps returns the cap of every rate, in the order of FeeRate.rates, zero when not capped.
+func (s FeeStrategy) caps() [7]Amount {
+	var caps [7]Amount
+	m := s.MaxRates
+	for i, value := range [7]string{m.MaxFee, m.MaxPriorityFee, m.GasFeeCap, m.GasPremium, m.GasBudget, m.GasUnitPrice, m.FeeRate} {
+		if value != "" {
+			caps[i], _ = ParseAmount(value)
+		}
+	}
+	if s.MaxTxFeeRate.Sign() > 0 && (caps[6].Sign() <= 0 || s.MaxTxFeeRate.Cmp(caps[6]) < 0) {
+		caps[6] = s.MaxTxFeeRate
+	}
+	return caps
+}
+
+func (r TransactionsFeeRateResponse) level(level FeeLevel) (FeeRate, error) {
+	switch level {
+	case FeeLevelMin:
+		return r.MinFeeRate, nil
+	case FeeLevelLow:
+		return r.LowFeeRate, nil
+	case FeeLevelMiddle, "":
+		return r.MiddleFeeRate, nil
+	case FeeLevelHigh:
+		return r.HighFeeRate, nil
+	}
+	return FeeRate{}, fmt.Errorf("unknown fee level %q", level)
+}
+
+// primaryRate is the rate a fee rate cap applies to, it depends on the chain family.
+func (f FeeRate) primaryRate() string {
+	switch {
+	case f.MaxFee != "":
+		return f.MaxFee
+	case f.GasFeeCap != "":
+		return f.GasFeeCap
+	case f.GasBudget != "":
+		return f.GasBudget
+	case f.GasUnitPrice != "":
+		return f.GasUnitPrice
+	}
+	return f.FeeRate
+}
+
+// rates returns the rates of the chain family, in the order MaxFee,
+// MaxPriorityFee, GasFeeCap, GasPremium, GasBudget, GasUnitPrice and FeeRate.
+// The rates of the other families and gas limits are left empty.
+func (f FeeRate) rates() [7]string {
+	switch {
+	case f.MaxFee != "":
+		return [7]string{0: f.MaxFee, 1: f.MaxPriorityFee}
+	case f.GasFeeCap != "":
+		return [7]string{2: f.GasFeeCap, 3: f.GasPremium}
+	case f.GasBudget != "":
+		return [7]string{4: f.GasBudget}
+	case f.GasUnitPrice != "":
+		return [7]string{5: f.GasUnitPrice}
+	}
+	return [7]string{6: f.FeeRate}
+}
+
+// feeRateScale is the number of decimal places the decimal rates, MaxFee,
+// MaxPriorityFee and FeeRate, are scaled to at least. Rounding a small rate at
+// its own scale would raise it by a whole unit, 1 sat/b plus 1% to 2.
+const feeRateScale = 3
+
+// scale multiplies the rates of the chain family by factor into a FeeRateDto.
+// The decimal rates are rounded to feeRateScale places or their own, the rates
+// in integer units keep their number of decimal places. Gas limits are kept as they are.
+func (f FeeRate) scale(factor Amount, mode RoundingMode) (FeeRateDto, error) {
+	var err error
+	scale := func(value string, places int32) string {
+		if value == "" || err != nil {
+			return value
+		}
+		var amount Amount
+		if amount, err = ParseAmount(value); err != nil {
+			return value
+		}
+		if places < amount.Scale() {
+			places = amount.Scale()
+		}
+		scaled := amount.Mul(factor).Round(places, mode)
+		// Drop the trailing zeros past the scale of the rate, 4.400 is sent as 4.4
+		for scaled.Scale() > amount.Scale() && scaled.Round(scaled.Scale()-1, RoundDown).Cmp(scaled) == 0 {
+			scaled = scaled.Round(scaled.Scale()-1, RoundDown)
+		}
+		return scaled.String()
+	}
+	var dto FeeRateDto
+	switch {
+	case f.MaxFee != "":
+		dto = FeeRateDto{MaxFee: scale(f.MaxFee, feeRateScale), MaxPriorityFee: scale(f.MaxPriorityFee, feeRateScale), GasLimit: f.GasLimit}
+	case f.GasFeeCap != "":
+		dto = FeeRateDto{GasFeeCap: scale(f.GasFeeCap, 0), GasPremium: scale(f.GasPremium, 0), GasLimit: f.GasLimit}
+	case f.GasBudget != "":
+		dto = FeeRateDto{GasBudget: scale(f.GasBudget, 0)}
+	case f.GasUnitPrice != "":
+		dto = FeeRateDto{GasUnitPrice: scale(f.GasUnitPrice, 0), MaxGasAmount: f.MaxGasAmount}
+	default:
+		dto = FeeRateDto{FeeRate: scale(f.FeeRate, feeRateScale), GasLimit: f.GasLimit}
+	}
+	return dto, err
+}
+
+// PrimaryRate returns the rate a fee rate cap applies to, it depends on the chain family.
+func (d FeeRateDto) PrimaryRate() string {
+	return d.feeRate().primaryRate()
+}
+
+// Raise returns the fee with the rates of its chain family raised by percent,
+// rounded up like the rates of an estimate, for a replacement that pays enough
+// more than the original. Gas limits are kept as they are.
+func (d FeeRateDto) Raise(percent Amount) (FeeRateDto, error) {
+	hundred := NewAmount(100, 0)
+	return d.feeRate().scale(hundred.Add(percent).Quo(hundred, percent.Scale()+2, RoundDown), RoundUp)
+}
+
+// feeRate converts the fee to a FeeRate to scale it.
+func (d FeeRateDto) feeRate() FeeRate {
+	return FeeRate{
+		FeeRate:        d.FeeRate,
+		GasLimit:       d.GasLimit,
+		MaxPriorityFee: d.MaxPriorityFee,
+		MaxFee:         d.MaxFee,
+		GasPremium:     d.GasPremium,
+		GasFeeCap:      d.GasFeeCap,
+		GasBudget:      d.GasBudget,
+		GasUnitPrice:   d.GasUnitPrice,
+		MaxGasAmount:   d.MaxGasAmount,
+	}
+}
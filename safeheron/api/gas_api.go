@@ -1,6 +1,8 @@
 package api
 
 import (
+	"context"
+
 	"github.com/Safeheron/safeheron-api-sdk-go/safeheron"
 )
 
@@ -24,7 +26,11 @@ type Configuration struct {
 }
 
 func (e *GasApi) GasStatus(r *GasStatusResponse) error {
-	return e.Client.SendRequest(nil, r, "/v1/gas/status")
+	return e.GasStatusCtx(context.Background(), r)
+}
+
+func (e *GasApi) GasStatusCtx(ctx context.Context, r *GasStatusResponse) error {
+	return e.Client.SendRequestCtx(ctx, nil, r, "/v1/gas/status")
 }
 
 type GasTransactionsGetByTxKeyRequest struct {
@@ -48,5 +54,9 @@ type Detail struct {
 }
 
 func (e *GasApi) GasTransactionsGetByTxKey(d GasTransactionsGetByTxKeyRequest, r *GasTransactionsGetByTxKeyResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/gas/transactions/getByTxKey")
+	return e.GasTransactionsGetByTxKeyCtx(context.Background(), d, r)
+}
+
+func (e *GasApi) GasTransactionsGetByTxKeyCtx(ctx context.Context, d GasTransactionsGetByTxKeyRequest, r *GasTransactionsGetByTxKeyResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/gas/transactions/getByTxKey")
 }
@@ -1,6 +1,8 @@
 package api
 
 import (
+	"context"
+
 	"github.com/Safeheron/safeheron-api-sdk-go/safeheron"
 )
 
@@ -23,7 +25,11 @@ type CreateMpcSignResponse struct {
 }
 
 func (e *MpcSignApi) CreateMpcSign(d CreateMpcSignRequest, r *CreateMpcSignResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/transactions/mpcsign/create")
+	return e.CreateMpcSignCtx(context.Background(), d, r)
+}
+
+func (e *MpcSignApi) CreateMpcSignCtx(ctx context.Context, d CreateMpcSignRequest, r *CreateMpcSignResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/transactions/mpcsign/create")
 }
 
 type OneMPCSignTransactionsRequest struct {
@@ -32,19 +38,19 @@ type OneMPCSignTransactionsRequest struct {
 }
 
 type MPCSignTransactionsResponse struct {
-	TxKey                string `json:"txKey,omitempty"`
-	TransactionStatus    string `json:"transactionStatus,omitempty"`
-	TransactionSubStatus string `json:"transactionSubStatus,omitempty"`
-	CreateTime           int64  `json:"createTime,omitempty"`
-	SourceAccountKey     string `json:"sourceAccountKey,omitempty"`
-	AuditUserKey         string `json:"auditUserKey,omitempty"`
-	CreatedByUserKey     string `json:"createdByUserKey,omitempty"`
-	CustomerRefId        string `json:"customerRefId,omitempty"`
-	CustomerExt1         string `json:"customerExt1,omitempty"`
-	CustomerExt2         string `json:"customerExt2,omitempty"`
-	SignAlg              string `json:"signAlg,omitempty"`
-	AuditUserName        string `json:"auditUserName,omitempty"`
-	CreatedByUserName    string `json:"createdByUserName,omitempty"`
+	TxKey                string               `json:"txKey,omitempty"`
+	TransactionStatus    TransactionStatus    `json:"transactionStatus,omitempty"`
+	TransactionSubStatus TransactionSubStatus `json:"transactionSubStatus,omitempty"`
+	CreateTime           int64                `json:"createTime,omitempty"`
+	SourceAccountKey     string               `json:"sourceAccountKey,omitempty"`
+	AuditUserKey         string               `json:"auditUserKey,omitempty"`
+	CreatedByUserKey     string               `json:"createdByUserKey,omitempty"`
+	CustomerRefId        string               `json:"customerRefId,omitempty"`
+	CustomerExt1         string               `json:"customerExt1,omitempty"`
+	CustomerExt2         string               `json:"customerExt2,omitempty"`
+	SignAlg              string               `json:"signAlg,omitempty"`
+	AuditUserName        string               `json:"auditUserName,omitempty"`
+	CreatedByUserName    string               `json:"createdByUserName,omitempty"`
 	DataList             []struct {
 		Data string `json:"data,omitempty"`
 		Sig  string `json:"sig,omitempty"`
@@ -53,7 +59,11 @@ type MPCSignTransactionsResponse struct {
 }
 
 func (e *MpcSignApi) OneMPCSignTransactions(d OneMPCSignTransactionsRequest, r *MPCSignTransactionsResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/transactions/mpcsign/one")
+	return e.OneMPCSignTransactionsCtx(context.Background(), d, r)
+}
+
+func (e *MpcSignApi) OneMPCSignTransactionsCtx(ctx context.Context, d OneMPCSignTransactionsRequest, r *MPCSignTransactionsResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/transactions/mpcsign/one")
 }
 
 type ListMPCSignTransactionsRequest struct {
@@ -65,5 +75,9 @@ type ListMPCSignTransactionsRequest struct {
 }
 
 func (e *MpcSignApi) ListMPCSignTransactions(d ListMPCSignTransactionsRequest, r *[]MPCSignTransactionsResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/transactions/mpcsign/list")
+	return e.ListMPCSignTransactionsCtx(context.Background(), d, r)
+}
+
+func (e *MpcSignApi) ListMPCSignTransactionsCtx(ctx context.Context, d ListMPCSignTransactionsRequest, r *[]MPCSignTransactionsResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/transactions/mpcsign/list")
 }
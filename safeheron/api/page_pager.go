@@ -0,0 +1,220 @@
+package api
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrListChanged is returned by a PagePager with FailOnChange set when items were
+// added or removed while the list was being paged.
+var ErrListChanged = errors.New("list changed while paging")
+
+// PagePager walks an endpoint paged with pageNumber/pageSize. The page count is
+// computed from totalElements of the first page, further pages can be fetched
+// concurrently and are still returned in order.
+//
+// Items inserted or removed during the scan shift the remaining items between
+// pages. The pager skips items it has already returned and reports the change
+// through Changed, or fails with ErrListChanged when FailOnChange is set.
+//
+//	pager := accountApi.IterateAccounts(ctx, api.ListAccountRequest{PageSize: 100})
+//	pager.Concurrency = 4
+//	accounts, err := pager.Collect()
+type PagePager[T any] struct {
+	// Concurrency is the maximum number of pages fetched at the same time, 1 when not set.
+	// It must be set before the first call to Next.
+	Concurrency int
+	// FailOnChange stops the iteration with ErrListChanged as soon as a change is detected.
+	FailOnChange bool
+
+	ctx      context.Context
+	cancel   context.CancelFunc
+	fetch    func(ctx context.Context, pageNumber int, pageSize int) pageResult[T]
+	key      func(T) string
+	pageSize int
+
+	nextPage      int
+	pageCount     int
+	totalElements int64
+	inflight      []chan pageResult[T]
+	seen          map[string]struct{}
+	changed       bool
+	page          []T
+	index         int
+	item          T
+	err           error
+}
+
+type pageResult[T any] struct {
+	items         []T
+	totalElements int64
+	pageSize      int
+	err           error
+}
+
+func newPagePager[T any](ctx context.Context, pageNumber int, pageSize int, key func(T) string, fetch func(ctx context.Context, pageNumber int, pageSize int) pageResult[T]) *PagePager[T] {
+	if pageNumber <= 0 {
+		pageNumber = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	return &PagePager[T]{
+		ctx:           ctx,
+		cancel:        cancel,
+		fetch:         fetch,
+		key:           key,
+		pageSize:      pageSize,
+		nextPage:      pageNumber,
+		pageCount:     pageNumber,
+		totalElements: -1,
+		seen:          map[string]struct{}{},
+	}
+}
+
+// Next advances to the next item, it returns false when there are no more items or an error occurred.
+func (p *PagePager[T]) Next() bool {
+	for {
+		for p.index < len(p.page) {
+			item := p.page[p.index]
+			p.index++
+			if _, ok := p.seen[p.key(item)]; ok {
+				// Shifted to a later page by an insertion, already returned
+				if p.markChanged() {
+					return false
+				}
+				continue
+			}
+			p.seen[p.key(item)] = struct{}{}
+			p.item = item
+			return true
+		}
+		if p.err != nil {
+			return false
+		}
+		p.fill()
+		if len(p.inflight) == 0 {
+			return false
+		}
+		result := <-p.inflight[0]
+		p.inflight = p.inflight[1:]
+		if result.err != nil {
+			p.err = result.err
+			p.cancel()
+			return false
+		}
+		if p.advance(result) {
+			return false
+		}
+	}
+}
+
+// fill starts fetching pages until Concurrency pages are in flight. Until the
+// first page arrives the page count is unknown and only that page is fetched.
+func (p *PagePager[T]) fill() {
+	concurrency := p.Concurrency
+	if concurrency <= 0 || p.totalElements < 0 {
+		concurrency = 1
+	}
+	for len(p.inflight) < concurrency && p.nextPage <= p.pageCount {
+		result := make(chan pageResult[T], 1)
+		go func(pageNumber int, pageSize int) {
+			result <- p.fetch(p.ctx, pageNumber, pageSize)
+		}(p.nextPage, p.pageSize)
+		p.inflight = append(p.inflight, result)
+		p.nextPage++
+	}
+}
+
+// advance makes the result the current page and updates the page count, it
+// returns true when the iteration has to stop.
+func (p *PagePager[T]) advance(result pageResult[T]) bool {
+	p.page, p.index = result.items, 0
+	if p.totalElements < 0 {
+		if p.pageSize <= 0 {
+			p.pageSize = result.pageSize
+		}
+		if p.pageSize <= 0 {
+			p.pageSize = len(result.items)
+		}
+	} else if result.totalElements != p.totalElements && p.markChanged() {
+		return true
+	}
+	p.totalElements = result.totalElements
+	if p.pageSize > 0 {
+		if pageCount := int((result.totalElements + int64(p.pageSize) - 1) / int64(p.pageSize)); pageCount > p.pageCount {
+			p.pageCount = pageCount
+		}
+	}
+	return false
+}
+
+// markChanged records a change of the list, it returns true when the iteration has to stop.
+func (p *PagePager[T]) markChanged() bool {
+	p.changed = true
+	if p.FailOnChange {
+		p.err = ErrListChanged
+		p.page = nil
+		p.cancel()
+		return true
+	}
+	return false
+}
+
+// Item returns the current item.
+func (p *PagePager[T]) Item() T {
+	return p.item
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (p *PagePager[T]) Err() error {
+	return p.err
+}
+
+// Changed reports whether items were added or removed since the scan started.
+// Items removed during the scan may have been missed, scan again to be sure.
+func (p *PagePager[T]) Changed() bool {
+	return p.changed
+}
+
+// TotalElements returns totalElements of the last page received, -1 before the first page.
+func (p *PagePager[T]) TotalElements() int64 {
+	return p.totalElements
+}
+
+// Close stops the pending page fetches. The pager must not be used afterwards.
+func (p *PagePager[T]) Close() {
+	p.cancel()
+}
+
+// Collect consumes the pager and returns all remaining items.
+func (p *PagePager[T]) Collect() ([]T, error) {
+	defer p.Close()
+	var items []T
+	for p.Next() {
+		items = append(items, p.Item())
+	}
+	return items, p.Err()
+}
+
+// IterateAccounts pages through ListAccounts starting at d.PageNumber.
+func (e *AccountApi) IterateAccounts(ctx context.Context, d ListAccountRequest) *PagePager[AccountResponse] {
+	return newPagePager(ctx, d.PageNumber, d.PageSize, func(account AccountResponse) string { return account.AccountKey },
+		func(ctx context.Context, pageNumber int, pageSize int) pageResult[AccountResponse] {
+			req := d
+			req.PageNumber, req.PageSize = pageNumber, pageSize
+			var r ListAccountResponse
+			err := e.ListAccountsCtx(ctx, req, &r)
+			return pageResult[AccountResponse]{items: r.Content, totalElements: r.TotalElements, pageSize: int(r.PageSize), err: err}
+		})
+}
+
+// IterateAccountCoinAddress pages through ListAccountCoinAddress starting at d.PageNumber.
+func (e *AccountApi) IterateAccountCoinAddress(ctx context.Context, d ListAccountCoinAddressRequest) *PagePager[AccountCoinAddressGroup] {
+	return newPagePager(ctx, d.PageNumber, d.PageSize, func(group AccountCoinAddressGroup) string { return group.AddressGroupKey },
+		func(ctx context.Context, pageNumber int, pageSize int) pageResult[AccountCoinAddressGroup] {
+			req := d
+			req.PageNumber, req.PageSize = pageNumber, pageSize
+			var r AccountCoinAddressResponse
+			err := e.ListAccountCoinAddressCtx(ctx, req, &r)
+			return pageResult[AccountCoinAddressGroup]{items: r.Content, totalElements: r.TotalElements, pageSize: int(r.PageSize), err: err}
+		})
+}
@@ -1,6 +1,8 @@
 package api
 
 import (
+	"context"
+
 	"github.com/Safeheron/safeheron-api-sdk-go/safeheron"
 )
 
@@ -18,7 +20,11 @@ type AmlCheckerRequestResponse struct {
 }
 
 func (e *ToolsApi) AmlCheckerRequest(d AmlCheckerRequestRequest, r *AmlCheckerRequestResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/tools/aml-checker/request")
+	return e.AmlCheckerRequestCtx(context.Background(), d, r)
+}
+
+func (e *ToolsApi) AmlCheckerRequestCtx(ctx context.Context, d AmlCheckerRequestRequest, r *AmlCheckerRequestResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/tools/aml-checker/request")
 }
 
 type AmlCheckerRetrievesRequest struct {
@@ -53,5 +59,9 @@ type RiskDetail struct {
 }
 
 func (e *ToolsApi) AmlCheckerRetrieves(d AmlCheckerRetrievesRequest, r *AmlCheckerRetrievesResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/tools/aml-checker/retrieves")
+	return e.AmlCheckerRetrievesCtx(context.Background(), d, r)
+}
+
+func (e *ToolsApi) AmlCheckerRetrievesCtx(ctx context.Context, d AmlCheckerRetrievesRequest, r *AmlCheckerRetrievesResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/tools/aml-checker/retrieves")
 }
@@ -1,11 +1,19 @@
 package api
 
 import (
+	"context"
+
 	"github.com/Safeheron/safeheron-api-sdk-go/safeheron"
 )
 
 type TransactionApi struct {
 	Client safeheron.Client
+	// Coins has the metadata of the coins, for the helpers built on TransactionApi
+	// and for ValidateCreate.
+	Coins *CoinRegistry
+	// ValidateCreate validates create requests with the metadata of their coin
+	// from Coins before they are sent, see CreateTransactionsRequest.Validate.
+	ValidateCreate bool
 }
 
 type TransactionsResponse struct {
@@ -26,8 +34,8 @@ type TransactionsResponse struct {
 	DestinationAddressList     []DestinationAddress `json:"destinationAddressList"`
 	DestinationTag             string               `json:"destinationTag"`
 	TransactionType            string               `json:"transactionType"`
-	TransactionStatus          string               `json:"transactionStatus"`
-	TransactionSubStatus       string               `json:"transactionSubStatus"`
+	TransactionStatus          TransactionStatus    `json:"transactionStatus"`
+	TransactionSubStatus       TransactionSubStatus `json:"transactionSubStatus"`
 	CreateTime                 int64                `json:"createTime"`
 	Note                       string               `json:"note"`
 	AuditUserKey               string               `json:"auditUserKey"`
@@ -87,7 +95,11 @@ type TransactionsResponseV1 struct {
 }
 
 func (e *TransactionApi) ListTransactionsV1(d ListTransactionsV1Request, r *TransactionsResponseV1) error {
-	return e.Client.SendRequest(d, r, "/v1/transactions/list")
+	return e.ListTransactionsV1Ctx(context.Background(), d, r)
+}
+
+func (e *TransactionApi) ListTransactionsV1Ctx(ctx context.Context, d ListTransactionsV1Request, r *TransactionsResponseV1) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/transactions/list")
 }
 
 type ListTransactionsV2Request struct {
@@ -118,9 +130,16 @@ type ListTransactionsV2Request struct {
 type TransactionsResponseV2 []TransactionsResponse
 
 func (e *TransactionApi) ListTransactionsV2(d ListTransactionsV2Request, r *TransactionsResponseV2) error {
-	return e.Client.SendRequest(d, r, "/v2/transactions/list")
+	return e.ListTransactionsV2Ctx(context.Background(), d, r)
 }
 
+func (e *TransactionApi) ListTransactionsV2Ctx(ctx context.Context, d ListTransactionsV2Request, r *TransactionsResponseV2) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v2/transactions/list")
+}
+
+// MaxCustomerRefIdLength is the longest customerRefId Safeheron accepts.
+const MaxCustomerRefIdLength = 100
+
 type CreateTransactionsRequest struct {
 	CustomerRefId          string     `json:"customerRefId"`
 	CustomerExt1           string     `json:"customerExt1,omitempty"`
@@ -164,17 +183,33 @@ type TxKeyResult struct {
 }
 
 func (e *TransactionApi) CreateTransactions(d CreateTransactionsRequest, r *TxKeyResult) error {
-	return e.Client.SendRequest(d, r, "/v2/transactions/create")
+	return e.CreateTransactionsCtx(context.Background(), d, r)
+}
+
+func (e *TransactionApi) CreateTransactionsCtx(ctx context.Context, d CreateTransactionsRequest, r *TxKeyResult) error {
+	if err := e.validateCreate(ctx, d.CoinKey, d.Validate); err != nil {
+		return err
+	}
+	return e.Client.SendRequestCtx(ctx, d, r, "/v2/transactions/create")
 }
 
 type CreateTransactionV3Response struct {
-	TxKey             string `json:"txKey"`
-	CustomerRefId     string `json:"customerRefId"`
-	IdempotentRequest bool   `json:"idempotentRequest"`
+	TxKey         string `json:"txKey"`
+	CustomerRefId string `json:"customerRefId"`
+	// IdempotentRequest is true when a transaction with the same customerRefId already
+	// existed, e.g. after a retry, and TxKey refers to that transaction.
+	IdempotentRequest bool `json:"idempotentRequest"`
 }
 
 func (e *TransactionApi) CreateTransactionsV3(d CreateTransactionsRequest, r *CreateTransactionV3Response) error {
-	return e.Client.SendRequest(d, r, "/v3/transactions/create")
+	return e.CreateTransactionsV3Ctx(context.Background(), d, r)
+}
+
+func (e *TransactionApi) CreateTransactionsV3Ctx(ctx context.Context, d CreateTransactionsRequest, r *CreateTransactionV3Response) error {
+	if err := e.validateCreate(ctx, d.CoinKey, d.Validate); err != nil {
+		return err
+	}
+	return e.Client.SendRequestCtx(ctx, d, r, "/v3/transactions/create")
 }
 
 type CreateTransactionsUTXOMultiDestRequest struct {
@@ -214,7 +249,14 @@ type GasFee struct {
 }
 
 func (e *TransactionApi) CreateTransactionsUTXOMultiDest(d CreateTransactionsUTXOMultiDestRequest, r *TxKeyResult) error {
-	return e.Client.SendRequest(d, r, "/v1/transactions/utxo/multidest/create")
+	return e.CreateTransactionsUTXOMultiDestCtx(context.Background(), d, r)
+}
+
+func (e *TransactionApi) CreateTransactionsUTXOMultiDestCtx(ctx context.Context, d CreateTransactionsUTXOMultiDestRequest, r *TxKeyResult) error {
+	if err := e.validateCreate(ctx, d.CoinKey, d.Validate); err != nil {
+		return err
+	}
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/transactions/utxo/multidest/create")
 }
 
 type RecreateTransactionRequest struct {
@@ -226,7 +268,11 @@ type RecreateTransactionRequest struct {
 }
 
 func (e *TransactionApi) RecreateTransactions(d RecreateTransactionRequest, r *TxKeyResult) error {
-	return e.Client.SendRequest(d, r, "/v2/transactions/recreate")
+	return e.RecreateTransactionsCtx(context.Background(), d, r)
+}
+
+func (e *TransactionApi) RecreateTransactionsCtx(ctx context.Context, d RecreateTransactionRequest, r *TxKeyResult) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v2/transactions/recreate")
 }
 
 type OneTransactionsRequest struct {
@@ -252,8 +298,8 @@ type OneTransactionsResponse struct {
 	DestinationAddressList     []DestinationAddress   `json:"destinationAddressList"`
 	DestinationTag             string                 `json:"destinationTag"`
 	TransactionType            string                 `json:"transactionType"`
-	TransactionStatus          string                 `json:"transactionStatus"`
-	TransactionSubStatus       string                 `json:"transactionSubStatus"`
+	TransactionStatus          TransactionStatus      `json:"transactionStatus"`
+	TransactionSubStatus       TransactionSubStatus   `json:"transactionSubStatus"`
 	CreateTime                 int64                  `json:"createTime"`
 	Note                       string                 `json:"note"`
 	AuditUserKey               string                 `json:"auditUserKey"`
@@ -292,7 +338,11 @@ type Aml struct {
 }
 
 func (e *TransactionApi) OneTransactions(d OneTransactionsRequest, r *OneTransactionsResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/transactions/one")
+	return e.OneTransactionsCtx(context.Background(), d, r)
+}
+
+func (e *TransactionApi) OneTransactionsCtx(ctx context.Context, d OneTransactionsRequest, r *OneTransactionsResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/transactions/one")
 }
 
 type ApprovalDetailTransactionsRequest struct {
@@ -344,7 +394,11 @@ type Member struct {
 }
 
 func (e *TransactionApi) ApprovalDetailTransactions(d ApprovalDetailTransactionsRequest, r *ApprovalDetailTransactionsResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/transactions/approvalDetail")
+	return e.ApprovalDetailTransactionsCtx(context.Background(), d, r)
+}
+
+func (e *TransactionApi) ApprovalDetailTransactionsCtx(ctx context.Context, d ApprovalDetailTransactionsRequest, r *ApprovalDetailTransactionsResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/transactions/approvalDetail")
 }
 
 type TransactionsFeeRateRequest struct {
@@ -365,7 +419,7 @@ type FeeRate struct {
 	MaxPriorityFee string `json:"maxPriorityFee"`
 	MaxFee         string `json:"maxFee"`
 	BytesSize      string `json:"bytesSize"`
-	GasPremium     string `json:"gasPremium "`
+	GasPremium     string `json:"gasPremium"`
 	GasFeeCap      string `json:"gasFeeCap"`
 	GasBudget      string `json:"gasBudget"`
 	GasUnitPrice   string `json:"gasUnitPrice"`
@@ -381,7 +435,11 @@ type TransactionsFeeRateResponse struct {
 }
 
 func (e *TransactionApi) TransactionFeeRate(d TransactionsFeeRateRequest, r *TransactionsFeeRateResponse) error {
-	return e.Client.SendRequest(d, r, "/v2/transactions/getFeeRate")
+	return e.TransactionFeeRateCtx(context.Background(), d, r)
+}
+
+func (e *TransactionApi) TransactionFeeRateCtx(ctx context.Context, d TransactionsFeeRateRequest, r *TransactionsFeeRateResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v2/transactions/getFeeRate")
 }
 
 type CancelTransactionRequest struct {
@@ -390,7 +448,11 @@ type CancelTransactionRequest struct {
 }
 
 func (e *TransactionApi) CancelTransactions(d CancelTransactionRequest, r *ResultResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/transactions/cancel")
+	return e.CancelTransactionsCtx(context.Background(), d, r)
+}
+
+func (e *TransactionApi) CancelTransactionsCtx(ctx context.Context, d CancelTransactionRequest, r *ResultResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/transactions/cancel")
 }
 
 type CollectionTransactionsUTXORequest struct {
@@ -418,5 +480,9 @@ type CollectionTransactionsUTXOResponse struct {
 }
 
 func (e *TransactionApi) CollectionTransactionsUTXO(d CollectionTransactionsUTXORequest, r *CollectionTransactionsUTXOResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/transactions/utxo/collection")
+	return e.CollectionTransactionsUTXOCtx(context.Background(), d, r)
+}
+
+func (e *TransactionApi) CollectionTransactionsUTXOCtx(ctx context.Context, d CollectionTransactionsUTXORequest, r *CollectionTransactionsUTXOResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/transactions/utxo/collection")
 }
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"fmt"
+)
+
+// TransactionStatus is the status of a transaction, an MPC sign transaction or a web3 sign transaction.
+type TransactionStatus string
+
+const (
+	TransactionStatusSubmitted    TransactionStatus = "SUBMITTED"
+	TransactionStatusSigning      TransactionStatus = "SIGNING"
+	TransactionStatusBroadcasting TransactionStatus = "BROADCASTING"
+	TransactionStatusConfirming   TransactionStatus = "CONFIRMING"
+	TransactionStatusCompleted    TransactionStatus = "COMPLETED"
+	// TransactionStatusSignCompleted ends web3 sign transactions that are only signed, not broadcast.
+	TransactionStatusSignCompleted TransactionStatus = "SIGN_COMPLETED"
+	TransactionStatusFailed        TransactionStatus = "FAILED"
+	TransactionStatusRejected      TransactionStatus = "REJECTED"
+	TransactionStatusCancelled     TransactionStatus = "CANCELLED"
+)
+
+// TransactionSubStatus details a TransactionStatus. Sub statuses not listed here
+// are kept as received.
+type TransactionSubStatus string
+
+const (
+	TransactionSubStatusAuditPassed     TransactionSubStatus = "AUDIT_PASSED"
+	TransactionSubStatusSigning         TransactionSubStatus = "SIGNING"
+	TransactionSubStatusConfirming      TransactionSubStatus = "CONFIRMING"
+	TransactionSubStatusConfirmed       TransactionSubStatus = "CONFIRMED"
+	TransactionSubStatusAuditRejected   TransactionSubStatus = "AUDIT_REJECTED"
+	TransactionSubStatusSignRejected    TransactionSubStatus = "SIGN_REJECTED"
+	TransactionSubStatusSignFailed      TransactionSubStatus = "SIGN_FAILED"
+	TransactionSubStatusBroadcastFailed TransactionSubStatus = "BROADCAST_FAILED"
+	TransactionSubStatusFailedOnChain   TransactionSubStatus = "FAILED_ON_CHAIN"
+	TransactionSubStatusCancelledByApi  TransactionSubStatus = "CANCELLED_BY_API"
+	TransactionSubStatusCancelledByUser TransactionSubStatus = "CANCELLED_BY_USER"
+)
+
+// IsTerminal reports whether the status is final.
+func (s TransactionStatus) IsTerminal() bool {
+	switch s {
+	case TransactionStatusCompleted, TransactionStatusSignCompleted,
+		TransactionStatusFailed, TransactionStatusRejected, TransactionStatusCancelled:
+		return true
+	}
+	return false
+}
+
+// IsSuccess reports whether the status is a final success.
+func (s TransactionStatus) IsSuccess() bool {
+	return s == TransactionStatusCompleted || s == TransactionStatusSignCompleted
+}
+
+// IsFinal reports whether a transaction in status s with subStatus will not
+// change anymore. COMPLETED is only final once CONFIRMED, FAILED, REJECTED,
+// CANCELLED and SIGN_COMPLETED are final whatever their sub status.
+func (s TransactionStatus) IsFinal(subStatus TransactionSubStatus) bool {
+	if s == TransactionStatusCompleted {
+		return subStatus == TransactionSubStatusConfirmed
+	}
+	return s.IsTerminal()
+}
+
+// transactionTransitions lists the statuses reachable from each non-terminal status.
+// Statuses may be skipped, a webhook for an intermediate status can be missed.
+var transactionTransitions = map[TransactionStatus][]TransactionStatus{
+	TransactionStatusSubmitted: {
+		TransactionStatusSigning, TransactionStatusBroadcasting, TransactionStatusConfirming,
+		TransactionStatusCompleted, TransactionStatusSignCompleted,
+		TransactionStatusFailed, TransactionStatusRejected, TransactionStatusCancelled,
+	},
+	TransactionStatusSigning: {
+		TransactionStatusBroadcasting, TransactionStatusConfirming,
+		TransactionStatusCompleted, TransactionStatusSignCompleted,
+		TransactionStatusFailed, TransactionStatusRejected, TransactionStatusCancelled,
+	},
+	TransactionStatusBroadcasting: {TransactionStatusConfirming, TransactionStatusCompleted, TransactionStatusFailed},
+	TransactionStatusConfirming:   {TransactionStatusCompleted, TransactionStatusFailed},
+}
+
+// CanTransitionTo reports whether a transaction in status s can move to next.
+// Staying in the same status, with another sub status, is allowed.
+func (s TransactionStatus) CanTransitionTo(next TransactionStatus) bool {
+	if s == next || s == "" {
+		return true
+	}
+	for _, status := range transactionTransitions[s] {
+		if status == next {
+			return true
+		}
+	}
+	return false
+}
+
+// InvalidTransitionError is returned by ValidateTransition for a transition the
+// transaction lifecycle does not allow, for example COMPLETED to SIGNING.
+type InvalidTransitionError struct {
+	TxKey string
+	From  TransactionStatus
+	To    TransactionStatus
+}
+
+func (e *InvalidTransitionError) Error() string {
+	return fmt.Sprintf("transaction %s can not move from %s to %s", e.TxKey, e.From, e.To)
+}
+
+// ValidateTransition checks a status change of a transaction, typically the status
+// last seen against the one in a new webhook. An empty from accepts any status.
+func ValidateTransition(txKey string, from TransactionStatus, to TransactionStatus) error {
+	if !from.CanTransitionTo(to) {
+		return &InvalidTransitionError{TxKey: txKey, From: from, To: to}
+	}
+	return nil
+}
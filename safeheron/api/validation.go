@@ -0,0 +1,193 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// FieldError is a problem with one field of a request, Field is its JSON name.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// ValidationError lists the problems Validate found in a request.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, fieldError := range e.Errors {
+		messages = append(messages, fieldError.Error())
+	}
+	return "invalid request, " + strings.Join(messages, "; ")
+}
+
+// Field returns the error of a field, if any.
+func (e *ValidationError) Field(field string) (FieldError, bool) {
+	for _, fieldError := range e.Errors {
+		if fieldError.Field == field {
+			return fieldError, true
+		}
+	}
+	return FieldError{}, false
+}
+
+type validator struct {
+	errors []FieldError
+}
+
+func (v *validator) add(field string, format string, args ...any) {
+	v.errors = append(v.errors, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) err() error {
+	if len(v.errors) == 0 {
+		return nil
+	}
+	return &ValidationError{Errors: v.errors}
+}
+
+func (v *validator) required(field string, value string) {
+	if value == "" {
+		v.add(field, "is required")
+	}
+}
+
+// amount checks a transfer amount against the precision and minimum of the coin.
+func (v *validator) amount(field string, value string, coin Coin) {
+	if value == "" {
+		v.add(field, "is required")
+		return
+	}
+	amount, err := ParseAmount(value)
+	if err != nil {
+		v.add(field, "%q is not a decimal number", value)
+		return
+	}
+	if amount.Sign() <= 0 {
+		v.add(field, "must be positive")
+		return
+	}
+	if _, err := coin.ToMinimalUnits(amount); err != nil {
+		v.add(field, "%s has more than %d decimal places", value, coin.CoinDecimal)
+	}
+	if minTransferAmount, err := coin.MinTransferAmountValue(); err == nil && amount.Cmp(minTransferAmount) < 0 {
+		v.add(field, "%s is below the minimum transfer amount %s", value, coin.MinTransferAmount)
+	}
+}
+
+// decimal checks an optional decimal field.
+func (v *validator) decimal(field string, value string) {
+	if value == "" {
+		return
+	}
+	if amount, err := ParseAmount(value); err != nil {
+		v.add(field, "%q is not a decimal number", value)
+	} else if amount.Sign() < 0 {
+		v.add(field, "must not be negative")
+	}
+}
+
+func (v *validator) fee(txFeeLevel string, feeRateDto FeeRateDto, maxTxFeeRate string) {
+	if txFeeLevel != "" && feeRateDto != (FeeRateDto{}) {
+		v.add("feeRateDto", "set either txFeeLevel or feeRateDto")
+	}
+	v.decimal("feeRateDto.feeRate", feeRateDto.FeeRate)
+	v.decimal("maxTxFeeRate", maxTxFeeRate)
+}
+
+// Validate checks the request against the metadata of its coin, as returned by
+// ListCoin or a CoinRegistry, before it is sent. It returns a *ValidationError
+// listing every problem found.
+func (d CreateTransactionsRequest) Validate(coin Coin) error {
+	var v validator
+	v.required("customerRefId", d.CustomerRefId)
+	if d.CoinKey != coin.CoinKey {
+		v.add("coinKey", "%q does not match the coin %q", d.CoinKey, coin.CoinKey)
+	}
+	v.amount("txAmount", d.TxAmount, coin)
+	v.required("sourceAccountKey", d.SourceAccountKey)
+	v.required("sourceAccountType", d.SourceAccountType)
+	v.fee(d.TxFeeLevel, d.FeeRateDto, d.MaxTxFeeRate)
+
+	switch d.DestinationAccountType {
+	case "":
+		v.add("destinationAccountType", "is required")
+	case "VAULT_ACCOUNT", "WHITELISTING_ACCOUNT":
+		v.required("destinationAccountKey", d.DestinationAccountKey)
+		if d.DestinationAddress != "" {
+			v.add("destinationAddress", "must be empty for destinationAccountType %s, set destinationAccountKey", d.DestinationAccountType)
+		}
+	case "ONE_TIME_ADDRESS":
+		v.required("destinationAddress", d.DestinationAddress)
+		if d.DestinationAccountKey != "" {
+			v.add("destinationAccountKey", "must be empty for destinationAccountType ONE_TIME_ADDRESS, set destinationAddress")
+		}
+	}
+
+	// A memo on a coin without memos is left to the API, it may be ignored rather than rejected
+	if coin.RequiresMemo() && d.DestinationAccountType == "ONE_TIME_ADDRESS" && d.Memo == "" && d.DestinationTag == "" {
+		v.add("memo", "is required for %s", coin.CoinKey)
+	}
+
+	if coin.UtxoBased() {
+		if d.Nonce != 0 {
+			v.add("nonce", "is not supported by the UTXO coin %s", coin.CoinKey)
+		}
+	} else if d.IsRbf != nil {
+		v.add("isRbf", "is only supported by UTXO coins, %s is not", coin.CoinKey)
+	}
+	return v.err()
+}
+
+// Validate checks the request against the metadata of its coin, as returned by
+// ListCoin or a CoinRegistry, before it is sent. It returns a *ValidationError
+// listing every problem found.
+func (d CreateTransactionsUTXOMultiDestRequest) Validate(coin Coin) error {
+	var v validator
+	v.required("customerRefId", d.CustomerRefId)
+	if d.CoinKey != coin.CoinKey {
+		v.add("coinKey", "%q does not match the coin %q", d.CoinKey, coin.CoinKey)
+	}
+	if !coin.UtxoBased() {
+		v.add("coinKey", "%s is not a UTXO coin", coin.CoinKey)
+	}
+	v.required("sourceAccountKey", d.SourceAccountKey)
+	v.required("sourceAccountType", d.SourceAccountType)
+	v.fee(d.TxFeeLevel, d.FeeRateDto, d.MaxTxFeeRate)
+	if len(d.DestinationAddressList) == 0 {
+		v.add("destinationAddressList", "is required")
+	}
+	for i, destination := range d.DestinationAddressList {
+		v.required(fmt.Sprintf("destinationAddressList[%d].address", i), destination.Address)
+		v.amount(fmt.Sprintf("destinationAddressList[%d].amount", i), destination.Amount, coin)
+	}
+	return v.err()
+}
+
+// validateCreate validates a create request with the coin from Coins when
+// ValidateCreate is set. A coin missing from the registry is left to the API to reject.
+func (e *TransactionApi) validateCreate(ctx context.Context, coinKey string, validate func(Coin) error) error {
+	if !e.ValidateCreate {
+		return nil
+	}
+	if e.Coins == nil {
+		return errors.New("ValidateCreate requires Coins")
+	}
+	coin, err := e.Coins.CoinCtx(ctx, coinKey)
+	if errors.Is(err, ErrCoinNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return validate(coin)
+}
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron"
+)
+
+// WaitOptions configures how the WaitFor methods poll for the final status.
+type WaitOptions struct {
+	// InitialInterval is the delay after the first poll, 2s when not set.
+	InitialInterval time.Duration
+	// MaxInterval caps the delay between polls, 30s when not set.
+	MaxInterval time.Duration
+	// Multiplier grows the delay after each poll, 1.5 when not set.
+	Multiplier float64
+	// Notifier wakes the waiter up when a webhook reports the awaited transaction,
+	// it then polls immediately instead of waiting for the next interval. One
+	// Notifier is shared by all the waiters, nil polls on the interval only.
+	Notifier *Notifier
+	// Retryable tells the poll errors to retry on the next interval, the wait
+	// stops on the others. safeheron.DefaultRetryable when nil.
+	Retryable func(err error) bool
+}
+
+// Notifier fans the txKeys reported by webhooks out to the waiters of these
+// transactions. The zero value is ready to use.
+type Notifier struct {
+	mu      sync.Mutex
+	waiters map[string]map[chan struct{}]struct{}
+}
+
+// Notify wakes up the waiters of txKey, typically from the TRANSACTION_STATUS_CHANGED
+// webhooks. It never blocks, notifications for transactions nobody waits for are dropped.
+func (n *Notifier) Notify(txKey string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for c := range n.waiters[txKey] {
+		select {
+		case c <- struct{}{}:
+		default:
+			// A notification is already pending, the next poll sees both
+		}
+	}
+}
+
+// subscribe returns the channel notified for txKey and the func removing it.
+func (n *Notifier) subscribe(txKey string) (<-chan struct{}, func()) {
+	c := make(chan struct{}, 1)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.waiters == nil {
+		n.waiters = map[string]map[chan struct{}]struct{}{}
+	}
+	if n.waiters[txKey] == nil {
+		n.waiters[txKey] = map[chan struct{}]struct{}{}
+	}
+	n.waiters[txKey][c] = struct{}{}
+	return c, func() {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		delete(n.waiters[txKey], c)
+		if len(n.waiters[txKey]) == 0 {
+			delete(n.waiters, txKey)
+		}
+	}
+}
+
+// TransactionFailedError is returned by the WaitFor methods when the transaction
+// ended in FAILED, REJECTED or CANCELLED.
+type TransactionFailedError struct {
+	TxKey                string
+	TransactionStatus    TransactionStatus
+	TransactionSubStatus TransactionSubStatus
+}
+
+func (e *TransactionFailedError) Error() string {
+	return fmt.Sprintf("transaction %s ended with status %s, sub status %s", e.TxKey, e.TransactionStatus, e.TransactionSubStatus)
+}
+
+// WaitForTransaction polls OneTransactions until the transaction reaches a final
+// status, see TransactionStatus.IsFinal, and stores the last response in r. It returns a *TransactionFailedError
+// when the transaction did not complete.
+func (e *TransactionApi) WaitForTransaction(ctx context.Context, d OneTransactionsRequest, r *OneTransactionsResponse, opts WaitOptions) error {
+	return waitFor(ctx, opts, d.TxKey, func(ctx context.Context) (string, TransactionStatus, TransactionSubStatus, error) {
+		err := e.OneTransactionsCtx(ctx, d, r)
+		return r.TxKey, r.TransactionStatus, r.TransactionSubStatus, err
+	})
+}
+
+// WaitForMPCSign polls OneMPCSignTransactions until the MPC sign transaction reaches
+// a final status and stores the last response, with the signatures, in r.
+// It returns a *TransactionFailedError when the transaction did not complete.
+func (e *MpcSignApi) WaitForMPCSign(ctx context.Context, d OneMPCSignTransactionsRequest, r *MPCSignTransactionsResponse, opts WaitOptions) error {
+	return waitFor(ctx, opts, d.TxKey, func(ctx context.Context) (string, TransactionStatus, TransactionSubStatus, error) {
+		err := e.OneMPCSignTransactionsCtx(ctx, d, r)
+		return r.TxKey, r.TransactionStatus, r.TransactionSubStatus, err
+	})
+}
+
+// WaitForWeb3Sign polls QueryWeb3Sig until the web3 sign transaction reaches a
+// final status, SIGN_COMPLETED for signatures that are not broadcast, and
+// stores the last response in r. It returns a *TransactionFailedError when the
+// transaction did not complete.
+func (e *Web3Api) WaitForWeb3Sign(ctx context.Context, d Web3SignQueryRequest, r *Web3SignQueryResponse, opts WaitOptions) error {
+	return waitFor(ctx, opts, d.TxKey, func(ctx context.Context) (string, TransactionStatus, TransactionSubStatus, error) {
+		err := e.QueryWeb3SigCtx(ctx, d, r)
+		return r.TxKey, r.TransactionStatus, r.TransactionSubStatus, err
+	})
+}
+
+// waitFor polls until a final status, with backoff between polls. txKey may be
+// empty when looking up by customerRefId, it is then learned from the first poll.
+func waitFor(ctx context.Context, opts WaitOptions, txKey string, poll func(ctx context.Context) (string, TransactionStatus, TransactionSubStatus, error)) error {
+	interval, maxInterval, multiplier := opts.InitialInterval, opts.MaxInterval, opts.Multiplier
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+	if maxInterval <= 0 {
+		maxInterval = 30 * time.Second
+	}
+	if multiplier < 1 {
+		multiplier = 1.5
+	}
+	retryable := opts.Retryable
+	if retryable == nil {
+		retryable = safeheron.DefaultRetryable
+	}
+	// Subscribed before polling, a webhook sent between a poll and the wait is not lost
+	var notified <-chan struct{}
+	subscribed, unsubscribe := "", func() {}
+	defer func() { unsubscribe() }()
+	subscribe := func() {
+		if opts.Notifier != nil && txKey != "" && txKey != subscribed {
+			unsubscribe()
+			notified, unsubscribe = opts.Notifier.subscribe(txKey)
+			subscribed = txKey
+		}
+	}
+	subscribe()
+	for {
+		key, status, subStatus, err := poll(ctx)
+		if err != nil {
+			if ctx.Err() != nil || !retryable(err) {
+				return err
+			}
+		} else {
+			if key != "" {
+				txKey = key
+			}
+			if status.IsFinal(subStatus) {
+				if status.IsSuccess() {
+					return nil
+				}
+				return &TransactionFailedError{TxKey: txKey, TransactionStatus: status, TransactionSubStatus: subStatus}
+			}
+		}
+		subscribe()
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		case <-notified:
+			timer.Stop()
+		}
+		if interval = time.Duration(float64(interval) * multiplier); interval > maxInterval {
+			interval = maxInterval
+		}
+	}
+}
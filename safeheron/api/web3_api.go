@@ -1,6 +1,8 @@
 package api
 
 import (
+	"context"
+
 	"github.com/Safeheron/safeheron-api-sdk-go/safeheron"
 )
 
@@ -31,7 +33,11 @@ type CreateWeb3AccountResponse struct {
 }
 
 func (e *Web3Api) CreateWeb3Account(d CreateWeb3AccountRequest, r *CreateWeb3AccountResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/web3/account/create")
+	return e.CreateWeb3AccountCtx(context.Background(), d, r)
+}
+
+func (e *Web3Api) CreateWeb3AccountCtx(ctx context.Context, d CreateWeb3AccountRequest, r *CreateWeb3AccountResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/web3/account/create")
 }
 
 type BatchCreateWeb3AccountRequest struct {
@@ -54,7 +60,11 @@ type BatchCreateWeb3AccountResponse []struct {
 }
 
 func (e *Web3Api) BatchCreateWeb3Account(d BatchCreateWeb3AccountRequest, r *BatchCreateWeb3AccountResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/web3/batch/account/create")
+	return e.BatchCreateWeb3AccountCtx(context.Background(), d, r)
+}
+
+func (e *Web3Api) BatchCreateWeb3AccountCtx(ctx context.Context, d BatchCreateWeb3AccountRequest, r *BatchCreateWeb3AccountResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/web3/batch/account/create")
 }
 
 type ListWeb3AccountRequest struct {
@@ -66,7 +76,11 @@ type ListWeb3AccountRequest struct {
 }
 
 func (e *Web3Api) ListWeb3Accounts(d ListWeb3AccountRequest, r *[]CreateWeb3AccountResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/web3/account/list")
+	return e.ListWeb3AccountsCtx(context.Background(), d, r)
+}
+
+func (e *Web3Api) ListWeb3AccountsCtx(ctx context.Context, d ListWeb3AccountRequest, r *[]CreateWeb3AccountResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/web3/account/list")
 }
 
 type OneWeb3AccountRequest struct {
@@ -75,7 +89,11 @@ type OneWeb3AccountRequest struct {
 }
 
 func (e *Web3Api) OneWeb3Account(d OneWeb3AccountRequest, r *CreateWeb3AccountResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/web3/account/one")
+	return e.OneWeb3AccountCtx(context.Background(), d, r)
+}
+
+func (e *Web3Api) OneWeb3AccountCtx(ctx context.Context, d OneWeb3AccountRequest, r *CreateWeb3AccountResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/web3/account/one")
 }
 
 type EthSignRequest struct {
@@ -92,7 +110,11 @@ type EthSignRequest struct {
 }
 
 func (e *Web3Api) EthSign(d EthSignRequest, r *TxKeyResult) error {
-	return e.Client.SendRequest(d, r, "/v1/web3/sign/ethSign")
+	return e.EthSignCtx(context.Background(), d, r)
+}
+
+func (e *Web3Api) EthSignCtx(ctx context.Context, d EthSignRequest, r *TxKeyResult) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/web3/sign/ethSign")
 }
 
 type PersonalSignRequest struct {
@@ -109,7 +131,11 @@ type PersonalSignRequest struct {
 }
 
 func (e *Web3Api) PersonalSign(d PersonalSignRequest, r *TxKeyResult) error {
-	return e.Client.SendRequest(d, r, "/v1/web3/sign/personalSign")
+	return e.PersonalSignCtx(context.Background(), d, r)
+}
+
+func (e *Web3Api) PersonalSignCtx(ctx context.Context, d PersonalSignRequest, r *TxKeyResult) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/web3/sign/personalSign")
 }
 
 type EthSignTypedDataRequest struct {
@@ -127,7 +153,11 @@ type EthSignTypedDataRequest struct {
 }
 
 func (e *Web3Api) EthSignTypedData(d EthSignTypedDataRequest, r *TxKeyResult) error {
-	return e.Client.SendRequest(d, r, "/v1/web3/sign/ethSignTypedData")
+	return e.EthSignTypedDataCtx(context.Background(), d, r)
+}
+
+func (e *Web3Api) EthSignTypedDataCtx(ctx context.Context, d EthSignTypedDataRequest, r *TxKeyResult) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/web3/sign/ethSignTypedData")
 }
 
 type EthSignTransactionRequest struct {
@@ -151,7 +181,11 @@ type EthSignTransactionRequest struct {
 }
 
 func (e *Web3Api) EthSignTransaction(d EthSignTransactionRequest, r *TxKeyResult) error {
-	return e.Client.SendRequest(d, r, "/v1/web3/sign/ethSignTransaction")
+	return e.EthSignTransactionCtx(context.Background(), d, r)
+}
+
+func (e *Web3Api) EthSignTransactionCtx(ctx context.Context, d EthSignTransactionRequest, r *TxKeyResult) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/web3/sign/ethSignTransaction")
 }
 
 type CancelWeb3SignRequest struct {
@@ -159,7 +193,11 @@ type CancelWeb3SignRequest struct {
 }
 
 func (e *Web3Api) CancelWeb3Sign(d CancelWeb3SignRequest, r *ResultResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/web3/sign/cancel")
+	return e.CancelWeb3SignCtx(context.Background(), d, r)
+}
+
+func (e *Web3Api) CancelWeb3SignCtx(ctx context.Context, d CancelWeb3SignRequest, r *ResultResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/web3/sign/cancel")
 }
 
 type Web3SignQueryRequest struct {
@@ -168,25 +206,25 @@ type Web3SignQueryRequest struct {
 }
 
 type Web3SignQueryResponse struct {
-	TxKey                string `json:"txKey"`
-	AccountKey           string `json:"accountKey,omitempty"`
-	SourceAddress        string `json:"sourceAddress,omitempty"`
-	TransactionStatus    string `json:"transactionStatus,omitempty"`
-	TransactionSubStatus string `json:"transactionSubStatus,omitempty"`
-	CreatedByUserKey     string `json:"createdByUserKey,omitempty"`
-	CreatedByUserName    string `json:"createdByUserName,omitempty"`
-	CreateTime           int64  `json:"createTime,omitempty"`
-	AuditUserKey         string `json:"auditUserKey,omitempty"`
-	AuditUserName        string `json:"auditUserName,omitempty"`
-	CustomerRefId        string `json:"customerRefId"`
-	Note                 string `json:"note,omitempty"`
-	CustomerExt1         string `json:"customerExt1,omitempty"`
-	CustomerExt2         string `json:"customerExt2,omitempty"`
-	Balance              string `json:"balance,omitempty"`
-	TokenBalance         string `json:"tokenBalance,omitempty"`
-	Symbol               string `json:"symbol,omitempty"`
-	TokenSymbol          string `json:"tokenSymbol,omitempty"`
-	SubjectType          string `json:"subjectType,omitempty"`
+	TxKey                string               `json:"txKey"`
+	AccountKey           string               `json:"accountKey,omitempty"`
+	SourceAddress        string               `json:"sourceAddress,omitempty"`
+	TransactionStatus    TransactionStatus    `json:"transactionStatus,omitempty"`
+	TransactionSubStatus TransactionSubStatus `json:"transactionSubStatus,omitempty"`
+	CreatedByUserKey     string               `json:"createdByUserKey,omitempty"`
+	CreatedByUserName    string               `json:"createdByUserName,omitempty"`
+	CreateTime           int64                `json:"createTime,omitempty"`
+	AuditUserKey         string               `json:"auditUserKey,omitempty"`
+	AuditUserName        string               `json:"auditUserName,omitempty"`
+	CustomerRefId        string               `json:"customerRefId"`
+	Note                 string               `json:"note,omitempty"`
+	CustomerExt1         string               `json:"customerExt1,omitempty"`
+	CustomerExt2         string               `json:"customerExt2,omitempty"`
+	Balance              string               `json:"balance,omitempty"`
+	TokenBalance         string               `json:"tokenBalance,omitempty"`
+	Symbol               string               `json:"symbol,omitempty"`
+	TokenSymbol          string               `json:"tokenSymbol,omitempty"`
+	SubjectType          string               `json:"subjectType,omitempty"`
 	Transaction          struct {
 		To                   string `json:"to,omitempty"`
 		Value                string `json:"value,omitempty"`
@@ -222,7 +260,11 @@ type Web3SignQueryResponse struct {
 }
 
 func (e *Web3Api) QueryWeb3Sig(d Web3SignQueryRequest, r *Web3SignQueryResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/web3/sign/one")
+	return e.QueryWeb3SigCtx(context.Background(), d, r)
+}
+
+func (e *Web3Api) QueryWeb3SigCtx(ctx context.Context, d Web3SignQueryRequest, r *Web3SignQueryResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/web3/sign/one")
 }
 
 type ListWeb3SignRequest struct {
@@ -237,5 +279,9 @@ type ListWeb3SignRequest struct {
 }
 
 func (e *Web3Api) ListWeb3Sign(d ListWeb3SignRequest, r *[]Web3SignQueryResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/web3/sign/list")
+	return e.ListWeb3SignCtx(context.Background(), d, r)
+}
+
+func (e *Web3Api) ListWeb3SignCtx(ctx context.Context, d ListWeb3SignRequest, r *[]Web3SignQueryResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/web3/sign/list")
 }
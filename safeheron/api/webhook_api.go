@@ -1,6 +1,8 @@
 package api
 
 import (
+	"context"
+
 	"github.com/Safeheron/safeheron-api-sdk-go/safeheron"
 )
 
@@ -14,7 +16,11 @@ type ResendWebhookRequest struct {
 }
 
 func (e *WebhookApi) ResendWebhook(d ResendWebhookRequest, r *ResultResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/webhook/resend")
+	return e.ResendWebhookCtx(context.Background(), d, r)
+}
+
+func (e *WebhookApi) ResendWebhookCtx(ctx context.Context, d ResendWebhookRequest, r *ResultResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/webhook/resend")
 }
 
 type ResendFailedRequest struct {
@@ -27,5 +33,9 @@ type MessagesCountResponse struct {
 }
 
 func (e *WebhookApi) ResendFailed(d ResendFailedRequest, r *MessagesCountResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/webhook/resend/failed")
+	return e.ResendFailedCtx(context.Background(), d, r)
+}
+
+func (e *WebhookApi) ResendFailedCtx(ctx context.Context, d ResendFailedRequest, r *MessagesCountResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/webhook/resend/failed")
 }
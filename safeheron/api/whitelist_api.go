@@ -1,6 +1,8 @@
 package api
 
 import (
+	"context"
+
 	"github.com/Safeheron/safeheron-api-sdk-go/safeheron"
 )
 
@@ -21,7 +23,11 @@ type CreateWhitelistResponse struct {
 }
 
 func (e *WhitelistApi) CreateWhitelist(d CreateWhitelistRequest, r *CreateWhitelistResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/whitelist/create")
+	return e.CreateWhitelistCtx(context.Background(), d, r)
+}
+
+func (e *WhitelistApi) CreateWhitelistCtx(ctx context.Context, d CreateWhitelistRequest, r *CreateWhitelistResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/whitelist/create")
 }
 
 type CreateFromTransactionWhitelistRequest struct {
@@ -33,7 +39,11 @@ type CreateFromTransactionWhitelistRequest struct {
 }
 
 func (e *WhitelistApi) CreateFromTransactionWhitelist(d CreateFromTransactionWhitelistRequest, r *CreateWhitelistResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/whitelist/createFromTransaction")
+	return e.CreateFromTransactionWhitelistCtx(context.Background(), d, r)
+}
+
+func (e *WhitelistApi) CreateFromTransactionWhitelistCtx(ctx context.Context, d CreateFromTransactionWhitelistRequest, r *CreateWhitelistResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/whitelist/createFromTransaction")
 }
 
 type OneWhitelistRequest struct {
@@ -53,7 +63,11 @@ type WhitelistResponse struct {
 }
 
 func (e *WhitelistApi) OneWhitelist(d OneWhitelistRequest, r *WhitelistResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/whitelist/one")
+	return e.OneWhitelistCtx(context.Background(), d, r)
+}
+
+func (e *WhitelistApi) OneWhitelistCtx(ctx context.Context, d OneWhitelistRequest, r *WhitelistResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/whitelist/one")
 }
 
 type ListWhitelistRequest struct {
@@ -67,7 +81,11 @@ type ListWhitelistRequest struct {
 }
 
 func (e *WhitelistApi) ListWhitelist(d ListWhitelistRequest, r *[]WhitelistResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/whitelist/list")
+	return e.ListWhitelistCtx(context.Background(), d, r)
+}
+
+func (e *WhitelistApi) ListWhitelistCtx(ctx context.Context, d ListWhitelistRequest, r *[]WhitelistResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/whitelist/list")
 }
 
 type EditWhitelistRequest struct {
@@ -79,7 +97,11 @@ type EditWhitelistRequest struct {
 }
 
 func (e *WhitelistApi) EditWhitelist(d EditWhitelistRequest, r *ResultResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/whitelist/edit")
+	return e.EditWhitelistCtx(context.Background(), d, r)
+}
+
+func (e *WhitelistApi) EditWhitelistCtx(ctx context.Context, d EditWhitelistRequest, r *ResultResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/whitelist/edit")
 }
 
 type DeleteWhitelistRequest struct {
@@ -87,5 +109,9 @@ type DeleteWhitelistRequest struct {
 }
 
 func (e *WhitelistApi) DeleteWhitelist(d DeleteWhitelistRequest, r *ResultResponse) error {
-	return e.Client.SendRequest(d, r, "/v1/whitelist/delete")
+	return e.DeleteWhitelistCtx(context.Background(), d, r)
+}
+
+func (e *WhitelistApi) DeleteWhitelistCtx(ctx context.Context, d DeleteWhitelistRequest, r *ResultResponse) error {
+	return e.Client.SendRequestCtx(ctx, d, r, "/v1/whitelist/delete")
 }
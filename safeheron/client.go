@@ -2,6 +2,7 @@ package safeheron
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"crypto/tls"
 	"encoding/base64"
@@ -9,6 +10,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"sort"
 	"strconv"
@@ -16,6 +18,7 @@ import (
 	"time"
 
 	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/utils"
+	"github.com/google/uuid"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -36,7 +39,12 @@ type SafeheronResponse struct {
 }
 
 func (c Client) SendRequest(request any, response any, path string) error {
-	respContent, err := c.execute(request, path)
+	return c.SendRequestCtx(context.Background(), request, response, path)
+}
+
+// SendRequestCtx is like SendRequest but honours ctx for cancellation and deadlines.
+func (c Client) SendRequestCtx(ctx context.Context, request any, response any, path string) error {
+	respContent, err := c.executeWithRetry(ctx, request, path)
 	if err != nil {
 		return err
 	}
@@ -44,7 +52,11 @@ func (c Client) SendRequest(request any, response any, path string) error {
 	return err
 }
 
-func (c Client) execute(request any, endpoint string) ([]byte, error) {
+func (c Client) execute(ctx context.Context, request any, endpoint string) ([]byte, error) {
+	requestId := uuid.NewString()
+	fail := func(err error) error {
+		return &SafeheronError{Endpoint: endpoint, RequestId: requestId, Err: err}
+	}
 	// Use AES to encrypt request data
 	aesKey := make([]byte, 32)
 	rand.Read(aesKey)
@@ -61,36 +73,47 @@ func (c Client) execute(request any, endpoint string) ([]byte, error) {
 		log.Infof("send request data: %s", data)
 		encryptBizContent, err := utils.EncryContentWithAESGCM(data, aesKey, aesIv)
 		if err != nil {
-			return nil, err
+			return nil, fail(err)
 		}
 		params["bizContent"] = encryptBizContent
 	}
 
 	// Use Safeheron RSA public key to encrypt request's aesKey and aesIv
-	encryptedKeyAndIv, err := utils.EncryptWithOAEP(append(aesKey, aesIv...), c.Config.SafeheronRsaPublicKey)
+	safeheronPublicKey, err := c.safeheronPublicKey().PublicKey()
+	if err != nil {
+		return nil, fail(err)
+	}
+	encryptedKeyAndIv, err := utils.EncryptWithOAEPKey(append(aesKey, aesIv...), safeheronPublicKey)
 	if err != nil {
-		return nil, err
+		return nil, fail(err)
 	}
 	params["key"] = encryptedKeyAndIv
 
 	// Sign the request data with your RSA private key
-	signature, err := utils.SignParamsWithRSA(serializeParams(params), c.Config.RsaPrivateKey)
+	signature, err := utils.SignParams(serializeParams(params), c.signer())
 	if err != nil {
-		return nil, err
+		return nil, fail(err)
 	}
 	params["sig"] = signature
 	params["rsaType"] = utils.ECB_OAEP
 	params["aesType"] = utils.GCM
 
 	// Send post
-	safeheronResponse, _ := c.Post(params, endpoint)
+	safeheronResponse, httpStatus, err := c.post(ctx, params, endpoint, requestId)
+	if err != nil {
+		return nil, &SafeheronError{HttpStatus: httpStatus, Endpoint: endpoint, RequestId: requestId, Err: err, transport: true}
+	}
 
 	// Decode json data into SafeheronResponse struct
 	var responseStruct SafeheronResponse
-	json.Unmarshal(safeheronResponse, &responseStruct)
+	if err := json.Unmarshal(safeheronResponse, &responseStruct); err != nil {
+		log.Warnf("request failed, httpStatus: %d, requestId: %s", httpStatus, requestId)
+		return nil, &SafeheronError{Message: http.StatusText(httpStatus), HttpStatus: httpStatus, Endpoint: endpoint, RequestId: requestId, Err: err}
+	}
 	if responseStruct.Code != 200 {
-		log.Warnf("request failed: %d, message: %s", responseStruct.Code, responseStruct.Message)
-		return nil, fmt.Errorf("request failed, code: %d, message: %s", responseStruct.Code, responseStruct.Message)
+		log.Warnf("request failed: %d, message: %s, requestId: %s", responseStruct.Code, responseStruct.Message, requestId)
+		return nil, &SafeheronError{Code: responseStruct.Code, Message: responseStruct.Message, HttpStatus: httpStatus, Endpoint: endpoint, RequestId: requestId,
+			codes: c.Config.ErrorCodes}
 	}
 
 	responseStringMap := map[string]string{
@@ -102,27 +125,21 @@ func (c Client) execute(request any, endpoint string) ([]byte, error) {
 	}
 
 	// Verify sign
-	verifyRet := utils.VerifySignWithRSA(serializeParams(responseStringMap), responseStruct.Sig, c.Config.SafeheronRsaPublicKey)
+	verifyRet := utils.VerifySignWithRSAKey(serializeParams(responseStringMap), responseStruct.Sig, safeheronPublicKey)
 	if !verifyRet {
-		return nil, errors.New("response signature verification failed")
+		return nil, fail(ErrResponseSignature)
 	}
 
 	// Use your RSA private key to decrypt response's aesKey and aesIv
 	//fmt.Printf(responseStruct.Key)
 
-	var plaintext []byte
-	if utils.ECB_OAEP == responseStruct.RsaType {
-		plaintext, err = utils.DecryptWithOAEP(responseStruct.Key, c.Config.RsaPrivateKey)
-	} else {
-		plaintext, err = utils.DecryptWithRSA(responseStruct.Key, c.Config.RsaPrivateKey)
-	}
-
+	plaintext, err := utils.DecryptKey(responseStruct.Key, responseStruct.RsaType, c.signer())
 	if err != nil {
-		return nil, errors.New("API response RSA decryption failed")
+		return nil, fail(fmt.Errorf("API response RSA decryption failed: %w", err))
 	}
 
 	if len(plaintext) < 48 {
-		return nil, errors.New("API response decrypted plaintext length is invalid")
+		return nil, fail(errors.New("API response decrypted plaintext length is invalid"))
 	}
 
 	resAesKey := plaintext[:32]
@@ -131,7 +148,7 @@ func (c Client) execute(request any, endpoint string) ([]byte, error) {
 	ciphertext, err := base64.StdEncoding.DecodeString(responseStruct.BizContent)
 
 	if err != nil {
-		return nil, errors.New("bizContent base64 decode failed")
+		return nil, fail(errors.New("bizContent base64 decode failed"))
 	}
 
 	var respContent []byte
@@ -142,35 +159,95 @@ func (c Client) execute(request any, endpoint string) ([]byte, error) {
 	}
 
 	if err != nil {
-		return nil, errors.New("API response AES decryption failed")
+		return nil, fail(errors.New("API response AES decryption failed"))
 	}
 
 	return respContent, nil
 }
 
 func (c Client) Post(params map[string]string, path string) ([]byte, error) {
+	return c.PostCtx(context.Background(), params, path)
+}
+
+// PostCtx is like Post but the HTTP round trip is bound to ctx.
+func (c Client) PostCtx(ctx context.Context, params map[string]string, path string) ([]byte, error) {
+	body, _, err := c.post(ctx, params, path, "")
+	return body, err
+}
+
+func (c Client) post(ctx context.Context, params map[string]string, path string, requestId string) ([]byte, int, error) {
 	jsonValue, _ := json.Marshal(params)
-	tr := &http.Transport{
-		TLSNextProto: make(map[string]func(authority string, c *tls.Conn) http.RoundTripper),
-	}
-	var httpClient *http.Client
+	timeout := 20000 * time.Millisecond
 	if c.Config.RequestTimeout != 0 {
-		httpClient = &http.Client{Transport: tr, Timeout: time.Duration(c.Config.RequestTimeout) * time.Millisecond}
-	} else {
-		httpClient = &http.Client{Transport: tr, Timeout: 20000 * time.Millisecond}
+		timeout = time.Duration(c.Config.RequestTimeout) * time.Millisecond
 	}
-	resp, err := httpClient.Post(fmt.Sprintf("%s%s", c.Config.BaseUrl, path), "application/json", bytes.NewBuffer(jsonValue))
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s%s", c.Config.BaseUrl, path), bytes.NewBuffer(jsonValue))
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if requestId != "" {
+		req.Header.Set("X-Request-Id", requestId)
+	}
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, 0, err
 	}
 	defer resp.Body.Close()
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		log.Errorf("request safeheron api error, api: %s", path)
-		return nil, err
+		return nil, resp.StatusCode, err
 	}
 
-	return body, nil
+	return body, resp.StatusCode, nil
+}
+
+func (c Client) signer() utils.SignerDecrypter {
+	if c.Config.RsaSigner != nil {
+		return c.Config.RsaSigner
+	}
+	if c.Config.RsaPrivateKeySource != nil {
+		return c.Config.RsaPrivateKeySource
+	}
+	return utils.FileKey(c.Config.RsaPrivateKey)
+}
+
+func (c Client) safeheronPublicKey() *utils.RsaKey {
+	if c.Config.SafeheronRsaPublicKeySource != nil {
+		return c.Config.SafeheronRsaPublicKeySource
+	}
+	return utils.FileKey(c.Config.SafeheronRsaPublicKey)
+}
+
+// DefaultTransport is shared by every Client that does not configure its own
+// HttpClient or Transport, so connections are pooled and kept alive across requests.
+var DefaultTransport http.RoundTripper = &http.Transport{
+	Proxy: http.ProxyFromEnvironment,
+	DialContext: (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}).DialContext,
+	TLSNextProto:          make(map[string]func(authority string, c *tls.Conn) http.RoundTripper),
+	MaxIdleConns:          100,
+	MaxIdleConnsPerHost:   100,
+	IdleConnTimeout:       90 * time.Second,
+	TLSHandshakeTimeout:   10 * time.Second,
+	ExpectContinueTimeout: 1 * time.Second,
+}
+
+var defaultHttpClient = &http.Client{Transport: DefaultTransport}
+
+func (c Client) httpClient() *http.Client {
+	if c.Config.HttpClient != nil {
+		return c.Config.HttpClient
+	}
+	if c.Config.Transport != nil {
+		return &http.Client{Transport: c.Config.Transport}
+	}
+	return defaultHttpClient
 }
 
 func serializeParams(params map[string]string) string {
@@ -1,9 +1,26 @@
 package safeheron
 
+import (
+	"net/http"
+
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/utils"
+)
+
 type ApiConfig struct {
 	BaseUrl               string `comment:"Safeheron Request Base URL"`
 	ApiKey                string `comment:"api key, you can get from safeheron web console"`
 	RsaPrivateKey         string `comment:"Your RSA private key"`
 	SafeheronRsaPublicKey string `comment:"Api key's platform public key, you can get from safeheron web console"`
 	RequestTimeout        int64  `comment:"RequestTimeout (Millisecond)"`
+
+	RsaPrivateKeySource         *utils.RsaKey         `comment:"Your RSA private key from memory, env or a secret provider, takes precedence over RsaPrivateKey"`
+	SafeheronRsaPublicKeySource *utils.RsaKey         `comment:"Api key's platform public key from memory, env or a secret provider, takes precedence over SafeheronRsaPublicKey"`
+	RsaSigner                   utils.SignerDecrypter `comment:"Signs requests and decrypts responses with a key held elsewhere (HSM, KMS), takes precedence over the private key settings"`
+
+	HttpClient *http.Client      `comment:"Optional HTTP client used for every request, takes precedence over Transport"`
+	Transport  http.RoundTripper `comment:"Optional transport (proxy, custom CA, mTLS, dialer) used with a client owned by the SDK"`
+
+	RetryPolicy *RetryPolicy `comment:"Optional retry policy, requests are sent once when nil"`
+
+	ErrorCodes ErrorCodes `comment:"API error codes of the conditions the error predicates detect, from the Safeheron documentation"`
 }
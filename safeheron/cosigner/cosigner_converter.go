@@ -2,6 +2,7 @@ package cosigner
 
 import (
 	"crypto/rand"
+	"crypto/rsa"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -33,11 +34,28 @@ func (c *CoSignerConfig) getCoSignerPubKey() string {
 	return c.CoSignerPubKey
 }
 
+func (c *CoSignerConfig) getCoSignerPublicKey() (*rsa.PublicKey, error) {
+	if c.CoSignerPubKeySource != nil {
+		return c.CoSignerPubKeySource.PublicKey()
+	}
+	return utils.FileKey(c.getCoSignerPubKey()).PublicKey()
+}
+
+func (c *CoSignerConfig) getApprovalCallbackServiceSigner() utils.SignerDecrypter {
+	if c.ApprovalCallbackServiceSigner != nil {
+		return c.ApprovalCallbackServiceSigner
+	}
+	return utils.FileKey(c.getApprovalCallbackServicePrivateKey())
+}
+
 type CoSignerConfig struct {
 	CoSignerPubKey                    string `comment:"coSignerPubKey"`
 	ApprovalCallbackServicePrivateKey string `comment:"approvalCallbackServicePrivateKey"`
 	ApiPubKey                         string `comment:"apiPubKey"`
 	BizPrivKey                        string `comment:"bizPrivKey"`
+
+	CoSignerPubKeySource          *utils.RsaKey         `comment:"coSignerPubKey from memory, env or a secret provider, takes precedence over CoSignerPubKey"`
+	ApprovalCallbackServiceSigner utils.SignerDecrypter `comment:"Signs and decrypts with a key held elsewhere (HSM, KMS), takes precedence over ApprovalCallbackServicePrivateKey"`
 }
 
 type CoSignerCallBack struct {
@@ -63,19 +81,16 @@ func (c *CoSignerConverter) RequestConvert(d CoSignerCallBack) (string, error) {
 		"bizContent": d.BizContent,
 	}
 	// Verify sign
-	verifyRet := utils.VerifySignWithRSA(serializeParams(responseStringMap), d.Sig, c.Config.getCoSignerPubKey())
+	publicKey, err := c.Config.getCoSignerPublicKey()
+	if err != nil {
+		return "", err
+	}
+	verifyRet := utils.VerifySignWithRSAKey(serializeParams(responseStringMap), d.Sig, publicKey)
 	if !verifyRet {
 		return "", errors.New("CoSignerCallBack signature verification failed")
 	}
 	// Use your RSA private key to decrypt response's aesKey and aesIv
-	var plaintext []byte
-	var err error
-	if d.RsaType == utils.ECB_OAEP {
-		plaintext, err = utils.DecryptWithOAEP(d.Key, c.Config.getApprovalCallbackServicePrivateKey())
-	} else {
-		plaintext, err = utils.DecryptWithRSA(d.Key, c.Config.getApprovalCallbackServicePrivateKey())
-	}
-
+	plaintext, err := utils.DecryptKey(d.Key, d.RsaType, c.Config.getApprovalCallbackServiceSigner())
 	if err != nil {
 		return "", errors.New("co-signer RSA decryption failed")
 	}
@@ -113,7 +128,11 @@ func (c *CoSignerConverter) RequestV3Convert(d CoSignerCallBackV3) (string, erro
 		"bizContent": d.BizContent,
 	}
 	// Verify sign
-	verifyRet := utils.VerifySignWithRSAPSS(serializeParams(responseStringMap), d.Sig, c.Config.getCoSignerPubKey())
+	publicKey, err := c.Config.getCoSignerPublicKey()
+	if err != nil {
+		return "", err
+	}
+	verifyRet := utils.VerifySignWithRSAPSSKey(serializeParams(responseStringMap), d.Sig, publicKey)
 	if !verifyRet {
 		return "", errors.New("CoSignerCallBack signature verification failed")
 	}
@@ -135,7 +154,7 @@ func (c *CoSignerConverter) ResponseV3Converter(d any) (map[string]string, error
 	}
 
 	// Sign the request data with your Approval Callback Service's private Key
-	signature, err := utils.SignParamsWithRSAPSS(serializeParams(params), c.Config.getApprovalCallbackServicePrivateKey())
+	signature, err := utils.SignParamsPSS(serializeParams(params), c.Config.getApprovalCallbackServiceSigner())
 	if err != nil {
 		return nil, err
 	}
@@ -177,14 +196,18 @@ func (c *CoSignerConverter) ResponseConverter(d any) (map[string]string, error)
 	}
 
 	// Use Safeheron RSA public key to encrypt request's aesKey and aesIv
-	encryptedKeyAndIv, err := utils.EncryptWithRSA(append(aesKey, aesIv...), c.Config.getCoSignerPubKey())
+	publicKey, err := c.Config.getCoSignerPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	encryptedKeyAndIv, err := utils.EncryptWithRSAKey(append(aesKey, aesIv...), publicKey)
 	if err != nil {
 		return nil, err
 	}
 	params["key"] = encryptedKeyAndIv
 
 	// Sign the request data with your RSA private key
-	signature, err := utils.SignParamsWithRSA(serializeParams(params), c.Config.getApprovalCallbackServicePrivateKey())
+	signature, err := utils.SignParams(serializeParams(params), c.Config.getApprovalCallbackServiceSigner())
 	if err != nil {
 		return nil, err
 	}
@@ -215,14 +238,18 @@ func (c *CoSignerConverter) ResponseConverterWithNewCryptoType(d any) (map[strin
 	}
 
 	// Use Safeheron RSA public key to encrypt request's aesKey and aesIv
-	encryptedKeyAndIv, err := utils.EncryptWithOAEP(append(aesKey, aesIv...), c.Config.getCoSignerPubKey())
+	publicKey, err := c.Config.getCoSignerPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	encryptedKeyAndIv, err := utils.EncryptWithOAEPKey(append(aesKey, aesIv...), publicKey)
 	if err != nil {
 		return nil, err
 	}
 	params["key"] = encryptedKeyAndIv
 
 	// Sign the request data with your RSA private key
-	signature, err := utils.SignParamsWithRSA(serializeParams(params), c.Config.getApprovalCallbackServicePrivateKey())
+	signature, err := utils.SignParams(serializeParams(params), c.Config.getApprovalCallbackServiceSigner())
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,128 @@
+package safeheron
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// SafeheronError is returned by Client for every failed request, whether it was
+// rejected by Safeheron, failed in transit or could not be verified locally.
+type SafeheronError struct {
+	// Code is the API error code, 0 when the request never got an API answer.
+	Code    int64
+	Message string
+	// HttpStatus is the HTTP status code of the response, 0 on transport failure.
+	HttpStatus int
+	Endpoint   string
+	// RequestId identifies the request in logs, it is sent as the X-Request-Id header.
+	RequestId string
+	// Err is the underlying cause, such as a network or decryption error.
+	Err error
+
+	// transport is set when the request failed before an API answer was read.
+	transport bool
+	// codes are the ErrorCodes of the client that received the error.
+	codes ErrorCodes
+}
+
+// ErrorCodes lists the API error codes meaning the conditions IsInsufficientBalance,
+// IsDuplicateCustomerRefId, IsRateLimited and IsSignatureInvalid detect. The SDK
+// does not ship them: take them from the error code table of the Safeheron API
+// documentation, https://docs.safeheron.com/api/index.html, and set them in
+// ApiConfig.ErrorCodes. A predicate never matches a rejection when its codes are
+// not set.
+type ErrorCodes struct {
+	// InsufficientBalance: the source account can not cover the amount and the fee.
+	InsufficientBalance []int64
+	// DuplicateCustomerRefId: the customerRefId was used by an earlier request.
+	DuplicateCustomerRefId []int64
+	// RateLimited: the request was throttled, in addition to HTTP status 429.
+	RateLimited []int64
+	// SignatureInvalid: Safeheron could not verify the request signature.
+	SignatureInvalid []int64
+}
+
+func (e *SafeheronError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("request %s failed, requestId: %s, %s", e.Endpoint, e.RequestId, e.Err.Error())
+	}
+	return fmt.Sprintf("request %s failed, requestId: %s, httpStatus: %d, code: %d, message: %s", e.Endpoint, e.RequestId, e.HttpStatus, e.Code, e.Message)
+}
+
+func (e *SafeheronError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether e matches target, so that SafeheronError values can be used
+// as sentinels with errors.Is: a target with a Code matches the errors with that
+// API code, a target with only an HttpStatus matches the errors with that status.
+// Define sentinels for the API codes you handle from the Safeheron documentation:
+//
+//	var ErrMyCode = &safeheron.SafeheronError{Code: myCode}
+func (e *SafeheronError) Is(target error) bool {
+	t, ok := target.(*SafeheronError)
+	if !ok {
+		return false
+	}
+	if t.Code != 0 {
+		return e.Code == t.Code
+	}
+	return t.HttpStatus != 0 && e.HttpStatus == t.HttpStatus
+}
+
+var (
+	// ErrRateLimited matches the requests Safeheron throttled with HTTP status 429.
+	ErrRateLimited = &SafeheronError{HttpStatus: http.StatusTooManyRequests, Message: "too many requests"}
+
+	// ErrResponseSignature is wrapped when a response does not carry a valid Safeheron signature.
+	ErrResponseSignature = errors.New("response signature verification failed")
+)
+
+// IsRejected reports whether Safeheron answered the request with an API error
+// code: the request was read and refused. Transport failures, 5xx responses and
+// responses that could not be verified are not rejections, the request may have
+// been carried out.
+func IsRejected(err error) bool {
+	var e *SafeheronError
+	return errors.As(err, &e) && e.Code != 0 && e.Err == nil
+}
+
+// IsSignatureInvalid reports whether Safeheron rejected the request signature
+// with one of ErrorCodes.SignatureInvalid, or the response signature could not
+// be verified.
+func IsSignatureInvalid(err error) bool {
+	return errors.Is(err, ErrResponseSignature) || rejectedWith(err, func(codes ErrorCodes) []int64 { return codes.SignatureInvalid })
+}
+
+// IsRateLimited reports whether the request was throttled by Safeheron, with
+// HTTP status 429 or one of ErrorCodes.RateLimited.
+func IsRateLimited(err error) bool {
+	return errors.Is(err, ErrRateLimited) || rejectedWith(err, func(codes ErrorCodes) []int64 { return codes.RateLimited })
+}
+
+// IsInsufficientBalance reports whether Safeheron rejected the request with one
+// of ErrorCodes.InsufficientBalance.
+func IsInsufficientBalance(err error) bool {
+	return rejectedWith(err, func(codes ErrorCodes) []int64 { return codes.InsufficientBalance })
+}
+
+// IsDuplicateCustomerRefId reports whether Safeheron rejected the request with
+// one of ErrorCodes.DuplicateCustomerRefId: a transaction with its customerRefId
+// exists.
+func IsDuplicateCustomerRefId(err error) bool {
+	return rejectedWith(err, func(codes ErrorCodes) []int64 { return codes.DuplicateCustomerRefId })
+}
+
+func rejectedWith(err error, codes func(ErrorCodes) []int64) bool {
+	var e *SafeheronError
+	if !IsRejected(err) || !errors.As(err, &e) {
+		return false
+	}
+	for _, code := range codes(e.codes) {
+		if e.Code == code {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,16 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris || windows)
+
+package nonce
+
+import (
+	"errors"
+	"os"
+)
+
+func tryLockFile(file *os.File) (bool, error) {
+	return false, errors.New("FileStore is not supported on this platform")
+}
+
+func unlockFile(file *os.File) error {
+	return nil
+}
@@ -0,0 +1,444 @@
+package nonce
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/api"
+)
+
+// errReadOnly ends an Update without saving the state.
+var errReadOnly = errors.New("read only")
+
+// TransactionKey is the key of the vault transactions of an account on the
+// chain whose fee coin is feeCoinKey, its tokens share the sequence.
+func TransactionKey(accountKey string, feeCoinKey string) Key {
+	return Key{AccountKey: accountKey, Chain: feeCoinKey}
+}
+
+// Web3Key is the key of the EthSignTransaction requests of a Web3 account on an EVM chain.
+func Web3Key(accountKey string, chainId int64) Key {
+	return Key{AccountKey: accountKey, Chain: fmt.Sprintf("eip155:%d", chainId)}
+}
+
+func (k Key) web3ChainId() (int64, bool) {
+	chainId, err := strconv.ParseInt(strings.TrimPrefix(k.Chain, "eip155:"), 10, 64)
+	return chainId, err == nil && strings.HasPrefix(k.Chain, "eip155:")
+}
+
+// Manager hands out the nonces of EVM accounts to concurrent goroutines and,
+// through a shared Store, processes. A nonce is reserved before its transaction
+// is created and stays pending until Sync sees the transaction complete. The
+// nonce of a transaction that failed, was cancelled or was never created is a
+// gap: it is handed out again first and FillGaps sends replacements for it.
+type Manager struct {
+	Store        Store
+	Transactions *api.TransactionApi
+	// Web3 is needed for Web3Key sequences only.
+	Web3 *api.Web3Api
+	// ReserveTimeout frees the nonces reserved for longer without a known
+	// transaction, the process reserving them likely died. 10 minutes when not set.
+	ReserveTimeout time.Duration
+	// Now returns the current time, time.Now when not set.
+	Now func() time.Time
+}
+
+func (m *Manager) now() time.Time {
+	if m.Now != nil {
+		return m.Now()
+	}
+	return time.Now()
+}
+
+// State returns the nonce sequence of key as kept by the store.
+func (m *Manager) State(ctx context.Context, key Key) (State, error) {
+	var state State
+	err := m.Store.Update(ctx, key, func(s *State) error {
+		state = cloneState(*s)
+		return errReadOnly
+	})
+	if err != nil && err != errReadOnly {
+		return State{}, err
+	}
+	return state, nil
+}
+
+// Reserve hands out the lowest gap of key, or its next nonce. The sequence is
+// read from Safeheron first when the store does not know key yet.
+func (m *Manager) Reserve(ctx context.Context, key Key) (int64, error) {
+	return m.reserve(ctx, key, "")
+}
+
+func (m *Manager) reserve(ctx context.Context, key Key, customerRefId string) (int64, error) {
+	state, err := m.State(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	if !state.Synced {
+		if _, err := m.Sync(ctx, key); err != nil {
+			return 0, err
+		}
+	}
+	var nonce int64
+	err = m.Store.Update(ctx, key, func(state *State) error {
+		if len(state.Free) > 0 {
+			nonce, state.Free = state.Free[0], state.Free[1:]
+		} else {
+			nonce = state.Next
+			state.Next++
+		}
+		state.Pending = append(state.Pending, Reservation{Nonce: nonce, CustomerRefId: customerRefId, Time: m.now()})
+		return nil
+	})
+	return nonce, err
+}
+
+// Assign records the transaction created with a reserved nonce.
+func (m *Manager) Assign(ctx context.Context, key Key, nonce int64, txKey string) error {
+	return m.Store.Update(ctx, key, func(state *State) error {
+		for i := range state.Pending {
+			if state.Pending[i].Nonce == nonce {
+				state.Pending[i].TxKey = txKey
+				return nil
+			}
+		}
+		state.Pending = append(state.Pending, Reservation{Nonce: nonce, TxKey: txKey, Time: m.now()})
+		return nil
+	})
+}
+
+// Release frees a reserved nonce whose transaction was not created.
+func (m *Manager) Release(ctx context.Context, key Key, nonce int64) error {
+	return m.Store.Update(ctx, key, func(state *State) error {
+		release(state, nonce)
+		return nil
+	})
+}
+
+func release(state *State, nonce int64) {
+	for i := range state.Pending {
+		if state.Pending[i].Nonce == nonce {
+			state.Pending = append(state.Pending[:i], state.Pending[i+1:]...)
+			break
+		}
+	}
+	state.Free = append(state.Free, nonce)
+	normalize(state)
+}
+
+// normalize sorts the gaps and gives the gaps at the top of the sequence back to Next.
+func normalize(state *State) {
+	sort.Slice(state.Free, func(i, j int) bool { return state.Free[i] < state.Free[j] })
+	free := state.Free[:0]
+	for _, nonce := range state.Free {
+		if nonce < state.Next && (len(free) == 0 || free[len(free)-1] != nonce) {
+			free = append(free, nonce)
+		}
+	}
+	for len(free) > 0 && free[len(free)-1] == state.Next-1 && !pending(state, state.Next-1) {
+		free, state.Next = free[:len(free)-1], state.Next-1
+	}
+	state.Free = free
+}
+
+func pending(state *State, nonce int64) bool {
+	for _, reservation := range state.Pending {
+		if reservation.Nonce == nonce {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateTransaction creates d with CreateTransactionsV3 and the next nonce of
+// its source account. The chain of the coin is looked up in Transactions.Coins,
+// without a registry d.CoinKey is taken to be the fee coin.
+//
+// Nonce 0 can not be pinned, the field is left out of the request and Safeheron
+// picks the next nonce of the account, 0 for an account new to the chain.
+func (m *Manager) CreateTransaction(ctx context.Context, d api.CreateTransactionsRequest, r *api.CreateTransactionV3Response) error {
+	chain := d.CoinKey
+	if m.Transactions.Coins != nil {
+		coin, err := m.Transactions.Coins.CoinCtx(ctx, d.CoinKey)
+		if err != nil {
+			return err
+		}
+		chain = coin.FeeCoinKey
+	}
+	key := TransactionKey(d.SourceAccountKey, chain)
+	nonce, err := m.reserve(ctx, key, d.CustomerRefId)
+	if err != nil {
+		return err
+	}
+	d.Nonce = nonce
+	err = m.Transactions.CreateTransactionsV3Ctx(ctx, d, r)
+	return m.settle(ctx, key, nonce, err, r.TxKey, r.IdempotentRequest)
+}
+
+// EthSignTransaction signs d with the next nonce of its Web3 account on the chain of d.
+func (m *Manager) EthSignTransaction(ctx context.Context, d api.EthSignTransactionRequest, r *api.TxKeyResult) error {
+	key := Web3Key(d.AccountKey, d.Transaction.ChainId)
+	nonce, err := m.reserve(ctx, key, d.CustomerRefId)
+	if err != nil {
+		return err
+	}
+	d.Transaction.Nonce = nonce
+	err = m.Web3.EthSignTransactionCtx(ctx, d, r)
+	return m.settle(ctx, key, nonce, err, r.TxKey, false)
+}
+
+// settle records the outcome of a request sent with a reserved nonce. The nonce
+// of a request Safeheron rejected with an error code is released. After any
+// other error, a timeout or a 5xx response, the request may have been created:
+// the nonce stays reserved for Sync to look it up by customerRefId.
+func (m *Manager) settle(ctx context.Context, key Key, nonce int64, err error, txKey string, idempotent bool) error {
+	switch {
+	case safeheron.IsRejected(err) || (err == nil && idempotent):
+		// An idempotent request returned the transaction created earlier with its own nonce
+		if releaseErr := m.Release(ctx, key, nonce); releaseErr != nil && err == nil {
+			err = releaseErr
+		}
+		return err
+	case err != nil:
+		return err
+	}
+	return m.Assign(ctx, key, nonce, txKey)
+}
+
+// tx is what Sync needs to know of a transaction.
+type tx struct {
+	txKey     string
+	nonce     int64
+	status    api.TransactionStatus
+	subStatus api.TransactionSubStatus
+	replaced  string
+	// mined is true for a transaction that failed on chain, its nonce is used.
+	mined bool
+}
+
+// used reports whether t holds its nonce: it is in flight, succeeded or failed
+// on chain. A replaced transaction leaves its nonce to its replacement.
+func (t tx) used() bool {
+	return (!t.status.IsTerminal() || t.status.IsSuccess() || t.mined) && t.subStatus != subStatusReplaced
+}
+
+// subStatusReplaced ends a transaction recreated with a higher fee, its
+// replacement has the same nonce.
+const subStatusReplaced api.TransactionSubStatus = "REPLACED"
+
+// Sync reads the pending transactions of key and the latest transactions of its
+// account from Safeheron. Completed nonces are dropped, the nonces of failed,
+// cancelled or long unknown transactions become gaps. Next moves past every
+// nonce in use, by a transaction in flight or done, from the manager or not,
+// and the nonces in use are never gaps. It returns the gaps.
+func (m *Manager) Sync(ctx context.Context, key Key) ([]int64, error) {
+	state, err := m.State(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	recent, err := m.recent(ctx, key, state)
+	if err != nil {
+		return nil, err
+	}
+	maxCompleted, maxUsed := int64(-1), int64(-1)
+	used := map[int64]bool{}
+	replacements := map[string]tx{}
+	for _, t := range recent {
+		if t.status.IsSuccess() && t.nonce > maxCompleted {
+			maxCompleted = t.nonce
+		}
+		if t.used() {
+			used[t.nonce] = true
+			if t.nonce > maxUsed {
+				maxUsed = t.nonce
+			}
+		}
+		if t.replaced != "" {
+			replacements[t.replaced] = t
+		}
+	}
+	known := map[int64]tx{}
+	for _, reservation := range state.Pending {
+		t, found, err := m.lookup(ctx, key, reservation)
+		if err != nil {
+			return nil, err
+		}
+		// Follows a chain of speed ups to the latest replacement
+		for found && t.subStatus == subStatusReplaced {
+			t, found = replacements[t.txKey]
+		}
+		if found {
+			known[reservation.Nonce] = t
+		}
+	}
+
+	reserveTimeout := m.ReserveTimeout
+	if reserveTimeout <= 0 {
+		reserveTimeout = 10 * time.Minute
+	}
+	var gaps []int64
+	err = m.Store.Update(ctx, key, func(state *State) error {
+		var pendingList []Reservation
+		for _, reservation := range state.Pending {
+			t, found := known[reservation.Nonce]
+			switch {
+			case found && (t.status.IsSuccess() || (t.status.IsTerminal() && t.mined)):
+			case found && t.status.IsTerminal():
+				state.Free = append(state.Free, reservation.Nonce)
+			case found:
+				reservation.TxKey = t.txKey
+				pendingList = append(pendingList, reservation)
+			case reservation.TxKey == "" && m.now().Sub(reservation.Time) > reserveTimeout:
+				state.Free = append(state.Free, reservation.Nonce)
+			case reservation.TxKey != "" && reservation.Nonce <= maxCompleted:
+				// Replaced by a speed up not among the latest transactions, the nonce is used
+			default:
+				pendingList = append(pendingList, reservation)
+			}
+		}
+		state.Pending = pendingList
+		if maxUsed >= state.Next {
+			state.Next = maxUsed + 1
+		}
+		free := state.Free[:0]
+		for _, nonce := range state.Free {
+			// Used outside the manager, or by a request released after an error
+			if nonce > maxCompleted && !used[nonce] {
+				free = append(free, nonce)
+			}
+		}
+		state.Free = free
+		state.Synced = true
+		normalize(state)
+		gaps = append([]int64(nil), state.Free...)
+		return nil
+	})
+	return gaps, err
+}
+
+// lookup finds the transaction of a reservation, by txKey or else by customerRefId.
+func (m *Manager) lookup(ctx context.Context, key Key, reservation Reservation) (tx, bool, error) {
+	if reservation.TxKey == "" && reservation.CustomerRefId == "" {
+		return tx{}, false, nil
+	}
+	if _, ok := key.web3ChainId(); ok {
+		var r api.Web3SignQueryResponse
+		err := m.Web3.QueryWeb3SigCtx(ctx, api.Web3SignQueryRequest{TxKey: reservation.TxKey, CustomerRefId: reservation.CustomerRefId}, &r)
+		if err != nil {
+			return tx{}, false, lookupError(reservation, err)
+		}
+		return tx{txKey: r.TxKey, nonce: r.Transaction.Nonce, status: r.TransactionStatus, subStatus: r.TransactionSubStatus}, true, nil
+	}
+	var r api.OneTransactionsResponse
+	err := m.Transactions.OneTransactionsCtx(ctx, api.OneTransactionsRequest{TxKey: reservation.TxKey, CustomerRefId: reservation.CustomerRefId}, &r)
+	if err != nil {
+		return tx{}, false, lookupError(reservation, err)
+	}
+	nonce, _ := strconv.ParseInt(r.Nonce, 10, 64)
+	return tx{txKey: r.TxKey, nonce: nonce, status: r.TransactionStatus, subStatus: r.TransactionSubStatus, mined: r.BlockHeight > 0}, true, nil
+}
+
+// lookupError ignores the rejections of a lookup by customerRefId, the request
+// that reserved the nonce may not have reached Safeheron.
+func lookupError(reservation Reservation, err error) error {
+	if reservation.TxKey == "" && safeheron.IsRejected(err) {
+		return nil
+	}
+	return fmt.Errorf("nonce %d: %w", reservation.Nonce, err)
+}
+
+// recent returns the latest transactions of the account of key on its chain,
+// from the newest back to the first one completed below the Next of state: the
+// transactions created before it have lower nonces. Before the first Sync it
+// stops at the first one completed.
+func (m *Manager) recent(ctx context.Context, key Key, state State) ([]tx, error) {
+	var recent []tx
+	covered := func(t tx) bool {
+		return t.status.IsSuccess() && (!state.Synced || t.nonce < state.Next)
+	}
+	if chainId, ok := key.web3ChainId(); ok {
+		pager := m.Web3.IterateWeb3Sign(ctx, api.ListWeb3SignRequest{AccountKey: key.AccountKey, SubjectType: "ETH_SIGNTRANSACTION", Limit: 50})
+		defer pager.Close()
+		for pager.Next() {
+			r := pager.Item()
+			if r.Transaction.ChainId != chainId {
+				continue
+			}
+			t := tx{txKey: r.TxKey, nonce: r.Transaction.Nonce, status: r.TransactionStatus, subStatus: r.TransactionSubStatus}
+			recent = append(recent, t)
+			if covered(t) {
+				break
+			}
+		}
+		return recent, pager.Err()
+	}
+	pager := m.Transactions.IterateTransactionsV2(ctx, api.ListTransactionsV2Request{SourceAccountKey: key.AccountKey, FeeCoinKey: key.Chain, Limit: 50})
+	defer pager.Close()
+	for pager.Next() {
+		r := pager.Item()
+		if r.TransactionDirection == "INFLOW" {
+			continue
+		}
+		nonce, err := strconv.ParseInt(r.Nonce, 10, 64)
+		if err != nil {
+			continue
+		}
+		t := tx{txKey: r.TxKey, nonce: nonce, status: r.TransactionStatus, subStatus: r.TransactionSubStatus, replaced: r.ReplacedTxKey, mined: r.BlockHeight > 0}
+		recent = append(recent, t)
+		if covered(t) {
+			break
+		}
+	}
+	return recent, pager.Err()
+}
+
+// FillGaps sends a replacement for every gap of key, the transactions above a gap
+// are stuck until it is used. replace creates a transaction with the given nonce,
+// a transfer of the smallest amount to the account itself for example, and
+// returns its txKey. It returns the gaps filled.
+func (m *Manager) FillGaps(ctx context.Context, key Key, replace func(ctx context.Context, nonce int64) (string, error)) ([]int64, error) {
+	gaps, err := m.Sync(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	var filled []int64
+	for _, nonce := range gaps {
+		claimed := false
+		err := m.Store.Update(ctx, key, func(state *State) error {
+			for i, free := range state.Free {
+				if free == nonce {
+					state.Free = append(state.Free[:i], state.Free[i+1:]...)
+					state.Pending = append(state.Pending, Reservation{Nonce: nonce, Time: m.now()})
+					claimed = true
+					break
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return filled, err
+		}
+		if !claimed {
+			// Handed out by Reserve meanwhile
+			continue
+		}
+		txKey, err := replace(ctx, nonce)
+		if err != nil {
+			if releaseErr := m.Release(ctx, key, nonce); releaseErr != nil {
+				return filled, releaseErr
+			}
+			return filled, fmt.Errorf("nonce %d: %w", nonce, err)
+		}
+		if err := m.Assign(ctx, key, nonce, txKey); err != nil {
+			return filled, err
+		}
+		filled = append(filled, nonce)
+	}
+	return filled, nil
+}
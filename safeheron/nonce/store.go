@@ -0,0 +1,162 @@
+package nonce
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Key identifies a nonce sequence: an account on a chain.
+type Key struct {
+	AccountKey string
+	// Chain is the fee coin key of the chain for vault transactions, see
+	// TransactionKey, or "eip155:<chainId>" for Web3 signatures, see Web3Key.
+	Chain string
+}
+
+// Reservation is a nonce handed out and not known to be confirmed yet.
+type Reservation struct {
+	Nonce int64 `json:"nonce"`
+	// CustomerRefId finds the transaction when the process died before TxKey was recorded.
+	CustomerRefId string `json:"customerRefId,omitempty"`
+	// TxKey is the transaction using the nonce, empty until it is created.
+	TxKey string    `json:"txKey,omitempty"`
+	Time  time.Time `json:"time"`
+}
+
+// State is the nonce sequence of a Key as kept by a Store.
+type State struct {
+	// Synced is false until the sequence was read from Safeheron once.
+	Synced bool `json:"synced"`
+	// Next is the lowest nonce never handed out.
+	Next int64 `json:"next"`
+	// Free lists the nonces below Next whose transaction was never created or did
+	// not complete, in ascending order. They are gaps: the transactions above
+	// them are stuck until they are used.
+	Free    []int64       `json:"free,omitempty"`
+	Pending []Reservation `json:"pending,omitempty"`
+}
+
+// Store keeps the nonce sequences. Update must run fn atomically for a key,
+// across every process sharing the store, and only save the state when fn
+// returns nil.
+type Store interface {
+	Update(ctx context.Context, key Key, fn func(state *State) error) error
+}
+
+// MemoryStore is a Store for the goroutines of a single process.
+type MemoryStore struct {
+	mu     sync.Mutex
+	states map[Key]State
+}
+
+func (s *MemoryStore) Update(ctx context.Context, key Key, fn func(state *State) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := cloneState(s.states[key])
+	if err := fn(&state); err != nil {
+		return err
+	}
+	if s.states == nil {
+		s.states = map[Key]State{}
+	}
+	s.states[key] = state
+	return nil
+}
+
+func cloneState(state State) State {
+	state.Free = append([]int64(nil), state.Free...)
+	state.Pending = append([]Reservation(nil), state.Pending...)
+	return state
+}
+
+// FileStore is a Store keeping a JSON file per key in a directory, it can be
+// shared by the processes of a host. A key is locked with an advisory lock on
+// "<file>.lock", flock on unix and LockFileEx on windows, the system releases
+// the lock of a process that dies.
+type FileStore struct {
+	Dir string
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+func (s *FileStore) path(key Key) string {
+	return filepath.Join(s.Dir, unsafeFileChars.ReplaceAllString(key.AccountKey+"_"+key.Chain, "_")+".json")
+}
+
+func (s *FileStore) Update(ctx context.Context, key Key, fn func(state *State) error) error {
+	path := s.path(key)
+	unlock, err := s.lock(ctx, path+".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	var state State
+	data, err := os.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(data, &state)
+	} else if errors.Is(err, os.ErrNotExist) {
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := fn(&state); err != nil {
+		return err
+	}
+	if data, err = json.Marshal(state); err != nil {
+		return err
+	}
+	// Written to a temporary file first, a crash never leaves a cut state
+	tmp, err := os.CreateTemp(s.Dir, filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *FileStore) lock(ctx context.Context, path string) (func(), error) {
+	// The lock file is never removed, a process could lock a file another one
+	// just removed
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		locked, err := tryLockFile(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		if locked {
+			return func() {
+				unlockFile(file)
+				file.Close()
+			}, nil
+		}
+		select {
+		case <-ctx.Done():
+			file.Close()
+			return nil, ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
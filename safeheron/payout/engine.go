@@ -0,0 +1,362 @@
+package payout
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/api"
+)
+
+// RowError is a problem with one row of a payout file.
+type RowError struct {
+	Id  string
+	Err error
+}
+
+func (e RowError) Error() string {
+	return fmt.Sprintf("row %s: %s", e.Id, e.Err)
+}
+
+func (e RowError) Unwrap() error {
+	return e.Err
+}
+
+// InvalidBatchError lists the invalid rows of a batch, none of its rows is sent.
+type InvalidBatchError struct {
+	Rows []RowError
+}
+
+func (e *InvalidBatchError) Error() string {
+	messages := make([]string, 0, len(e.Rows))
+	for _, row := range e.Rows {
+		messages = append(messages, row.Error())
+	}
+	return fmt.Sprintf("%d invalid rows, %s", len(e.Rows), strings.Join(messages, "; "))
+}
+
+// Engine sends a batch of payouts with CreateTransactionsV3 and records the
+// progress of every row in a Journal. Every row is sent with the customerRefId
+// "<BatchId>-<Id>": running the same batch again, after a crash for example,
+// skips the rows already sent and resends the rows that may have been sent,
+// Safeheron returns their existing transaction with IdempotentRequest set.
+type Engine struct {
+	Transactions *api.TransactionApi
+	Journal      *Journal
+	// BatchId identifies the batch, use the same id to resume it.
+	BatchId           string
+	SourceAccountKey  string
+	SourceAccountType string
+	// TxFeeLevel is the fee level of every transaction, MIDDLE when not set.
+	TxFeeLevel string
+	// Concurrency is the number of rows sent, then waited for, at once, 4 when not set.
+	Concurrency int
+	// SkipWait reports the rows as soon as they are sent instead of waiting for
+	// the final status and fee of their transaction.
+	SkipWait    bool
+	WaitOptions api.WaitOptions
+}
+
+// ReportRow is the outcome of a payout row.
+type ReportRow struct {
+	Payout Payout
+	Entry
+}
+
+// Report is the outcome of a batch, in the order of its rows.
+type Report struct {
+	Rows []ReportRow
+}
+
+// Run validates every row, then sends the rows not sent yet and, once every
+// row is sent, waits for their transactions unless SkipWait is set. An
+// *InvalidBatchError is returned when a row is invalid or does not match the row
+// the journal recorded under its id, nothing is sent then. Rows that fail to be
+// sent are reported with StateError and sent again by the next Run. When ctx is
+// done Run stops, the journal tells the next Run where to resume.
+func (e *Engine) Run(ctx context.Context, payouts []Payout) (*Report, error) {
+	if err := e.Validate(ctx, payouts); err != nil {
+		return nil, err
+	}
+	if err := e.checkResume(payouts); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	report := &Report{Rows: make([]ReportRow, len(payouts))}
+	for i, payout := range payouts {
+		entry, ok := e.Journal.Entry(payout.Id)
+		if !ok {
+			entry = Entry{Id: payout.Id, CustomerRefId: e.customerRefId(payout)}
+		}
+		report.Rows[i] = ReportRow{Payout: payout, Entry: entry}
+	}
+	all := make([]int, len(payouts))
+	for i := range payouts {
+		all[i] = i
+	}
+	err := e.each(ctx, cancel, all, func(i int) error {
+		entry, err := e.submit(ctx, payouts[i])
+		report.Rows[i].Entry = entry
+		return err
+	})
+	if err != nil || ctx.Err() != nil || e.SkipWait {
+		if err != nil {
+			return report, err
+		}
+		return report, ctx.Err()
+	}
+
+	var submitted []int
+	for i, row := range report.Rows {
+		if row.State == StateSubmitted {
+			submitted = append(submitted, i)
+		}
+	}
+	err = e.each(ctx, cancel, submitted, func(i int) error {
+		entry, err := e.wait(ctx, report.Rows[i].Entry)
+		report.Rows[i].Entry = entry
+		return err
+	})
+	if err != nil {
+		return report, err
+	}
+	return report, ctx.Err()
+}
+
+// each calls fn for the rows at the given indexes, Concurrency at a time. The
+// first error cancels the others and is returned.
+func (e *Engine) each(ctx context.Context, cancel context.CancelFunc, indexes []int, fn func(i int) error) error {
+	concurrency := e.Concurrency
+	if concurrency <= 0 {
+		concurrency = 4
+	}
+	var (
+		wg       sync.WaitGroup
+		errMu    sync.Mutex
+		firstErr error
+	)
+	rows := make(chan int)
+	for worker := 0; worker < concurrency; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range rows {
+				if err := fn(i); err != nil {
+					errMu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					errMu.Unlock()
+					cancel()
+				}
+			}
+		}()
+	}
+send:
+	for _, i := range indexes {
+		select {
+		case rows <- i:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(rows)
+	wg.Wait()
+	return firstErr
+}
+
+// checkResume compares the rows with the journal of a batch resumed: every row
+// needs an explicit id, and the rows recorded must pay the same coin, amount
+// and destination as when they were sent.
+func (e *Engine) checkResume(payouts []Payout) error {
+	if e.Journal.Len() == 0 {
+		return nil
+	}
+	var invalid []RowError
+	for _, payout := range payouts {
+		if payout.numbered {
+			invalid = append(invalid, RowError{Id: payout.Id, Err: errors.New("an explicit id is required to resume a batch, the row number changes when rows are added or removed")})
+			continue
+		}
+		entry, ok := e.Journal.Entry(payout.Id)
+		if ok && entry.Digest != "" && entry.Digest != payout.digest() {
+			invalid = append(invalid, RowError{Id: payout.Id, Err: fmt.Errorf("coin, amount or destination changed since the row was sent as %s", entry.CustomerRefId)})
+		}
+	}
+	if len(invalid) > 0 {
+		return &InvalidBatchError{Rows: invalid}
+	}
+	return nil
+}
+
+// Validate checks every row without sending anything. It returns an
+// *InvalidBatchError listing the invalid rows. Rows are validated against the
+// metadata of their coin when Transactions has a CoinRegistry.
+func (e *Engine) Validate(ctx context.Context, payouts []Payout) error {
+	var invalid []RowError
+	seen := map[string]bool{}
+	for _, payout := range payouts {
+		if seen[payout.Id] {
+			invalid = append(invalid, RowError{Id: payout.Id, Err: errors.New("duplicate id")})
+			continue
+		}
+		seen[payout.Id] = true
+		if err := e.validate(ctx, payout); err != nil {
+			invalid = append(invalid, RowError{Id: payout.Id, Err: err})
+		}
+	}
+	if len(invalid) > 0 {
+		return &InvalidBatchError{Rows: invalid}
+	}
+	return nil
+}
+
+func (e *Engine) validate(ctx context.Context, payout Payout) error {
+	if customerRefId := e.customerRefId(payout); len(customerRefId) > api.MaxCustomerRefIdLength {
+		return fmt.Errorf("customerRefId %s is longer than %d characters", customerRefId, api.MaxCustomerRefIdLength)
+	}
+	request := e.request(payout)
+	if e.Transactions.Coins != nil {
+		coin, err := e.Transactions.Coins.CoinCtx(ctx, payout.CoinKey)
+		if err != nil {
+			return err
+		}
+		return request.Validate(coin)
+	}
+	if payout.CoinKey == "" {
+		return errors.New("coinKey is required")
+	}
+	if amount, err := api.ParseAmount(payout.Amount); err != nil || amount.Sign() <= 0 {
+		return fmt.Errorf("amount %q is not a positive decimal number", payout.Amount)
+	}
+	if payout.DestinationAddress == "" && payout.DestinationAccountKey == "" {
+		return errors.New("destinationAddress or destinationAccountKey is required")
+	}
+	return nil
+}
+
+func (e *Engine) customerRefId(payout Payout) string {
+	return e.BatchId + "-" + payout.Id
+}
+
+func (e *Engine) request(payout Payout) api.CreateTransactionsRequest {
+	sourceAccountType := e.SourceAccountType
+	if sourceAccountType == "" {
+		sourceAccountType = "VAULT_ACCOUNT"
+	}
+	txFeeLevel := e.TxFeeLevel
+	if txFeeLevel == "" {
+		txFeeLevel = "MIDDLE"
+	}
+	destinationAccountType := payout.DestinationAccountType
+	if destinationAccountType == "" {
+		destinationAccountType = "ONE_TIME_ADDRESS"
+	}
+	return api.CreateTransactionsRequest{
+		CustomerRefId:          e.customerRefId(payout),
+		CoinKey:                payout.CoinKey,
+		TxFeeLevel:             txFeeLevel,
+		TxAmount:               payout.Amount,
+		SourceAccountKey:       e.SourceAccountKey,
+		SourceAccountType:      sourceAccountType,
+		DestinationAccountKey:  payout.DestinationAccountKey,
+		DestinationAccountType: destinationAccountType,
+		DestinationAddress:     payout.DestinationAddress,
+		Memo:                   payout.Memo,
+		Note:                   payout.Note,
+	}
+}
+
+// submit sends a row unless the journal has its transaction. Only journal
+// failures are returned, failures of the row are in the entry.
+func (e *Engine) submit(ctx context.Context, payout Payout) (Entry, error) {
+	customerRefId := e.customerRefId(payout)
+	entry, ok := e.Journal.Entry(payout.Id)
+	if ok && entry.CustomerRefId != customerRefId {
+		return entry, fmt.Errorf("row %s was sent as %s, not %s, by another batch", payout.Id, entry.CustomerRefId, customerRefId)
+	}
+	if ok && entry.State != StateSubmitting && entry.State != StateError {
+		return entry, nil
+	}
+	entry = Entry{Id: payout.Id, CustomerRefId: customerRefId, Digest: payout.digest(), State: StateSubmitting}
+	if err := e.Journal.Record(entry); err != nil {
+		return entry, err
+	}
+	var res api.CreateTransactionV3Response
+	if err := e.Transactions.CreateTransactionsV3Ctx(ctx, e.request(payout), &res); err != nil {
+		if ctx.Err() != nil {
+			// Left SUBMITTING for the next run
+			return entry, nil
+		}
+		entry.State, entry.Error = StateError, err.Error()
+		return entry, e.Journal.Record(entry)
+	}
+	entry.State, entry.TxKey, entry.IdempotentRequest = StateSubmitted, res.TxKey, res.IdempotentRequest
+	return entry, e.Journal.Record(entry)
+}
+
+// wait waits for the transaction of a submitted row. Only journal failures are
+// returned, failures of the row are in the entry.
+func (e *Engine) wait(ctx context.Context, entry Entry) (Entry, error) {
+	var tx api.OneTransactionsResponse
+	err := e.Transactions.WaitForTransaction(ctx, api.OneTransactionsRequest{TxKey: entry.TxKey}, &tx, e.WaitOptions)
+	var failed *api.TransactionFailedError
+	if err != nil && !errors.As(err, &failed) {
+		if ctx.Err() == nil {
+			entry.Error = err.Error()
+		}
+		return entry, nil
+	}
+	entry.State, entry.Error = StateFinished, ""
+	entry.TransactionStatus, entry.TransactionSubStatus = tx.TransactionStatus, tx.TransactionSubStatus
+	entry.TxFee, entry.FeeCoinKey = tx.TxFee, tx.FeeCoinKey
+	return entry, e.Journal.Record(entry)
+}
+
+// Failed returns the rows that were not sent or did not complete.
+func (r *Report) Failed() []ReportRow {
+	var failed []ReportRow
+	for _, row := range r.Rows {
+		if row.State == StateError || (row.State == StateFinished && !row.TransactionStatus.IsSuccess()) {
+			failed = append(failed, row)
+		}
+	}
+	return failed
+}
+
+// TotalFees sums the fees of the finished rows by fee coin.
+func (r *Report) TotalFees() (map[string]api.Amount, error) {
+	totals := map[string]api.Amount{}
+	for _, row := range r.Rows {
+		if row.TxFee == "" {
+			continue
+		}
+		fee, err := api.ParseAmount(row.TxFee)
+		if err != nil {
+			return nil, fmt.Errorf("row %s: %w", row.Id, err)
+		}
+		totals[row.FeeCoinKey] = totals[row.FeeCoinKey].Add(fee)
+	}
+	return totals, nil
+}
+
+// WriteCSV writes the report as CSV with a header row.
+func (r *Report) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"id", "customerRefId", "coinKey", "amount", "destinationAddress", "destinationAccountKey",
+		"state", "txKey", "idempotentRequest", "transactionStatus", "transactionSubStatus", "txFee", "feeCoinKey", "error"})
+	for _, row := range r.Rows {
+		writer.Write([]string{row.Payout.Id, row.CustomerRefId, row.Payout.CoinKey, row.Payout.Amount, row.Payout.DestinationAddress,
+			row.Payout.DestinationAccountKey, string(row.State), row.TxKey, strconv.FormatBool(row.IdempotentRequest),
+			string(row.TransactionStatus), string(row.TransactionSubStatus), row.TxFee, row.FeeCoinKey, row.Error})
+	}
+	writer.Flush()
+	return writer.Error()
+}
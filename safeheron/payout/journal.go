@@ -0,0 +1,138 @@
+package payout
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/api"
+)
+
+// State is the progress of a payout row recorded in the journal.
+type State string
+
+const (
+	// StateSubmitting is recorded before the create request is sent. A row left in
+	// it by a crash may or may not have a transaction, it is sent again with the
+	// same customerRefId and Safeheron returns the existing one.
+	StateSubmitting State = "SUBMITTING"
+	// StateSubmitted rows have a transaction, they are never sent again.
+	StateSubmitted State = "SUBMITTED"
+	// StateError rows failed to be sent, they are sent again on the next run.
+	StateError State = "ERROR"
+	// StateFinished rows have a transaction in a terminal status.
+	StateFinished State = "FINISHED"
+)
+
+// Entry is the state of a payout row, the journal keeps the last entry of every row.
+type Entry struct {
+	Id            string `json:"id"`
+	CustomerRefId string `json:"customerRefId"`
+	// Digest is a hash of the coin, amount and destination the row was sent with.
+	Digest               string                   `json:"digest,omitempty"`
+	State                State                    `json:"state"`
+	TxKey                string                   `json:"txKey,omitempty"`
+	IdempotentRequest    bool                     `json:"idempotentRequest,omitempty"`
+	TransactionStatus    api.TransactionStatus    `json:"transactionStatus,omitempty"`
+	TransactionSubStatus api.TransactionSubStatus `json:"transactionSubStatus,omitempty"`
+	TxFee                string                   `json:"txFee,omitempty"`
+	FeeCoinKey           string                   `json:"feeCoinKey,omitempty"`
+	Error                string                   `json:"error,omitempty"`
+	Time                 time.Time                `json:"time"`
+}
+
+// Journal persists the state of the rows of a batch in a file with one JSON entry
+// per line. Every entry is synced to disk before Record returns, so that a run
+// resumed after a crash knows every row that may have been sent.
+type Journal struct {
+	mu      sync.Mutex
+	file    *os.File
+	entries map[string]Entry
+}
+
+// OpenJournal opens or creates the journal file at path and loads its entries.
+// A last line cut short by a crash is ignored.
+func OpenJournal(path string) (*Journal, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	entries := map[string]Entry{}
+	size := int64(len(data))
+	lines := bytes.Split(data, []byte("\n"))
+	for i, line := range lines {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			if i == len(lines)-1 {
+				size -= int64(len(line))
+				break
+			}
+			return nil, fmt.Errorf("journal %s line %d: %w", path, i+1, err)
+		}
+		entries[entry.Id] = entry
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if size < int64(len(data)) {
+		// Drop the cut line
+		if err := file.Truncate(size); err != nil {
+			file.Close()
+			return nil, err
+		}
+	} else if size > 0 && data[size-1] != '\n' {
+		if _, err := file.Write([]byte("\n")); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return &Journal{file: file, entries: entries}, nil
+}
+
+// Record appends an entry and syncs it to disk.
+func (j *Journal) Record(entry Entry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := j.file.Sync(); err != nil {
+		return err
+	}
+	j.entries[entry.Id] = entry
+	return nil
+}
+
+// Entry returns the last entry of a row.
+func (j *Journal) Entry(id string) (Entry, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	entry, ok := j.entries[id]
+	return entry, ok
+}
+
+// Len returns the number of rows in the journal.
+func (j *Journal) Len() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return len(j.entries)
+}
+
+// Close closes the journal file.
+func (j *Journal) Close() error {
+	return j.file.Close()
+}
@@ -0,0 +1,128 @@
+package payout
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Payout is one row of a payout file. CSV files have a header row naming the
+// columns with the JSON names below, in any order.
+type Payout struct {
+	// Id identifies the row within its batch and is part of its customerRefId, so
+	// it must not change between runs. It defaults to the row number, a batch
+	// with a journal can only be resumed with explicit ids.
+	Id                     string `json:"id"`
+	CoinKey                string `json:"coinKey"`
+	Amount                 string `json:"amount"`
+	DestinationAccountType string `json:"destinationAccountType"`
+	DestinationAccountKey  string `json:"destinationAccountKey"`
+	DestinationAddress     string `json:"destinationAddress"`
+	Memo                   string `json:"memo"`
+	Note                   string `json:"note"`
+
+	// numbered is set when Id is the row number, it then changes when rows are
+	// added or removed and can not be used to resume a batch.
+	numbered bool
+}
+
+// digest identifies what a row pays: its coin, amount and destination. It is
+// recorded in the journal to refuse resuming a batch whose rows were changed.
+func (p Payout) digest() string {
+	hash := sha256.New()
+	for _, field := range []string{p.CoinKey, p.Amount, p.DestinationAccountType, p.DestinationAccountKey, p.DestinationAddress, p.Memo} {
+		// Length prefixed, fields can not run into each other
+		fmt.Fprintf(hash, "%d:%s", len(field), field)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// ReadFile reads a payout file, a CSV file or, with the .json extension, a JSON array.
+func ReadFile(path string) ([]Payout, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return ReadJSON(file)
+	}
+	return ReadCSV(file)
+}
+
+// ReadCSV reads payouts from CSV with a header row.
+func ReadCSV(r io.Reader) ([]Payout, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("payout file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+	setters := make([]func(*Payout, string), len(header))
+	for i, column := range header {
+		setter, ok := columns[strings.TrimSpace(column)]
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q", column)
+		}
+		setters[i] = setter
+	}
+	var payouts []Payout
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var payout Payout
+		for i, value := range record {
+			setters[i](&payout, strings.TrimSpace(value))
+		}
+		payouts = append(payouts, payout)
+	}
+	return withDefaultIds(payouts), nil
+}
+
+var columns = map[string]func(*Payout, string){
+	"id":                     func(p *Payout, v string) { p.Id = v },
+	"coinKey":                func(p *Payout, v string) { p.CoinKey = v },
+	"amount":                 func(p *Payout, v string) { p.Amount = v },
+	"destinationAccountType": func(p *Payout, v string) { p.DestinationAccountType = v },
+	"destinationAccountKey":  func(p *Payout, v string) { p.DestinationAccountKey = v },
+	"destinationAddress":     func(p *Payout, v string) { p.DestinationAddress = v },
+	"memo":                   func(p *Payout, v string) { p.Memo = v },
+	"note":                   func(p *Payout, v string) { p.Note = v },
+}
+
+// ReadJSON reads payouts from a JSON array.
+func ReadJSON(r io.Reader) ([]Payout, error) {
+	var payouts []Payout
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&payouts); err != nil {
+		return nil, err
+	}
+	return withDefaultIds(payouts), nil
+}
+
+// withDefaultIds numbers the rows without id from 1.
+func withDefaultIds(payouts []Payout) []Payout {
+	for i := range payouts {
+		if payouts[i].Id == "" {
+			payouts[i].Id, payouts[i].numbered = strconv.Itoa(i+1), true
+		}
+	}
+	return payouts
+}
@@ -0,0 +1,428 @@
+package payout
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/api"
+)
+
+// UTXOPlanner splits payouts of a UTXO coin into CreateTransactionsUTXOMultiDest
+// requests and tracks them as one batch.
+//
+// A transaction pays once for its inputs, change and overhead, whatever its
+// number of destinations. The planner therefore merges payouts to the same
+// address and uses as few transactions as MaxOutputs allows, with balanced sizes.
+// Payouts with a memo are grouped by memo, DestinationTag is set per transaction.
+// The fee of every transaction is set by Strategy from TransactionFeeRate.
+type UTXOPlanner struct {
+	Transactions *api.TransactionApi
+	// BatchId prefixes the customerRefIds, "<BatchId>-1" for the first transaction.
+	BatchId           string
+	CoinKey           string
+	SourceAccountKey  string
+	SourceAccountType string
+	// MaxOutputs is the most destinations of a transaction, 50 when not set.
+	MaxOutputs int
+	Strategy   api.FeeStrategy
+	// PlanPath persists the digest of the batch submitted, see UTXOBatch.Digest.
+	// Submit refuses a batch planned again from changed payouts, the transactions
+	// sent before under the same customerRefIds would not match it. Not checked
+	// when empty.
+	PlanPath string
+}
+
+// ErrPlanChanged is returned by Submit when the batch does not match the batch
+// submitted before under the same customerRefIds.
+var ErrPlanChanged = errors.New("the batch does not match the batch submitted before")
+
+// UTXOTransaction is a transaction of a UTXOBatch.
+type UTXOTransaction struct {
+	Request api.CreateTransactionsUTXOMultiDestRequest
+	// PayoutIds lists the payouts of every destination of Request, several when
+	// payouts to the same address were merged.
+	PayoutIds [][]string
+	// EstimatedFee is the fee estimated by TransactionFeeRate when planning.
+	EstimatedFee api.Amount
+
+	// TxKey is set once the transaction is sent.
+	TxKey                string
+	TransactionStatus    api.TransactionStatus
+	TransactionSubStatus api.TransactionSubStatus
+	TxFee                string
+}
+
+// UTXOBatch is the set of transactions planned for a list of payouts.
+type UTXOBatch struct {
+	BatchId      string
+	CoinKey      string
+	Transactions []UTXOTransaction
+}
+
+// Plan validates the payouts and splits them into transactions. The plan only
+// depends on the payouts and their order, planning the same payouts again after
+// a crash gives the same customerRefIds and Submit does not pay twice. Set
+// PlanPath to have Submit refuse a plan made from changed payouts.
+func (p *UTXOPlanner) Plan(ctx context.Context, payouts []Payout) (*UTXOBatch, error) {
+	coin := api.Coin{CoinKey: p.CoinKey, IsUtxo: "1"}
+	if p.Transactions.Coins != nil {
+		var err error
+		if coin, err = p.Transactions.Coins.CoinCtx(ctx, p.CoinKey); err != nil {
+			return nil, err
+		}
+		if !coin.UtxoBased() {
+			return nil, fmt.Errorf("%s is not a UTXO coin", p.CoinKey)
+		}
+	}
+	if err := p.validate(payouts, coin); err != nil {
+		return nil, err
+	}
+
+	type output struct {
+		address string
+		memo    string
+		amount  api.Amount
+		ids     []string
+	}
+	type group struct {
+		outputs   []*output
+		byAddress map[string]*output
+	}
+	groups := map[string]*group{}
+	var memos []string
+	for _, payout := range payouts {
+		g, ok := groups[payout.Memo]
+		if !ok {
+			g = &group{byAddress: map[string]*output{}}
+			groups[payout.Memo] = g
+			memos = append(memos, payout.Memo)
+		}
+		amount, _ := api.ParseAmount(payout.Amount)
+		if o, ok := g.byAddress[payout.DestinationAddress]; ok {
+			o.amount, o.ids = o.amount.Add(amount), append(o.ids, payout.Id)
+			continue
+		}
+		o := &output{address: payout.DestinationAddress, memo: payout.Memo, amount: amount, ids: []string{payout.Id}}
+		g.outputs = append(g.outputs, o)
+		g.byAddress[payout.DestinationAddress] = o
+	}
+
+	maxOutputs := p.MaxOutputs
+	if maxOutputs <= 0 {
+		maxOutputs = 50
+	}
+	sourceAccountType := p.SourceAccountType
+	if sourceAccountType == "" {
+		sourceAccountType = "VAULT_ACCOUNT"
+	}
+	batch := &UTXOBatch{BatchId: p.BatchId, CoinKey: p.CoinKey}
+	for _, memo := range memos {
+		outputs := groups[memo].outputs
+		count := (len(outputs) + maxOutputs - 1) / maxOutputs
+		for i := 0; i < count; i++ {
+			// The first len%count transactions take one more output
+			size, start := len(outputs)/count, i*(len(outputs)/count)
+			if extra := len(outputs) % count; i < extra {
+				size, start = size+1, start+i
+			} else {
+				start += extra
+			}
+			transaction := UTXOTransaction{Request: api.CreateTransactionsUTXOMultiDestRequest{
+				CustomerRefId:     fmt.Sprintf("%s-%d", p.BatchId, len(batch.Transactions)+1),
+				CoinKey:           p.CoinKey,
+				SourceAccountKey:  p.SourceAccountKey,
+				SourceAccountType: sourceAccountType,
+				DestinationTag:    memo,
+			}}
+			for _, o := range outputs[start : start+size] {
+				transaction.Request.DestinationAddressList = append(transaction.Request.DestinationAddressList,
+					api.DestinationAddress{Address: o.address, Memo: o.memo, Amount: o.amount.String()})
+				transaction.PayoutIds = append(transaction.PayoutIds, o.ids)
+			}
+			estimate, err := p.Transactions.EstimateFee(ctx, api.TransactionsFeeRateRequest{
+				CoinKey:                p.CoinKey,
+				SourceAccountKey:       p.SourceAccountKey,
+				DestinationAddressList: transaction.Request.DestinationAddressList,
+			}, coin, p.Strategy)
+			if err != nil {
+				return nil, err
+			}
+			estimate.ApplyUTXOMultiDest(&transaction.Request)
+			transaction.EstimatedFee = estimate.Fee
+			batch.Transactions = append(batch.Transactions, transaction)
+		}
+	}
+	return batch, nil
+}
+
+func (p *UTXOPlanner) validate(payouts []Payout, coin api.Coin) error {
+	var invalid []RowError
+	seen := map[string]bool{}
+	for _, payout := range payouts {
+		var err error
+		amount, parseErr := api.ParseAmount(payout.Amount)
+		switch {
+		case seen[payout.Id]:
+			err = errors.New("duplicate id")
+		case payout.CoinKey != "" && payout.CoinKey != p.CoinKey:
+			err = fmt.Errorf("coinKey %s is not the coin of the batch %s", payout.CoinKey, p.CoinKey)
+		case payout.DestinationAddress == "":
+			err = errors.New("destinationAddress is required")
+		case payout.DestinationAccountKey != "" || (payout.DestinationAccountType != "" && payout.DestinationAccountType != "ONE_TIME_ADDRESS"):
+			err = errors.New("only destination addresses are supported")
+		case parseErr != nil || amount.Sign() <= 0:
+			err = fmt.Errorf("amount %q is not a positive decimal number", payout.Amount)
+		}
+		if err == nil && p.Transactions.Coins != nil {
+			if _, precisionErr := coin.ToMinimalUnits(amount); precisionErr != nil {
+				err = fmt.Errorf("amount %s has more than %d decimal places", payout.Amount, coin.CoinDecimal)
+			} else if minimum, _ := coin.MinTransferAmountValue(); amount.Cmp(minimum) < 0 {
+				err = fmt.Errorf("amount %s is below the minimum transfer amount %s", payout.Amount, coin.MinTransferAmount)
+			}
+		}
+		seen[payout.Id] = true
+		if err != nil {
+			invalid = append(invalid, RowError{Id: payout.Id, Err: err})
+		}
+	}
+	if len(invalid) > 0 {
+		return &InvalidBatchError{Rows: invalid}
+	}
+	return nil
+}
+
+// Submit sends the transactions of the batch not sent yet. A transaction rejected
+// because its customerRefId already exists, safeheron.IsDuplicateCustomerRefId,
+// sent before a crash for example, is looked up instead and adopted only when it
+// pays the same destinations and amounts, Submit fails with ErrPlanChanged
+// otherwise. Any other rejection fails Submit, as does a transaction sent before
+// when ApiConfig.ErrorCodes.DuplicateCustomerRefId is not set.
+func (p *UTXOPlanner) Submit(ctx context.Context, batch *UTXOBatch) error {
+	if err := p.checkPlan(batch); err != nil {
+		return err
+	}
+	for i := range batch.Transactions {
+		transaction := &batch.Transactions[i]
+		if transaction.TxKey != "" {
+			continue
+		}
+		var result api.TxKeyResult
+		err := p.Transactions.CreateTransactionsUTXOMultiDestCtx(ctx, transaction.Request, &result)
+		if safeheron.IsDuplicateCustomerRefId(err) {
+			// Sent before
+			var existing api.OneTransactionsResponse
+			if err = p.Transactions.OneTransactionsCtx(ctx, api.OneTransactionsRequest{CustomerRefId: transaction.Request.CustomerRefId}, &existing); err == nil {
+				if !sameOutputs(existing, transaction.Request) {
+					return fmt.Errorf("transaction %s: %w, %s pays other destinations or amounts", transaction.Request.CustomerRefId, ErrPlanChanged, existing.TxKey)
+				}
+				result.TxKey = existing.TxKey
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("transaction %s: %w", transaction.Request.CustomerRefId, err)
+		}
+		transaction.TxKey = result.TxKey
+		transaction.TransactionStatus = api.TransactionStatusSubmitted
+	}
+	return nil
+}
+
+// sameOutputs reports whether an existing transaction pays what request does.
+func sameOutputs(existing api.OneTransactionsResponse, request api.CreateTransactionsUTXOMultiDestRequest) bool {
+	if existing.CoinKey != request.CoinKey || existing.SourceAccountKey != request.SourceAccountKey ||
+		len(existing.DestinationAddressList) != len(request.DestinationAddressList) {
+		return false
+	}
+	// By address, amounts are compared as numbers, the API may return them with another number of decimal places
+	amounts := func(destinations []api.DestinationAddress) (map[string]api.Amount, bool) {
+		byAddress := map[string]api.Amount{}
+		for _, destination := range destinations {
+			amount, err := api.ParseAmount(destination.Amount)
+			if err != nil {
+				return nil, false
+			}
+			byAddress[destination.Address] = byAddress[destination.Address].Add(amount)
+		}
+		return byAddress, true
+	}
+	existingAmounts, ok := amounts(existing.DestinationAddressList)
+	if !ok {
+		return false
+	}
+	requestAmounts, ok := amounts(request.DestinationAddressList)
+	if !ok || len(existingAmounts) != len(requestAmounts) {
+		return false
+	}
+	for address, amount := range requestAmounts {
+		if existingAmount, ok := existingAmounts[address]; !ok || existingAmount.Cmp(amount) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Digest identifies what the batch pays: the customerRefId, source, memo,
+// destinations and amounts of every transaction. Fees are left out, they
+// depend on the fee rates when planning.
+func (b *UTXOBatch) Digest() string {
+	hash := sha256.New()
+	write := func(field string) {
+		// Length prefixed, fields can not run into each other
+		fmt.Fprintf(hash, "%d:%s", len(field), field)
+	}
+	write(b.CoinKey)
+	for _, transaction := range b.Transactions {
+		request := transaction.Request
+		write(request.CustomerRefId)
+		write(request.SourceAccountKey)
+		write(request.DestinationTag)
+		fmt.Fprintf(hash, "%d", len(request.DestinationAddressList))
+		for _, destination := range request.DestinationAddressList {
+			write(destination.Address)
+			write(destination.Memo)
+			write(destination.Amount)
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+type utxoPlan struct {
+	BatchId string `json:"batchId"`
+	Digest  string `json:"digest"`
+}
+
+// checkPlan compares the batch with the digest at PlanPath, and records it
+// before the first transaction is sent.
+func (p *UTXOPlanner) checkPlan(batch *UTXOBatch) error {
+	if p.PlanPath == "" {
+		return nil
+	}
+	plan := utxoPlan{BatchId: batch.BatchId, Digest: batch.Digest()}
+	data, err := os.ReadFile(p.PlanPath)
+	if err == nil {
+		var recorded utxoPlan
+		if err := json.Unmarshal(data, &recorded); err != nil {
+			return fmt.Errorf("plan %s: %w", p.PlanPath, err)
+		}
+		if recorded != plan {
+			return fmt.Errorf("%w, plan %s was recorded for batch %s", ErrPlanChanged, p.PlanPath, recorded.BatchId)
+		}
+		return nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if data, err = json.Marshal(plan); err != nil {
+		return err
+	}
+	// Written to a temporary file first, a crash never leaves a cut plan
+	tmp, err := os.CreateTemp(filepath.Dir(p.PlanPath), filepath.Base(p.PlanPath)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p.PlanPath)
+}
+
+// Refresh polls the status of every sent transaction not in a terminal status.
+func (p *UTXOPlanner) Refresh(ctx context.Context, batch *UTXOBatch) error {
+	for i := range batch.Transactions {
+		transaction := &batch.Transactions[i]
+		if transaction.TxKey == "" || transaction.TransactionStatus.IsTerminal() {
+			continue
+		}
+		var tx api.OneTransactionsResponse
+		if err := p.Transactions.OneTransactionsCtx(ctx, api.OneTransactionsRequest{TxKey: transaction.TxKey}, &tx); err != nil {
+			return err
+		}
+		transaction.update(tx)
+	}
+	return nil
+}
+
+// Wait waits until every sent transaction reaches a terminal status. Transactions
+// that did not complete are returned by Failed, they are not an error of Wait.
+func (p *UTXOPlanner) Wait(ctx context.Context, batch *UTXOBatch, opts api.WaitOptions) error {
+	for i := range batch.Transactions {
+		transaction := &batch.Transactions[i]
+		if transaction.TxKey == "" || transaction.TransactionStatus.IsTerminal() {
+			continue
+		}
+		var tx api.OneTransactionsResponse
+		err := p.Transactions.WaitForTransaction(ctx, api.OneTransactionsRequest{TxKey: transaction.TxKey}, &tx, opts)
+		var failed *api.TransactionFailedError
+		if err != nil && !errors.As(err, &failed) {
+			return err
+		}
+		transaction.update(tx)
+	}
+	return nil
+}
+
+func (t *UTXOTransaction) update(tx api.OneTransactionsResponse) {
+	t.TransactionStatus, t.TransactionSubStatus, t.TxFee = tx.TransactionStatus, tx.TransactionSubStatus, tx.TxFee
+}
+
+// Done reports whether every transaction was sent and reached a terminal status.
+func (b *UTXOBatch) Done() bool {
+	for _, transaction := range b.Transactions {
+		if transaction.TxKey == "" || !transaction.TransactionStatus.IsTerminal() {
+			return false
+		}
+	}
+	return true
+}
+
+// Failed returns the transactions that ended without completing.
+func (b *UTXOBatch) Failed() []UTXOTransaction {
+	var failed []UTXOTransaction
+	for _, transaction := range b.Transactions {
+		if transaction.TransactionStatus.IsTerminal() && !transaction.TransactionStatus.IsSuccess() {
+			failed = append(failed, transaction)
+		}
+	}
+	return failed
+}
+
+// EstimatedFee sums the fees estimated when planning.
+func (b *UTXOBatch) EstimatedFee() api.Amount {
+	var total api.Amount
+	for _, transaction := range b.Transactions {
+		total = total.Add(transaction.EstimatedFee)
+	}
+	return total
+}
+
+// TotalFee sums the fees of the transactions, as reported by Refresh or Wait.
+func (b *UTXOBatch) TotalFee() (api.Amount, error) {
+	var total api.Amount
+	for _, transaction := range b.Transactions {
+		if transaction.TxFee == "" {
+			continue
+		}
+		fee, err := api.ParseAmount(transaction.TxFee)
+		if err != nil {
+			return api.Amount{}, fmt.Errorf("transaction %s: %w", transaction.TxKey, err)
+		}
+		total = total.Add(fee)
+	}
+	return total, nil
+}
@@ -0,0 +1,175 @@
+package safeheron
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"math/rand"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RetryPolicy controls how Client retries failed requests.
+//
+// Read-only endpoints are retried freely. Endpoints that create or change
+// something (transactions, MPC signs, web3 signs, ...) are only retried when
+// the request carries a customerRefId, Safeheron deduplicates on it so a retry
+// can never produce a second transaction. A retried CreateTransactionsV3 reports
+// a deduplicated request through CreateTransactionV3Response.IdempotentRequest,
+// older create endpoints may be rejected with an API error instead (IsRejected),
+// in which case the transaction should be looked up by customerRefId.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one. Default: 3
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry. Default: 200ms
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait between two attempts. Default: 5s
+	MaxBackoff time.Duration
+	// Multiplier grows the backoff after every attempt. Default: 2
+	Multiplier float64
+	// Jitter randomizes every backoff by up to this fraction of it, between 0 and 1.
+	Jitter float64
+	// Retryable decides whether an error is worth another attempt. Default: DefaultRetryable
+	Retryable func(err error) bool
+}
+
+// DefaultRetryPolicy returns the policy used by the SDK defaults.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 200 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+}
+
+// DefaultRetryable retries transport failures, 5xx responses and rate limiting.
+func DefaultRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if IsRateLimited(err) {
+		return true
+	}
+	var e *SafeheronError
+	if !errors.As(err, &e) {
+		return false
+	}
+	return e.transport || e.HttpStatus >= http.StatusInternalServerError
+}
+
+func (p *RetryPolicy) maxAttempts() int {
+	if p.MaxAttempts <= 0 {
+		return 3
+	}
+	return p.MaxAttempts
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return DefaultRetryable(err)
+}
+
+// backoff returns the wait after the given failed attempt, starting at 1.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	initial, maxBackoff, multiplier := p.InitialBackoff, p.MaxBackoff, p.Multiplier
+	if initial <= 0 {
+		initial = 200 * time.Millisecond
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = 5 * time.Second
+	}
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	d := float64(initial) * math.Pow(multiplier, float64(attempt-1))
+	if d > float64(maxBackoff) {
+		d = float64(maxBackoff)
+	}
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
+
+func (c Client) executeWithRetry(ctx context.Context, request any, endpoint string) ([]byte, error) {
+	policy := c.Config.RetryPolicy
+	if policy == nil || !canRetry(request, endpoint) {
+		return c.execute(ctx, request, endpoint)
+	}
+	for attempt := 1; ; attempt++ {
+		respContent, err := c.execute(ctx, request, endpoint)
+		if err == nil || attempt >= policy.maxAttempts() || !policy.retryable(err) {
+			return respContent, err
+		}
+		wait := policy.backoff(attempt)
+		log.Warnf("request %s failed on attempt %d, retrying in %s: %s", endpoint, attempt, wait, err.Error())
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+	}
+}
+
+// readOnlyEndpoints lists the endpoints that never change state on Safeheron.
+var readOnlyEndpoints = map[string]bool{
+	"/v1/account/list":                true,
+	"/v1/account/one":                 true,
+	"/v1/account/getByAddress":        true,
+	"/v1/account/coin/list":           true,
+	"/v1/account/coin/address/list":   true,
+	"/v1/account/coin/address/info":   true,
+	"/v1/account/coin/balance":        true,
+	"/v1/coin/list":                   true,
+	"/v1/coin/maintain/list":          true,
+	"/v1/coin/address/check":          true,
+	"/v1/coin/balance/snapshot":       true,
+	"/v1/coin/block/height":           true,
+	"/v1/compliance/kyt/report":       true,
+	"/v1/gas/status":                  true,
+	"/v1/gas/transactions/getByTxKey": true,
+	"/v1/tools/aml-checker/retrieves": true,
+	"/v1/transactions/list":           true,
+	"/v2/transactions/list":           true,
+	"/v1/transactions/one":            true,
+	"/v1/transactions/approvalDetail": true,
+	"/v2/transactions/getFeeRate":     true,
+	"/v1/transactions/mpcsign/one":    true,
+	"/v1/transactions/mpcsign/list":   true,
+	"/v1/web3/account/list":           true,
+	"/v1/web3/account/one":            true,
+	"/v1/web3/sign/one":               true,
+	"/v1/web3/sign/list":              true,
+	"/v1/whitelist/one":               true,
+	"/v1/whitelist/list":              true,
+}
+
+// canRetry reports whether sending the request twice is harmless.
+func canRetry(request any, endpoint string) bool {
+	if readOnlyEndpoints[endpoint] {
+		return true
+	}
+	if request == nil {
+		return false
+	}
+	payLoad, err := json.Marshal(request)
+	if err != nil {
+		return false
+	}
+	var fields struct {
+		CustomerRefId string `json:"customerRefId"`
+	}
+	if err := json.Unmarshal(payLoad, &fields); err != nil {
+		return false
+	}
+	return fields.CustomerRefId != ""
+}
@@ -0,0 +1,36 @@
+// Package safeherontest provides fakes for testing code built on the SDK
+// without Safeheron credentials or network access.
+package safeherontest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+)
+
+// KeyPair is a generated RSA key pair, PEM encoded.
+type KeyPair struct {
+	PrivateKeyPem []byte
+	PublicKeyPem  []byte
+}
+
+// GenerateKeyPair generates a 2048 bit RSA key pair, like the ones used by Safeheron.
+func GenerateKeyPair() (KeyPair, error) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return KeyPair{}, err
+	}
+	privateDer, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return KeyPair{}, err
+	}
+	publicDer, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		return KeyPair{}, err
+	}
+	return KeyPair{
+		PrivateKeyPem: pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDer}),
+		PublicKeyPem:  pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDer}),
+	}, nil
+}
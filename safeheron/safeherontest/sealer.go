@@ -0,0 +1,133 @@
+package safeherontest
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/cosigner"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/utils"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/webhook"
+)
+
+// SealMode selects how the AES key and the content of an envelope are encrypted.
+type SealMode string
+
+const (
+	// SealOAEPGCM encrypts the AES key with RSA OAEP and the content with AES GCM,
+	// the mode Safeheron uses today.
+	SealOAEPGCM SealMode = "OAEP_GCM"
+	// SealPKCS1CBC encrypts the AES key with RSA PKCS1 v1.5 and the content with
+	// AES CBC, the legacy mode.
+	SealPKCS1CBC SealMode = "PKCS1_CBC"
+)
+
+// Sealer signs and encrypts payloads the way Safeheron does, to test webhook and
+// co-signer handlers with realistic envelopes.
+type Sealer struct {
+	// SignerKey signs the envelopes, only its private key is used. Its public key
+	// is the Safeheron webhook public key or the co-signer public key of the converters.
+	SignerKey KeyPair
+	// RecipientKey encrypts the AES key of the envelopes, only its public key is used.
+	// Its private key is the webhook or approval callback service private key of the converters.
+	RecipientKey KeyPair
+	// Mode is SealOAEPGCM when empty.
+	Mode SealMode
+	// Timestamp of the envelopes, the current time when zero.
+	Timestamp time.Time
+}
+
+// sealed is the content of an encrypted envelope.
+type sealed struct {
+	timestamp  string
+	key        string
+	bizContent string
+	rsaType    string
+	aesType    string
+	sig        string
+}
+
+// WebHook seals payLoad into a webhook that WebhookConverter.Convert accepts.
+func (s Sealer) WebHook(payLoad []byte) (webhook.WebHook, error) {
+	e, err := s.seal(payLoad)
+	if err != nil {
+		return webhook.WebHook{}, err
+	}
+	return webhook.WebHook{Timestamp: e.timestamp, Sig: e.sig, Key: e.key, BizContent: e.bizContent, RsaType: e.rsaType, AesType: e.aesType}, nil
+}
+
+// CoSignerCallBack seals payLoad into a co-signer callback that
+// CoSignerConverter.RequestConvert accepts.
+func (s Sealer) CoSignerCallBack(payLoad []byte) (cosigner.CoSignerCallBack, error) {
+	e, err := s.seal(payLoad)
+	if err != nil {
+		return cosigner.CoSignerCallBack{}, err
+	}
+	return cosigner.CoSignerCallBack{Timestamp: e.timestamp, Sig: e.sig, Key: e.key, BizContent: e.bizContent, RsaType: e.rsaType, AesType: e.aesType}, nil
+}
+
+// CoSignerCallBackV3 signs payLoad into a V3 co-signer callback that
+// CoSignerConverter.RequestV3Convert accepts. V3 callbacks are not encrypted,
+// their content is only base64 encoded and signed with RSA PSS, Mode and
+// RecipientKey are not used.
+func (s Sealer) CoSignerCallBackV3(payLoad []byte) (cosigner.CoSignerCallBackV3, error) {
+	d := cosigner.CoSignerCallBackV3{
+		Timestamp:  s.timestamp(),
+		Version:    "v3",
+		BizContent: base64.StdEncoding.EncodeToString(payLoad),
+	}
+	var err error
+	d.Sig, err = utils.SignParamsPSS(serializeParams(map[string]string{
+		"version":    d.Version,
+		"timestamp":  d.Timestamp,
+		"bizContent": d.BizContent,
+	}), utils.NewRsaKey(utils.PemKeySource(s.SignerKey.PrivateKeyPem), 0))
+	return d, err
+}
+
+func (s Sealer) seal(payLoad []byte) (sealed, error) {
+	aesKey := make([]byte, 32)
+	rand.Read(aesKey)
+	aesIv := make([]byte, 16)
+	rand.Read(aesIv)
+	recipientKey, err := utils.NewRsaKey(utils.PemKeySource(s.RecipientKey.PublicKeyPem), 0).PublicKey()
+	if err != nil {
+		return sealed{}, err
+	}
+	e := sealed{timestamp: s.timestamp()}
+	switch s.Mode {
+	case SealOAEPGCM, "":
+		e.rsaType, e.aesType = utils.ECB_OAEP, utils.GCM
+		if e.bizContent, err = utils.EncryContentWithAESGCM(string(payLoad), aesKey, aesIv); err != nil {
+			return sealed{}, err
+		}
+		if e.key, err = utils.EncryptWithOAEPKey(append(aesKey, aesIv...), recipientKey); err != nil {
+			return sealed{}, err
+		}
+	case SealPKCS1CBC:
+		if e.bizContent, err = utils.EncryContentWithAES(string(payLoad), aesKey, aesIv); err != nil {
+			return sealed{}, err
+		}
+		if e.key, err = utils.EncryptWithRSAKey(append(aesKey, aesIv...), recipientKey); err != nil {
+			return sealed{}, err
+		}
+	default:
+		return sealed{}, fmt.Errorf("unknown seal mode %q", s.Mode)
+	}
+	e.sig, err = utils.SignParams(serializeParams(map[string]string{
+		"key":        e.key,
+		"timestamp":  e.timestamp,
+		"bizContent": e.bizContent,
+	}), utils.NewRsaKey(utils.PemKeySource(s.SignerKey.PrivateKeyPem), 0))
+	return e, err
+}
+
+func (s Sealer) timestamp() string {
+	timestamp := s.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	return strconv.FormatInt(timestamp.UnixMilli(), 10)
+}
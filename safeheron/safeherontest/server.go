@@ -0,0 +1,273 @@
+package safeherontest
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/utils"
+)
+
+// Handler serves one endpoint. It receives the decrypted bizContent of the
+// request, nil when the request had none, and returns the response data.
+// Returning a *safeheron.SafeheronError answers with its Code and Message.
+type Handler func(bizContent json.RawMessage) (any, error)
+
+// Request is a request received by the Server, after decryption.
+type Request struct {
+	Path       string
+	BizContent json.RawMessage
+}
+
+// The API error codes of the Server and the Simulator. They are the fake's own,
+// not Safeheron's: Config sets them in ApiConfig.ErrorCodes so that the error
+// predicates of the safeheron package work against the fake.
+const (
+	// CodeError is the code of the errors without a more specific one.
+	CodeError int64 = 1000
+	// CodeSignatureInvalid answers the requests whose signature does not verify.
+	CodeSignatureInvalid int64 = 1001
+	// CodeInsufficientBalance answers the transactions the source account can not pay.
+	CodeInsufficientBalance int64 = 1002
+	// CodeDuplicateCustomerRefId answers the create requests whose customerRefId is used.
+	CodeDuplicateCustomerRefId int64 = 1003
+)
+
+// ErrorCodes is the ErrorCodes of the Server and the Simulator.
+var ErrorCodes = safeheron.ErrorCodes{
+	SignatureInvalid:       []int64{CodeSignatureInvalid},
+	InsufficientBalance:    []int64{CodeInsufficientBalance},
+	DuplicateCustomerRefId: []int64{CodeDuplicateCustomerRefId},
+}
+
+// Server is an httptest.Server speaking the Safeheron API envelope protocol:
+// it verifies the request signature, decrypts the request and signs and encrypts
+// the response, exactly like the Safeheron API does. Envelopes it can not open
+// are answered with CodeError, or CodeSignatureInvalid for a bad signature.
+type Server struct {
+	*httptest.Server
+
+	ApiKey string
+	// ClientKeys is the key pair of the API key, the customer side.
+	ClientKeys KeyPair
+	// PlatformKeys is the key pair of the Safeheron platform.
+	PlatformKeys KeyPair
+
+	clientPublicKey    *utils.RsaKey
+	platformPrivateKey *utils.RsaKey
+
+	mu       sync.Mutex
+	handlers map[string]Handler
+	requests []Request
+}
+
+// NewServer starts a server with freshly generated key pairs and no handlers.
+// Close it when done.
+func NewServer() (*Server, error) {
+	clientKeys, err := GenerateKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	platformKeys, err := GenerateKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		ApiKey:             "safeherontest-api-key",
+		ClientKeys:         clientKeys,
+		PlatformKeys:       platformKeys,
+		clientPublicKey:    utils.NewRsaKey(utils.PemKeySource(clientKeys.PublicKeyPem), 0),
+		platformPrivateKey: utils.NewRsaKey(utils.PemKeySource(platformKeys.PrivateKeyPem), 0),
+		handlers:           map[string]Handler{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s, nil
+}
+
+// Handle registers the handler for an endpoint path such as "/v3/transactions/create".
+func (s *Server) Handle(path string, handler Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[path] = handler
+}
+
+// HandleResponse registers a handler always answering with response.
+func (s *Server) HandleResponse(path string, response any) {
+	s.Handle(path, func(json.RawMessage) (any, error) {
+		return response, nil
+	})
+}
+
+// Requests returns the requests received so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// Config returns an ApiConfig pointing at the server with matching keys.
+func (s *Server) Config() safeheron.ApiConfig {
+	return safeheron.ApiConfig{
+		BaseUrl:                     s.URL,
+		ApiKey:                      s.ApiKey,
+		RsaPrivateKeySource:         utils.NewRsaKey(utils.PemKeySource(s.ClientKeys.PrivateKeyPem), 0),
+		SafeheronRsaPublicKeySource: utils.NewRsaKey(utils.PemKeySource(s.PlatformKeys.PublicKeyPem), 0),
+		HttpClient:                  s.Server.Client(),
+		ErrorCodes:                  ErrorCodes,
+	}
+}
+
+// Client returns a safeheron.Client talking to the server.
+func (s *Server) Client() safeheron.Client {
+	return safeheron.Client{Config: s.Config()}
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	var params map[string]string
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"code": http.StatusBadRequest, "message": "invalid request body"})
+		return
+	}
+	bizContent, apiErr := s.openRequest(params)
+	if apiErr != nil {
+		writeJSON(w, http.StatusOK, map[string]any{"code": apiErr.Code, "message": apiErr.Message})
+		return
+	}
+
+	s.mu.Lock()
+	handler, ok := s.handlers[r.URL.Path]
+	s.requests = append(s.requests, Request{Path: r.URL.Path, BizContent: bizContent})
+	s.mu.Unlock()
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]any{"code": http.StatusNotFound, "message": fmt.Sprintf("no handler for %s", r.URL.Path)})
+		return
+	}
+
+	response, err := handler(bizContent)
+	if err != nil {
+		var apiErr *safeheron.SafeheronError
+		if !errors.As(err, &apiErr) {
+			apiErr = &safeheron.SafeheronError{Code: http.StatusInternalServerError, Message: err.Error()}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"code": apiErr.Code, "message": apiErr.Message})
+		return
+	}
+	sealed, err := s.sealResponse(response)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"code": http.StatusInternalServerError, "message": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, sealed)
+}
+
+// openRequest verifies and decrypts a request envelope.
+func (s *Server) openRequest(params map[string]string) (json.RawMessage, *safeheron.SafeheronError) {
+	if params["apiKey"] != s.ApiKey {
+		return nil, &safeheron.SafeheronError{Code: CodeError, Message: "invalid apiKey"}
+	}
+	signed := map[string]string{
+		"apiKey":    params["apiKey"],
+		"timestamp": params["timestamp"],
+		"key":       params["key"],
+	}
+	if bizContent, ok := params["bizContent"]; ok {
+		signed["bizContent"] = bizContent
+	}
+	clientPublicKey, err := s.clientPublicKey.PublicKey()
+	if err != nil || !utils.VerifySignWithRSAKey(serializeParams(signed), params["sig"], clientPublicKey) {
+		return nil, &safeheron.SafeheronError{Code: CodeSignatureInvalid, Message: "signature verification failed"}
+	}
+	keyAndIv, err := utils.DecryptKey(params["key"], params["rsaType"], s.platformPrivateKey)
+	if err != nil || len(keyAndIv) < 48 {
+		return nil, &safeheron.SafeheronError{Code: CodeError, Message: "key decryption failed"}
+	}
+	bizContent, ok := params["bizContent"]
+	if !ok {
+		return nil, nil
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(bizContent)
+	if err != nil {
+		return nil, &safeheron.SafeheronError{Code: CodeError, Message: "bizContent base64 decode failed"}
+	}
+	var plaintext []byte
+	if params["aesType"] == utils.GCM {
+		plaintext, err = utils.NewGCMDecrypter(keyAndIv[:32], keyAndIv[32:48], ciphertext)
+	} else {
+		plaintext, err = utils.NewCBCDecrypter(keyAndIv[:32], keyAndIv[32:48], ciphertext)
+	}
+	if err != nil {
+		return nil, &safeheron.SafeheronError{Code: CodeError, Message: "bizContent decryption failed"}
+	}
+	return plaintext, nil
+}
+
+// sealResponse signs and encrypts response data the way the Safeheron API does.
+func (s *Server) sealResponse(response any) (map[string]any, error) {
+	payLoad, err := json.Marshal(response)
+	if err != nil {
+		return nil, err
+	}
+	aesKey := make([]byte, 32)
+	rand.Read(aesKey)
+	aesIv := make([]byte, 16)
+	rand.Read(aesIv)
+	bizContent, err := utils.EncryContentWithAESGCM(string(payLoad), aesKey, aesIv)
+	if err != nil {
+		return nil, err
+	}
+	clientPublicKey, err := s.clientPublicKey.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	key, err := utils.EncryptWithOAEPKey(append(aesKey, aesIv...), clientPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	sealed := map[string]string{
+		"code":       "200",
+		"message":    "SUCCESS",
+		"timestamp":  strconv.FormatInt(time.Now().UnixMilli(), 10),
+		"key":        key,
+		"bizContent": bizContent,
+	}
+	sig, err := utils.SignParams(serializeParams(sealed), s.platformPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"code":       200,
+		"message":    sealed["message"],
+		"timestamp":  sealed["timestamp"],
+		"key":        key,
+		"bizContent": bizContent,
+		"sig":        sig,
+		"rsaType":    utils.ECB_OAEP,
+		"aesType":    utils.GCM,
+	}, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func serializeParams(params map[string]string) string {
+	// Sort by key and serialize all request param into apiKey=...&bizContent=... format
+	var data []string
+	for k, v := range params {
+		data = append(data, strings.Join([]string{k, v}, "="))
+	}
+	sort.Strings(data)
+	return strings.Join(data, "&")
+}
@@ -0,0 +1,79 @@
+package safeherontest
+
+import (
+	"sync"
+
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/utils"
+)
+
+// FakeSignerDecrypter is a utils.SignerDecrypter backed by a generated key.
+// It records every operation and can be made to fail.
+type FakeSignerDecrypter struct {
+	KeyPair KeyPair
+	key     *utils.RsaKey
+
+	mu    sync.Mutex
+	calls []string
+	err   error
+}
+
+// NewFakeSignerDecrypter generates a fresh key pair for the fake.
+func NewFakeSignerDecrypter() (*FakeSignerDecrypter, error) {
+	keyPair, err := GenerateKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	return &FakeSignerDecrypter{
+		KeyPair: keyPair,
+		key:     utils.NewRsaKey(utils.PemKeySource(keyPair.PrivateKeyPem), 0),
+	}, nil
+}
+
+// FailWith makes every following operation return err, nil restores normal operation.
+func (f *FakeSignerDecrypter) FailWith(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+// Calls returns the names of the operations performed so far, e.g. "SignPSS".
+func (f *FakeSignerDecrypter) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+func (f *FakeSignerDecrypter) record(call string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, call)
+	return f.err
+}
+
+func (f *FakeSignerDecrypter) SignPKCS1v15(digest []byte) ([]byte, error) {
+	if err := f.record("SignPKCS1v15"); err != nil {
+		return nil, err
+	}
+	return f.key.SignPKCS1v15(digest)
+}
+
+func (f *FakeSignerDecrypter) SignPSS(digest []byte) ([]byte, error) {
+	if err := f.record("SignPSS"); err != nil {
+		return nil, err
+	}
+	return f.key.SignPSS(digest)
+}
+
+func (f *FakeSignerDecrypter) DecryptOAEP(ciphertext []byte) ([]byte, error) {
+	if err := f.record("DecryptOAEP"); err != nil {
+		return nil, err
+	}
+	return f.key.DecryptOAEP(ciphertext)
+}
+
+func (f *FakeSignerDecrypter) DecryptPKCS1v15(ciphertext []byte) ([]byte, error) {
+	if err := f.record("DecryptPKCS1v15"); err != nil {
+		return nil, err
+	}
+	return f.key.DecryptPKCS1v15(ciphertext)
+}
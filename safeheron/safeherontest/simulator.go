@@ -0,0 +1,578 @@
+package safeherontest
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/api"
+)
+
+// Coin describes a coin known to the Simulator, its api.Coin is returned by /v1/coin/list.
+type Coin struct {
+	api.Coin
+	// Fee is the network fee charged for every transaction of the coin, in FeeCoinKey units.
+	Fee string `json:"-"`
+}
+
+// Simulator is a stateful in-memory Safeheron. It serves accounts, coins,
+// balances, addresses, whitelists and transactions on top of a Server.
+//
+// Time only moves when Advance is called: every transaction spends StageDuration
+// in each of SUBMITTED, SIGNING and BROADCASTING before it is COMPLETED, or
+// FAILED when it was marked with FailTransaction. A transaction marked with
+// StallTransaction stays BROADCASTING until it is recreated. EVM transactions
+// are mined in nonce order, a transaction stays BROADCASTING while a lower nonce
+// of its account is not mined. Every status change
+// is sent as an encrypted webhook to WebhookURL when it is set, failed webhooks
+// are sent again by /v1/webhook/resend/failed.
+type Simulator struct {
+	*Server
+
+	// StageDuration is the time a transaction spends in every non terminal status.
+	StageDuration time.Duration
+	// WebhookURL receives the webhooks, none are sent when it is empty.
+	WebhookURL string
+	// WebhookPlatformKeys signs webhooks, its public key is the Safeheron webhook public key.
+	WebhookPlatformKeys KeyPair
+	// WebhookCustomerKeys is the key pair the customer decrypts webhooks with.
+	WebhookCustomerKeys KeyPair
+
+	mu           sync.Mutex
+	now          time.Time
+	seq          int
+	coins        []Coin
+	maintenance  []api.CoinMaintain
+	accounts     []*simAccount
+	whitelists   []*api.WhitelistResponse
+	transactions []*simTransaction
+	deliveries   []WebhookDelivery
+	// gasBalances is the gas station balance by fee coin symbol.
+	gasBalances map[string]*big.Rat
+	// pending holds the webhooks emitted while the lock is held, until they are flushed.
+	pending []WebhookDelivery
+}
+
+type simAccount struct {
+	api.AccountResponse
+	coins map[string]*simAccountCoin
+	// coinKeys keeps the order the coins were added in.
+	coinKeys []string
+	// nonces is the next nonce of the account by fee coin key, EVM coins only.
+	nonces map[string]int64
+}
+
+type simAccountCoin struct {
+	address string
+	balance *big.Rat
+}
+
+// NewSimulator starts a simulator with the ETH and BTC test coins, its clock
+// starts at the current time. Close it when done.
+func NewSimulator() (*Simulator, error) {
+	server, err := NewServer()
+	if err != nil {
+		return nil, err
+	}
+	platformKeys, err := GenerateKeyPair()
+	if err != nil {
+		server.Close()
+		return nil, err
+	}
+	customerKeys, err := GenerateKeyPair()
+	if err != nil {
+		server.Close()
+		return nil, err
+	}
+	s := &Simulator{
+		Server:              server,
+		StageDuration:       10 * time.Second,
+		WebhookPlatformKeys: platformKeys,
+		WebhookCustomerKeys: customerKeys,
+		now:                 time.Now(),
+	}
+	s.AddCoin(Coin{Coin: api.Coin{CoinKey: "ETH_GOERLI", CoinName: "ETH", CoinFullName: "Ethereum Goerli", Symbol: "ETH", CoinDecimal: 18, ShowCoinDecimal: 8,
+		FeeCoinKey: "ETH_GOERLI", FeeUnit: "Gwei", FeeDecimal: 18, CoinType: "NORMAL", MinTransferAmount: "0", BlockChain: "Ethereum",
+		Network: "Goerli", IsMemo: "0", IsUtxo: "0", BlockchainType: "EVM"}, Fee: "0.0021"})
+	s.AddCoin(Coin{Coin: api.Coin{CoinKey: "BTC_TESTNET", CoinName: "BTC", CoinFullName: "Bitcoin Testnet", Symbol: "BTC", CoinDecimal: 8, ShowCoinDecimal: 8,
+		FeeCoinKey: "BTC_TESTNET", FeeUnit: "sat/b", FeeDecimal: 8, CoinType: "NORMAL", MinTransferAmount: "0.00000546", BlockChain: "Bitcoin",
+		Network: "Testnet", IsMemo: "0", IsUtxo: "1", BlockchainType: "UTXO"}, Fee: "0.00001"})
+	s.registerHandlers()
+	return s, nil
+}
+
+// Now returns the simulated time.
+func (s *Simulator) Now() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.now
+}
+
+// Advance moves the clock forward, moves transactions through their lifecycle
+// and sends the resulting webhooks before returning.
+func (s *Simulator) Advance(d time.Duration) {
+	s.mu.Lock()
+	s.now = s.now.Add(d)
+	s.progressTransactions()
+	s.mu.Unlock()
+	s.flush()
+}
+
+// AddCoin adds a coin to the catalog, or replaces the coin with the same CoinKey.
+func (s *Simulator) AddCoin(coin Coin) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.coins {
+		if s.coins[i].CoinKey == coin.CoinKey {
+			s.coins[i] = coin
+			return
+		}
+	}
+	s.coins = append(s.coins, coin)
+}
+
+// AddMaintenance announces a maintenance window of a coin, returned by /v1/coin/maintain/list.
+func (s *Simulator) AddMaintenance(coinKey string, start time.Time, end time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maintenance = append(s.maintenance, api.CoinMaintain{
+		CoinKey:   coinKey,
+		Maintain:  true,
+		Title:     fmt.Sprintf("%s maintenance", coinKey),
+		StartTime: strconv.FormatInt(start.UnixMilli(), 10),
+		EndTime:   strconv.FormatInt(end.UnixMilli(), 10),
+	})
+}
+
+// SetBalance sets the balance of a coin of an account, adding the coin when needed.
+func (s *Simulator) SetBalance(accountKey string, coinKey string, amount string) error {
+	balance, ok := new(big.Rat).SetString(amount)
+	if !ok {
+		return fmt.Errorf("invalid amount %s", amount)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	account, err := s.account(accountKey)
+	if err != nil {
+		return err
+	}
+	accountCoin, err := s.addAccountCoin(account, coinKey)
+	if err != nil {
+		return err
+	}
+	accountCoin.balance = balance
+	return nil
+}
+
+// SetGasBalance sets the gas station balance of a fee coin symbol. Transactions
+// of tokens from AutoFuel accounts take the missing fee from this balance.
+func (s *Simulator) SetGasBalance(symbol string, amount string) error {
+	balance, ok := new(big.Rat).SetString(amount)
+	if !ok {
+		return fmt.Errorf("invalid amount %s", amount)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.gasBalances == nil {
+		s.gasBalances = map[string]*big.Rat{}
+	}
+	s.gasBalances[symbol] = balance
+	return nil
+}
+
+// Balance returns the balance of a coin of an account.
+func (s *Simulator) Balance(accountKey string, coinKey string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	account, err := s.account(accountKey)
+	if err != nil {
+		return "", err
+	}
+	accountCoin, ok := account.coins[coinKey]
+	if !ok {
+		return "0", nil
+	}
+	return formatAmount(accountCoin.balance, s.coin(coinKey).CoinDecimal), nil
+}
+
+func (s *Simulator) nextKey(prefix string) string {
+	s.seq++
+	return fmt.Sprintf("%s%08d", prefix, s.seq)
+}
+
+func (s *Simulator) coin(coinKey string) *Coin {
+	for i := range s.coins {
+		if s.coins[i].CoinKey == coinKey {
+			return &s.coins[i]
+		}
+	}
+	return nil
+}
+
+func (s *Simulator) account(accountKey string) (*simAccount, error) {
+	for _, account := range s.accounts {
+		if account.AccountKey == accountKey {
+			return account, nil
+		}
+	}
+	return nil, &safeheron.SafeheronError{Code: CodeError, Message: fmt.Sprintf("account %s does not exist", accountKey)}
+}
+
+func (s *Simulator) addAccountCoin(account *simAccount, coinKey string) (*simAccountCoin, error) {
+	if accountCoin, ok := account.coins[coinKey]; ok {
+		return accountCoin, nil
+	}
+	coin := s.coin(coinKey)
+	if coin == nil {
+		return nil, &safeheron.SafeheronError{Code: CodeError, Message: fmt.Sprintf("coin %s is not supported", coinKey)}
+	}
+	// Coins on the same chain share the address of the account
+	address := ""
+	for _, key := range account.coinKeys {
+		if other := s.coin(key); other != nil && other.BlockChain == coin.BlockChain {
+			address = account.coins[key].address
+			break
+		}
+	}
+	if address == "" {
+		s.seq++
+		address = fmt.Sprintf("0x%040x", s.seq)
+	}
+	accountCoin := &simAccountCoin{address: address, balance: new(big.Rat)}
+	account.coins[coinKey] = accountCoin
+	account.coinKeys = append(account.coinKeys, coinKey)
+	return accountCoin, nil
+}
+
+// accountByAddress returns the account owning an address of a coin.
+func (s *Simulator) accountByAddress(coinKey string, address string) *simAccount {
+	for _, account := range s.accounts {
+		if accountCoin, ok := account.coins[coinKey]; ok && strings.EqualFold(accountCoin.address, address) {
+			return account
+		}
+	}
+	return nil
+}
+
+func (s *Simulator) createAccount(name string, customerRefId string, hiddenOnUI *bool, autoFuel *bool, accountTag string, coinKeys []string) (api.CreateAccountResponse, error) {
+	account := &simAccount{coins: map[string]*simAccountCoin{}, nonces: map[string]int64{}}
+	account.AccountKey = s.nextKey("account")
+	account.AccountIndex = int32(len(s.accounts))
+	account.AccountName = name
+	account.CustomerRefId = customerRefId
+	account.AccountType = "VAULT_ACCOUNT"
+	account.AccountTag = accountTag
+	account.HiddenOnUI = hiddenOnUI != nil && *hiddenOnUI
+	account.AutoFuel = autoFuel != nil && *autoFuel
+	account.UsdBalance = "0"
+	for _, coinKey := range coinKeys {
+		if _, err := s.addAccountCoin(account, coinKey); err != nil {
+			return api.CreateAccountResponse{}, err
+		}
+	}
+	s.accounts = append(s.accounts, account)
+	return s.coinAddressList(account, coinKeys), nil
+}
+
+func (s *Simulator) coinAddressList(account *simAccount, coinKeys []string) api.CreateAccountResponse {
+	var response api.CreateAccountResponse
+	response.AccountKey = account.AccountKey
+	for _, coinKey := range coinKeys {
+		item := struct {
+			CoinKey          string `json:"coinKey"`
+			AddressGroupKey  string `json:"addressGroupKey"`
+			AddressGroupName string `json:"addressGroupName"`
+			AddressList      []struct {
+				Address     string `json:"address"`
+				AddressType string `json:"addressType"`
+				DerivePath  string `json:"derivePath"`
+			} `json:"addressList"`
+		}{CoinKey: coinKey, AddressGroupKey: account.AccountKey + "-" + coinKey, AddressGroupName: "Default"}
+		item.AddressList = append(item.AddressList, struct {
+			Address     string `json:"address"`
+			AddressType string `json:"addressType"`
+			DerivePath  string `json:"derivePath"`
+		}{Address: account.coins[coinKey].address, DerivePath: fmt.Sprintf("m/44/60/%d/0/0", account.AccountIndex)})
+		response.CoinAddressList = append(response.CoinAddressList, item)
+	}
+	return response
+}
+
+func (s *Simulator) registerHandlers() {
+	s.Handle("/v1/coin/list", s.locked(func(json.RawMessage) (any, error) {
+		return s.coins, nil
+	}))
+	s.Handle("/v1/coin/maintain/list", s.locked(func(json.RawMessage) (any, error) {
+		return append([]api.CoinMaintain{}, s.maintenance...), nil
+	}))
+	s.Handle("/v1/coin/block/height", s.locked(func(bizContent json.RawMessage) (any, error) {
+		var req api.CoinBlockHeightRequest
+		if err := json.Unmarshal(bizContent, &req); err != nil {
+			return nil, err
+		}
+		if s.coin(req.CoinKey) == nil {
+			return nil, &safeheron.SafeheronError{Code: CodeError, Message: "coin does not exist"}
+		}
+		// Every broadcast and every new key mines a block
+		return api.CoinBlockHeightResponse{{CoinKey: req.CoinKey, LocalBlockHeight: int64(s.seq)}}, nil
+	}))
+	s.Handle("/v1/account/create", s.locked(func(bizContent json.RawMessage) (any, error) {
+		var req api.CreateAccountRequest
+		if err := json.Unmarshal(bizContent, &req); err != nil {
+			return nil, err
+		}
+		return s.createAccount(req.AccountName, req.CustomerRefId, req.HiddenOnUI, req.AutoFuel, req.AccountTag, req.CoinKeyList)
+	}))
+	s.Handle("/v2/account/batch/create", s.locked(func(bizContent json.RawMessage) (any, error) {
+		var req api.BatchCreateAccountRequest
+		if err := json.Unmarshal(bizContent, &req); err != nil {
+			return nil, err
+		}
+		var response []api.CreateAccountResponse
+		for i := int32(0); i < req.Count; i++ {
+			account, err := s.createAccount(req.AccountName, "", req.HiddenOnUI, req.AutoFuel, req.AccountTag, nil)
+			if err != nil {
+				return nil, err
+			}
+			response = append(response, account)
+		}
+		return response, nil
+	}))
+	s.Handle("/v1/account/list", s.locked(func(bizContent json.RawMessage) (any, error) {
+		var req api.ListAccountRequest
+		if err := json.Unmarshal(bizContent, &req); err != nil {
+			return nil, err
+		}
+		var matched []api.AccountResponse
+		for _, account := range s.accounts {
+			if (req.NamePrefix == "" || strings.HasPrefix(account.AccountName, req.NamePrefix)) &&
+				(req.NameSuffix == "" || strings.HasSuffix(account.AccountName, req.NameSuffix)) &&
+				(req.CustomerRefId == "" || account.CustomerRefId == req.CustomerRefId) &&
+				(req.HiddenOnUI == nil || account.HiddenOnUI == *req.HiddenOnUI) &&
+				(req.AutoFuel == nil || account.AutoFuel == *req.AutoFuel) &&
+				(req.Archived == nil || account.Archived == *req.Archived) {
+				matched = append(matched, account.AccountResponse)
+			}
+		}
+		pageNumber, pageSize := req.PageNumber, req.PageSize
+		if pageNumber <= 0 {
+			pageNumber = 1
+		}
+		if pageSize <= 0 {
+			pageSize = 10
+		}
+		content := []api.AccountResponse{}
+		if start := (pageNumber - 1) * pageSize; start < len(matched) {
+			end := start + pageSize
+			if end > len(matched) {
+				end = len(matched)
+			}
+			content = matched[start:end]
+		}
+		return api.ListAccountResponse{PageNumber: int32(pageNumber), PageSize: int32(pageSize), TotalElements: int64(len(matched)), Content: content}, nil
+	}))
+	s.Handle("/v1/account/one", s.locked(func(bizContent json.RawMessage) (any, error) {
+		var req api.OneAccountRequest
+		if err := json.Unmarshal(bizContent, &req); err != nil {
+			return nil, err
+		}
+		for _, account := range s.accounts {
+			if (req.AccountKey != "" && account.AccountKey == req.AccountKey) || (req.CustomerRefId != "" && account.CustomerRefId == req.CustomerRefId) {
+				return account.AccountResponse, nil
+			}
+		}
+		return nil, &safeheron.SafeheronError{Code: CodeError, Message: "account does not exist"}
+	}))
+	s.Handle("/v2/account/coin/create", s.locked(func(bizContent json.RawMessage) (any, error) {
+		var req api.AddCoinV2Request
+		if err := json.Unmarshal(bizContent, &req); err != nil {
+			return nil, err
+		}
+		account, err := s.account(req.AccountKey)
+		if err != nil {
+			return nil, err
+		}
+		for _, coinKey := range req.CoinKeyList {
+			if _, err := s.addAccountCoin(account, coinKey); err != nil {
+				return nil, err
+			}
+		}
+		created := s.coinAddressList(account, req.CoinKeyList)
+		return api.AddCoinV2Response{AccountKey: account.AccountKey, CoinAddressList: created.CoinAddressList}, nil
+	}))
+	s.Handle("/v1/account/coin/list", s.locked(func(bizContent json.RawMessage) (any, error) {
+		var req api.ListAccountCoinRequest
+		if err := json.Unmarshal(bizContent, &req); err != nil {
+			return nil, err
+		}
+		account, err := s.account(req.AccountKey)
+		if err != nil {
+			return nil, err
+		}
+		var response []map[string]any
+		for _, coinKey := range account.coinKeys {
+			coin := s.coin(coinKey)
+			accountCoin := account.coins[coinKey]
+			balance := formatAmount(accountCoin.balance, coin.CoinDecimal)
+			response = append(response, map[string]any{
+				"coinKey":      coin.CoinKey,
+				"coinFullName": coin.CoinFullName,
+				"coinName":     coin.CoinName,
+				"coinDecimal":  coin.CoinDecimal,
+				"symbol":       coin.Symbol,
+				"feeCoinKey":   coin.FeeCoinKey,
+				"feeUnit":      coin.FeeUnit,
+				"feeDecimal":   coin.FeeDecimal,
+				"balance":      balance,
+				"usdBalance":   "0",
+				"addressList": []map[string]any{{
+					"address":        accountCoin.address,
+					"addressType":    "",
+					"derivePath":     fmt.Sprintf("m/44/60/%d/0/0", account.AccountIndex),
+					"addressBalance": balance,
+				}},
+			})
+		}
+		return response, nil
+	}))
+	s.Handle("/v1/gas/status", s.locked(func(json.RawMessage) (any, error) {
+		response := api.GasStatusResponse{GasBalance: []api.GasBalance{}, Configuration: []api.Configuration{}}
+		symbols := make([]string, 0, len(s.gasBalances))
+		for symbol := range s.gasBalances {
+			symbols = append(symbols, symbol)
+		}
+		sort.Strings(symbols)
+		for _, symbol := range symbols {
+			response.GasBalance = append(response.GasBalance, api.GasBalance{Symbol: symbol, Amount: formatAmount(s.gasBalances[symbol], 18)})
+		}
+		// The gas station is enabled on the chains whose fee coin has a balance
+		seen := map[string]bool{}
+		for _, coin := range s.coins {
+			if seen[coin.BlockChain] {
+				continue
+			}
+			seen[coin.BlockChain] = true
+			feeCoin := s.coin(coin.FeeCoinKey)
+			response.Configuration = append(response.Configuration, api.Configuration{Network: coin.BlockChain, Enabled: feeCoin != nil && s.gasBalances[feeCoin.Symbol] != nil})
+		}
+		return response, nil
+	}))
+	s.Handle("/v1/whitelist/create", s.locked(func(bizContent json.RawMessage) (any, error) {
+		var req api.CreateWhitelistRequest
+		if err := json.Unmarshal(bizContent, &req); err != nil {
+			return nil, err
+		}
+		whitelist := &api.WhitelistResponse{
+			WhitelistKey:    s.nextKey("whitelist"),
+			ChainType:       req.ChainType,
+			WhitelistName:   req.WhitelistName,
+			Address:         req.Address,
+			Memo:            req.Memo,
+			WhitelistStatus: "APPROVED",
+			CreateTime:      s.now.UnixMilli(),
+			LastUpdateTime:  s.now.UnixMilli(),
+		}
+		s.whitelists = append(s.whitelists, whitelist)
+		return api.CreateWhitelistResponse{WhitelistKey: whitelist.WhitelistKey}, nil
+	}))
+	s.Handle("/v1/whitelist/one", s.locked(func(bizContent json.RawMessage) (any, error) {
+		var req api.OneWhitelistRequest
+		if err := json.Unmarshal(bizContent, &req); err != nil {
+			return nil, err
+		}
+		for _, whitelist := range s.whitelists {
+			if (req.WhitelistKey != "" && whitelist.WhitelistKey == req.WhitelistKey) || (req.Address != "" && whitelist.Address == req.Address) {
+				return whitelist, nil
+			}
+		}
+		return nil, &safeheron.SafeheronError{Code: CodeError, Message: "whitelist does not exist"}
+	}))
+	s.Handle("/v1/whitelist/list", s.locked(func(bizContent json.RawMessage) (any, error) {
+		var req api.ListWhitelistRequest
+		if err := json.Unmarshal(bizContent, &req); err != nil {
+			return nil, err
+		}
+		var matched []*api.WhitelistResponse
+		for i := len(s.whitelists) - 1; i >= 0; i-- {
+			whitelist := s.whitelists[i]
+			if (req.ChainType == "" || whitelist.ChainType == req.ChainType) &&
+				(req.WhitelistStatus == "" || whitelist.WhitelistStatus == req.WhitelistStatus) &&
+				(req.CreateTimeMin == 0 || whitelist.CreateTime >= req.CreateTimeMin) &&
+				(req.CreateTimeMax == 0 || whitelist.CreateTime <= req.CreateTimeMax) {
+				matched = append(matched, whitelist)
+			}
+		}
+		return cursorPage(matched, func(w *api.WhitelistResponse) string { return w.WhitelistKey }, req.Direct, req.FromId, req.Limit), nil
+	}))
+	s.Handle("/v1/whitelist/delete", s.locked(func(bizContent json.RawMessage) (any, error) {
+		var req api.DeleteWhitelistRequest
+		if err := json.Unmarshal(bizContent, &req); err != nil {
+			return nil, err
+		}
+		for i, whitelist := range s.whitelists {
+			if whitelist.WhitelistKey == req.WhitelistKey {
+				s.whitelists = append(s.whitelists[:i], s.whitelists[i+1:]...)
+				return api.ResultResponse{Result: true}, nil
+			}
+		}
+		return nil, &safeheron.SafeheronError{Code: CodeError, Message: "whitelist does not exist"}
+	}))
+	s.registerTransactionHandlers()
+	s.registerWebhookHandlers()
+}
+
+// locked runs a handler holding the simulator lock and sends the webhooks it emitted afterwards.
+func (s *Simulator) locked(handler Handler) Handler {
+	return func(bizContent json.RawMessage) (any, error) {
+		s.mu.Lock()
+		response, err := handler(bizContent)
+		s.mu.Unlock()
+		s.flush()
+		return response, err
+	}
+}
+
+// cursorPage serves a fromId/direct/limit list. Items are ordered newest first,
+// NEXT pages towards older items and PREV towards newer ones.
+func cursorPage[T any](items []T, key func(T) string, direct string, fromId string, limit int32) []T {
+	if limit <= 0 {
+		limit = 20
+	}
+	start, end := 0, len(items)
+	if fromId != "" {
+		for i, item := range items {
+			if key(item) == fromId {
+				if direct == "PREV" {
+					end = i
+				} else {
+					start = i + 1
+				}
+				break
+			}
+		}
+	}
+	page := items[start:end]
+	if int32(len(page)) > limit {
+		if direct == "PREV" {
+			page = page[int32(len(page))-limit:]
+		} else {
+			page = page[:limit]
+		}
+	}
+	return append([]T{}, page...)
+}
+
+// formatAmount formats an exact amount with at most decimals fraction digits and no trailing zeros.
+func formatAmount(amount *big.Rat, decimals int32) string {
+	formatted := amount.FloatString(int(decimals))
+	if strings.Contains(formatted, ".") {
+		formatted = strings.TrimRight(strings.TrimRight(formatted, "0"), ".")
+	}
+	return formatted
+}
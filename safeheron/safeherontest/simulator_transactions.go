@@ -0,0 +1,579 @@
+package safeherontest
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/api"
+)
+
+type simTransaction struct {
+	api.OneTransactionsResponse
+	enteredAt     time.Time
+	failSubStatus api.TransactionSubStatus
+	// stalled keeps the transaction in BROADCASTING until it is recreated.
+	stalled bool
+	// debits are taken from the source when the transaction is created and refunded when it does not complete.
+	debits map[string]*big.Rat
+	// credit is added to the destination account, if any, when the transaction completes.
+	credit *big.Rat
+}
+
+// lifecycle is the status a transaction moves to after StageDuration in the given one.
+var lifecycle = map[api.TransactionStatus]struct {
+	status    api.TransactionStatus
+	subStatus api.TransactionSubStatus
+}{
+	api.TransactionStatusSubmitted:    {api.TransactionStatusSigning, api.TransactionSubStatusSigning},
+	api.TransactionStatusSigning:      {api.TransactionStatusBroadcasting, api.TransactionSubStatusConfirming},
+	api.TransactionStatusBroadcasting: {api.TransactionStatusCompleted, api.TransactionSubStatusConfirmed},
+}
+
+// FailTransaction makes a transaction end as FAILED with subStatus instead of
+// COMPLETED once it leaves BROADCASTING.
+func (s *Simulator) FailTransaction(txKey string, subStatus api.TransactionSubStatus) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx := s.transaction(txKey, "")
+	if tx == nil {
+		return fmt.Errorf("transaction %s does not exist", txKey)
+	}
+	tx.failSubStatus = subStatus
+	return nil
+}
+
+// StallTransaction keeps a transaction in BROADCASTING, like a transaction stuck
+// in the mempool for a too low fee, until it is sped up with /v2/transactions/recreate.
+func (s *Simulator) StallTransaction(txKey string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx := s.transaction(txKey, "")
+	if tx == nil {
+		return fmt.Errorf("transaction %s does not exist", txKey)
+	}
+	tx.stalled = true
+	return nil
+}
+
+// subStatusReplaced ends a transaction replaced by a recreated one.
+const subStatusReplaced api.TransactionSubStatus = "REPLACED"
+
+// Transaction returns the current state of a transaction.
+func (s *Simulator) Transaction(txKey string) (api.OneTransactionsResponse, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx := s.transaction(txKey, "")
+	if tx == nil {
+		return api.OneTransactionsResponse{}, false
+	}
+	return tx.OneTransactionsResponse, true
+}
+
+func (s *Simulator) transaction(txKey string, customerRefId string) *simTransaction {
+	for _, tx := range s.transactions {
+		if (txKey != "" && tx.TxKey == txKey) || (customerRefId != "" && tx.CustomerRefId == customerRefId) {
+			return tx
+		}
+	}
+	return nil
+}
+
+// createTransaction debits the source and adds a transaction in SUBMITTED. Multi
+// destination transactions pass their destinations and an amount of their total.
+func (s *Simulator) createTransaction(req api.CreateTransactionsRequest, destinations []api.DestinationAddress) (*simTransaction, error) {
+	coin := s.coin(req.CoinKey)
+	if coin == nil {
+		return nil, &safeheron.SafeheronError{Code: CodeError, Message: fmt.Sprintf("coin %s is not supported", req.CoinKey)}
+	}
+	source, err := s.account(req.SourceAccountKey)
+	if err != nil {
+		return nil, err
+	}
+	sourceCoin, ok := source.coins[req.CoinKey]
+	if !ok {
+		return nil, &safeheron.SafeheronError{Code: CodeError, Message: fmt.Sprintf("coin %s is not added to account %s", req.CoinKey, req.SourceAccountKey)}
+	}
+	amount, ok := new(big.Rat).SetString(req.TxAmount)
+	if !ok || amount.Sign() <= 0 {
+		return nil, &safeheron.SafeheronError{Code: CodeError, Message: fmt.Sprintf("invalid txAmount %s", req.TxAmount)}
+	}
+	if minimum, ok := new(big.Rat).SetString(coin.MinTransferAmount); ok && amount.Cmp(minimum) < 0 {
+		return nil, &safeheron.SafeheronError{Code: CodeError, Message: fmt.Sprintf("txAmount is less than the minimum transfer amount %s", coin.MinTransferAmount)}
+	}
+	fee, ok := new(big.Rat).SetString(coin.Fee)
+	if !ok {
+		fee = new(big.Rat)
+	}
+	if len(destinations) > 0 {
+		fee.Mul(fee, utxoSizeRatio(len(destinations)))
+	}
+
+	debits := map[string]*big.Rat{req.CoinKey: new(big.Rat).Set(amount)}
+	credit := new(big.Rat).Set(amount)
+	if coin.FeeCoinKey == req.CoinKey && req.TreatAsGrossAmount {
+		credit.Sub(credit, fee)
+	} else if coin.FeeCoinKey != "" {
+		if debits[coin.FeeCoinKey] == nil {
+			debits[coin.FeeCoinKey] = new(big.Rat)
+		}
+		debits[coin.FeeCoinKey].Add(debits[coin.FeeCoinKey], fee)
+	}
+	if sourceCoin.balance.Cmp(debits[req.CoinKey]) >= 0 {
+		s.autoFuel(source, coin, debits[coin.FeeCoinKey])
+	}
+	for coinKey, debit := range debits {
+		accountCoin, ok := source.coins[coinKey]
+		if !ok || accountCoin.balance.Cmp(debit) < 0 {
+			return nil, &safeheron.SafeheronError{Code: CodeInsufficientBalance, Message: "insufficient balance"}
+		}
+	}
+
+	destinationAddress := req.DestinationAddress
+	if req.DestinationAccountType == "VAULT_ACCOUNT" {
+		destination, err := s.account(req.DestinationAccountKey)
+		if err != nil {
+			return nil, err
+		}
+		destinationCoin, err := s.addAccountCoin(destination, req.CoinKey)
+		if err != nil {
+			return nil, err
+		}
+		destinationAddress = destinationCoin.address
+	}
+	if destinationAddress == "" && len(destinations) == 0 {
+		return nil, &safeheron.SafeheronError{Code: CodeError, Message: "destinationAddress is required"}
+	}
+
+	for coinKey, debit := range debits {
+		source.coins[coinKey].balance.Sub(source.coins[coinKey].balance, debit)
+	}
+	tx := &simTransaction{enteredAt: s.now, debits: debits, credit: credit}
+	tx.TxKey = s.nextKey("tx")
+	tx.CoinKey = req.CoinKey
+	tx.TxAmount = req.TxAmount
+	tx.SourceAccountKey = req.SourceAccountKey
+	tx.SourceAccountType = req.SourceAccountType
+	tx.SourceAccountName = source.AccountName
+	tx.SourceAddress = sourceCoin.address
+	tx.DestinationAccountKey = req.DestinationAccountKey
+	tx.DestinationAccountType = req.DestinationAccountType
+	tx.DestinationAddress = destinationAddress
+	tx.DestinationAddressList = destinations
+	tx.Memo = req.Memo
+	tx.DestinationTag = req.DestinationTag
+	tx.TransactionType = "NORMAL"
+	tx.TransactionStatus = api.TransactionStatusSubmitted
+	tx.TransactionSubStatus = api.TransactionSubStatusAuditPassed
+	tx.TransactionDirection = "OUTFLOW"
+	tx.CreateTime = s.now.UnixMilli()
+	tx.Note = req.Note
+	tx.TxFee = formatAmount(fee, coin.FeeDecimal)
+	tx.FeeCoinKey = coin.FeeCoinKey
+	tx.CustomerRefId = req.CustomerRefId
+	tx.CustomerExt1 = req.CustomerExt1
+	tx.CustomerExt2 = req.CustomerExt2
+	if coin.BlockchainType == "EVM" {
+		// Without a nonce the next one of the account on the chain is used
+		nonce := req.Nonce
+		if nonce == 0 {
+			nonce = source.nonces[coin.FeeCoinKey]
+		}
+		if nonce >= source.nonces[coin.FeeCoinKey] {
+			source.nonces[coin.FeeCoinKey] = nonce + 1
+		}
+		tx.Nonce = fmt.Sprint(nonce)
+	} else if req.Nonce != 0 {
+		tx.Nonce = fmt.Sprint(req.Nonce)
+	}
+	if destination := s.accountByAddress(req.CoinKey, destinationAddress); destinationAddress != "" && destination != nil {
+		tx.RealDestinationAccountType = "VAULT_ACCOUNT"
+		tx.DestinationAccountName = destination.AccountName
+	} else {
+		tx.RealDestinationAccountType = req.DestinationAccountType
+	}
+	s.transactions = append(s.transactions, tx)
+	s.emitTransaction("TRANSACTION_CREATED", tx)
+	return tx, nil
+}
+
+// autoFuel tops up the fee coin of an AutoFuel account from the gas station
+// when it cannot pay the fee of a token transaction.
+func (s *Simulator) autoFuel(account *simAccount, coin *Coin, fee *big.Rat) {
+	if !account.AutoFuel || coin.FeeCoinKey == coin.CoinKey || fee == nil {
+		return
+	}
+	feeCoin := s.coin(coin.FeeCoinKey)
+	if feeCoin == nil {
+		return
+	}
+	feeAccountCoin, err := s.addAccountCoin(account, coin.FeeCoinKey)
+	if err != nil {
+		return
+	}
+	missing := new(big.Rat).Sub(fee, feeAccountCoin.balance)
+	gas := s.gasBalances[feeCoin.Symbol]
+	if missing.Sign() <= 0 || gas == nil || gas.Cmp(missing) < 0 {
+		return
+	}
+	gas.Sub(gas, missing)
+	feeAccountCoin.balance.Add(feeAccountCoin.balance, missing)
+}
+
+// progressTransactions moves every transaction whose stage is over to its next status.
+func (s *Simulator) progressTransactions() {
+	// Mining a nonce may unblock the transactions listed before it, they are moved on the next pass
+	for progressed := true; progressed; {
+		progressed = false
+		for _, tx := range s.transactions {
+			for s.StageDuration >= 0 && !s.now.Before(tx.enteredAt.Add(s.StageDuration)) {
+				next, ok := lifecycle[tx.TransactionStatus]
+				if !ok || (tx.TransactionStatus == api.TransactionStatusBroadcasting && (tx.stalled || s.nonceBlocked(tx))) {
+					break
+				}
+				tx.enteredAt = tx.enteredAt.Add(s.StageDuration)
+				progressed = true
+				if next.status == api.TransactionStatusBroadcasting {
+					s.seq++
+					tx.TxHash = fmt.Sprintf("0x%064x", s.seq)
+				}
+				if next.status == api.TransactionStatusCompleted && tx.failSubStatus != "" {
+					s.finish(tx, api.TransactionStatusFailed, tx.failSubStatus)
+				} else if next.status.IsTerminal() {
+					s.finish(tx, next.status, next.subStatus)
+				} else {
+					tx.TransactionStatus, tx.TransactionSubStatus = next.status, next.subStatus
+					s.emitTransaction("TRANSACTION_STATUS_CHANGED", tx)
+				}
+			}
+		}
+	}
+}
+
+// nonceBlocked reports whether an EVM transaction waits for a lower nonce of its
+// account to be mined. Transactions failing before the chain are not blocked.
+func (s *Simulator) nonceBlocked(tx *simTransaction) bool {
+	if coin := s.coin(tx.CoinKey); coin == nil || coin.BlockchainType != "EVM" {
+		return false
+	}
+	if tx.failSubStatus != "" && tx.failSubStatus != api.TransactionSubStatusFailedOnChain {
+		return false
+	}
+	nonce, err := strconv.ParseInt(tx.Nonce, 10, 64)
+	if err != nil {
+		return false
+	}
+	mined := map[int64]bool{}
+	for _, other := range s.transactions {
+		if other.SourceAccountKey == tx.SourceAccountKey && other.FeeCoinKey == tx.FeeCoinKey && other.BlockHeight > 0 {
+			if n, err := strconv.ParseInt(other.Nonce, 10, 64); err == nil {
+				mined[n] = true
+			}
+		}
+	}
+	for n := int64(0); n < nonce; n++ {
+		if !mined[n] {
+			return true
+		}
+	}
+	return false
+}
+
+// finish moves a transaction to a terminal status and settles the balances.
+func (s *Simulator) finish(tx *simTransaction, status api.TransactionStatus, subStatus api.TransactionSubStatus) {
+	tx.TransactionStatus, tx.TransactionSubStatus = status, subStatus
+	tx.CompletedTime = tx.enteredAt.UnixMilli()
+	if subStatus == api.TransactionSubStatusFailedOnChain {
+		tx.BlockHeight = int64(s.seq)
+	}
+	if status.IsSuccess() {
+		tx.BlockHeight = int64(s.seq)
+		if destination := s.accountByAddress(tx.CoinKey, tx.DestinationAddress); destination != nil {
+			destinationCoin := destination.coins[tx.CoinKey]
+			destinationCoin.balance.Add(destinationCoin.balance, tx.credit)
+		}
+	} else if source, err := s.account(tx.SourceAccountKey); err == nil {
+		for coinKey, debit := range tx.debits {
+			source.coins[coinKey].balance.Add(source.coins[coinKey].balance, debit)
+		}
+	}
+	s.emitTransaction("TRANSACTION_STATUS_CHANGED", tx)
+}
+
+func (s *Simulator) registerTransactionHandlers() {
+	s.Handle("/v2/transactions/create", s.locked(func(bizContent json.RawMessage) (any, error) {
+		var req api.CreateTransactionsRequest
+		if err := json.Unmarshal(bizContent, &req); err != nil {
+			return nil, err
+		}
+		if req.CustomerRefId != "" && s.transaction("", req.CustomerRefId) != nil {
+			return nil, &safeheron.SafeheronError{Code: CodeDuplicateCustomerRefId, Message: "customerRefId already exists"}
+		}
+		tx, err := s.createTransaction(req, nil)
+		if err != nil {
+			return nil, err
+		}
+		return api.TxKeyResult{TxKey: tx.TxKey}, nil
+	}))
+	s.Handle("/v3/transactions/create", s.locked(func(bizContent json.RawMessage) (any, error) {
+		var req api.CreateTransactionsRequest
+		if err := json.Unmarshal(bizContent, &req); err != nil {
+			return nil, err
+		}
+		if existing := s.transaction("", req.CustomerRefId); req.CustomerRefId != "" && existing != nil {
+			return api.CreateTransactionV3Response{TxKey: existing.TxKey, CustomerRefId: existing.CustomerRefId, IdempotentRequest: true}, nil
+		}
+		tx, err := s.createTransaction(req, nil)
+		if err != nil {
+			return nil, err
+		}
+		return api.CreateTransactionV3Response{TxKey: tx.TxKey, CustomerRefId: tx.CustomerRefId}, nil
+	}))
+	s.Handle("/v1/transactions/utxo/multidest/create", s.locked(func(bizContent json.RawMessage) (any, error) {
+		var req api.CreateTransactionsUTXOMultiDestRequest
+		if err := json.Unmarshal(bizContent, &req); err != nil {
+			return nil, err
+		}
+		if req.CustomerRefId != "" && s.transaction("", req.CustomerRefId) != nil {
+			return nil, &safeheron.SafeheronError{Code: CodeDuplicateCustomerRefId, Message: "customerRefId already exists"}
+		}
+		coin := s.coin(req.CoinKey)
+		if coin == nil || coin.IsUtxo != "1" {
+			return nil, &safeheron.SafeheronError{Code: CodeError, Message: fmt.Sprintf("coin %s does not support multiple destinations", req.CoinKey)}
+		}
+		if len(req.DestinationAddressList) == 0 {
+			return nil, &safeheron.SafeheronError{Code: CodeError, Message: "destinationAddressList is required"}
+		}
+		total := new(big.Rat)
+		for _, destination := range req.DestinationAddressList {
+			amount, ok := new(big.Rat).SetString(destination.Amount)
+			if !ok || amount.Sign() <= 0 || destination.Address == "" {
+				return nil, &safeheron.SafeheronError{Code: CodeError, Message: fmt.Sprintf("invalid destination %s %s", destination.Address, destination.Amount)}
+			}
+			total.Add(total, amount)
+		}
+		tx, err := s.createTransaction(api.CreateTransactionsRequest{
+			CustomerRefId:          req.CustomerRefId,
+			CustomerExt1:           req.CustomerExt1,
+			CustomerExt2:           req.CustomerExt2,
+			Note:                   req.Note,
+			CoinKey:                req.CoinKey,
+			TxAmount:               formatAmount(total, coin.CoinDecimal),
+			SourceAccountKey:       req.SourceAccountKey,
+			SourceAccountType:      req.SourceAccountType,
+			DestinationAccountType: "ONE_TIME_ADDRESS",
+			DestinationTag:         req.DestinationTag,
+		}, req.DestinationAddressList)
+		if err != nil {
+			return nil, err
+		}
+		return api.TxKeyResult{TxKey: tx.TxKey}, nil
+	}))
+	s.Handle("/v1/transactions/utxo/collection", s.locked(func(bizContent json.RawMessage) (any, error) {
+		var req api.CollectionTransactionsUTXORequest
+		if err := json.Unmarshal(bizContent, &req); err != nil {
+			return nil, err
+		}
+		if req.CustomerRefId != "" && s.transaction("", req.CustomerRefId) != nil {
+			return nil, &safeheron.SafeheronError{Code: CodeDuplicateCustomerRefId, Message: "customerRefId already exists"}
+		}
+		coin := s.coin(req.CoinKey)
+		if coin == nil || coin.IsUtxo != "1" {
+			return nil, &safeheron.SafeheronError{Code: CodeError, Message: fmt.Sprintf("coin %s does not support collection", req.CoinKey)}
+		}
+		source, err := s.account(req.SourceAccountKey)
+		if err != nil {
+			return nil, err
+		}
+		// The balance is a single UTXO, collected when it reaches minCollectionAmount
+		sourceCoin, ok := source.coins[req.CoinKey]
+		fee, _ := new(big.Rat).SetString(coin.Fee)
+		if !ok || fee == nil || sourceCoin.balance.Cmp(fee) <= 0 {
+			return nil, &safeheron.SafeheronError{Code: CodeError, Message: "no UTXO to collect"}
+		}
+		if minimum, ok := new(big.Rat).SetString(req.MinCollectionAmount); ok && sourceCoin.balance.Cmp(minimum) < 0 {
+			return nil, &safeheron.SafeheronError{Code: CodeError, Message: "no UTXO to collect"}
+		}
+		amount := formatAmount(sourceCoin.balance, coin.CoinDecimal)
+		tx, err := s.createTransaction(api.CreateTransactionsRequest{
+			CustomerRefId:          req.CustomerRefId,
+			CustomerExt1:           req.CustomerExt1,
+			CustomerExt2:           req.CustomerExt2,
+			Note:                   req.Note,
+			CoinKey:                req.CoinKey,
+			TxAmount:               amount,
+			TreatAsGrossAmount:     true,
+			SourceAccountKey:       req.SourceAccountKey,
+			SourceAccountType:      req.SourceAccountType,
+			DestinationAccountKey:  req.DestinationAccountKey,
+			DestinationAccountType: req.DestinationAccountType,
+			DestinationAddress:     req.DestinationAddress,
+			DestinationTag:         req.DestinationTag,
+		}, nil)
+		if err != nil {
+			return nil, err
+		}
+		return api.CollectionTransactionsUTXOResponse{TxKey: tx.TxKey, CollectionAmount: amount, CollectionNum: 1}, nil
+	}))
+	s.Handle("/v1/transactions/one", s.locked(func(bizContent json.RawMessage) (any, error) {
+		var req api.OneTransactionsRequest
+		if err := json.Unmarshal(bizContent, &req); err != nil {
+			return nil, err
+		}
+		tx := s.transaction(req.TxKey, req.CustomerRefId)
+		if tx == nil {
+			return nil, &safeheron.SafeheronError{Code: CodeError, Message: "transaction does not exist"}
+		}
+		return tx.OneTransactionsResponse, nil
+	}))
+	s.Handle("/v2/transactions/list", s.locked(func(bizContent json.RawMessage) (any, error) {
+		var req api.ListTransactionsV2Request
+		if err := json.Unmarshal(bizContent, &req); err != nil {
+			return nil, err
+		}
+		var matched []api.TransactionsResponse
+		for i := len(s.transactions) - 1; i >= 0; i-- {
+			tx := s.transactions[i]
+			if matchTransaction(tx, req) {
+				matched = append(matched, transactionsResponse(tx))
+			}
+		}
+		return cursorPage(matched, func(tx api.TransactionsResponse) string { return tx.TxKey }, req.Direct, req.FromId, req.Limit), nil
+	}))
+	s.Handle("/v1/transactions/cancel", s.locked(func(bizContent json.RawMessage) (any, error) {
+		var req api.CancelTransactionRequest
+		if err := json.Unmarshal(bizContent, &req); err != nil {
+			return nil, err
+		}
+		tx := s.transaction(req.TxKey, "")
+		if tx == nil {
+			return nil, &safeheron.SafeheronError{Code: CodeError, Message: "transaction does not exist"}
+		}
+		if !tx.TransactionStatus.CanTransitionTo(api.TransactionStatusCancelled) {
+			return nil, &safeheron.SafeheronError{Code: CodeError, Message: fmt.Sprintf("transaction in %s can not be cancelled", tx.TransactionStatus)}
+		}
+		tx.enteredAt = s.now
+		s.finish(tx, api.TransactionStatusCancelled, api.TransactionSubStatusCancelledByApi)
+		return api.ResultResponse{Result: true}, nil
+	}))
+	s.Handle("/v2/transactions/recreate", s.locked(func(bizContent json.RawMessage) (any, error) {
+		var req api.RecreateTransactionRequest
+		if err := json.Unmarshal(bizContent, &req); err != nil {
+			return nil, err
+		}
+		tx := s.transaction(req.TxKey, "")
+		if tx == nil {
+			return nil, &safeheron.SafeheronError{Code: CodeError, Message: "transaction does not exist"}
+		}
+		if tx.TransactionStatus != api.TransactionStatusBroadcasting {
+			return nil, &safeheron.SafeheronError{Code: CodeError, Message: fmt.Sprintf("transaction in %s can not be recreated", tx.TransactionStatus)}
+		}
+		// The replacement takes over the debits, the replaced transaction fails without a refund
+		replacement := &simTransaction{OneTransactionsResponse: tx.OneTransactionsResponse, enteredAt: s.now, debits: tx.debits, credit: tx.credit}
+		tx.debits = nil
+		tx.enteredAt = s.now
+		s.finish(tx, api.TransactionStatusFailed, subStatusReplaced)
+		replacement.TxKey = s.nextKey("tx")
+		replacement.TxHash = ""
+		replacement.CustomerRefId = ""
+		replacement.ReplacedTxKey = tx.TxKey
+		replacement.ReplacedCustomerRefId = tx.CustomerRefId
+		replacement.TransactionStatus = api.TransactionStatusSubmitted
+		replacement.TransactionSubStatus = api.TransactionSubStatusAuditPassed
+		replacement.CreateTime = s.now.UnixMilli()
+		replacement.CompletedTime = 0
+		replacement.SpeedUpHistory = append(append([]api.TransactionsResponse{}, tx.SpeedUpHistory...), transactionsResponse(tx))
+		s.transactions = append(s.transactions, replacement)
+		s.emitTransaction("TRANSACTION_CREATED", replacement)
+		return api.TxKeyResult{TxKey: replacement.TxKey}, nil
+	}))
+	s.Handle("/v2/transactions/getFeeRate", s.locked(func(bizContent json.RawMessage) (any, error) {
+		var req api.TransactionsFeeRateRequest
+		if err := json.Unmarshal(bizContent, &req); err != nil {
+			return nil, err
+		}
+		coin := s.coin(req.CoinKey)
+		if coin == nil {
+			return nil, &safeheron.SafeheronError{Code: CodeError, Message: "coin does not exist"}
+		}
+		return api.TransactionsFeeRateResponse{
+			FeeUnit:       coin.FeeUnit,
+			MinFeeRate:    feeRate(coin, big.NewRat(1, 2), len(req.DestinationAddressList)),
+			LowFeeRate:    feeRate(coin, big.NewRat(3, 4), len(req.DestinationAddressList)),
+			MiddleFeeRate: feeRate(coin, big.NewRat(1, 1), len(req.DestinationAddressList)),
+			HighFeeRate:   feeRate(coin, big.NewRat(3, 2), len(req.DestinationAddressList)),
+		}, nil
+	}))
+}
+
+// feeRate returns the fee rate at which a transaction of the coin costs its Fee times level.
+// EVM coins get EIP-1559 rates in Gwei for 21000 gas, UTXO coins sat/b for a
+// transaction with outputs destinations, 250 bytes for one.
+func feeRate(coin *Coin, level *big.Rat, outputs int) api.FeeRate {
+	fee, ok := new(big.Rat).SetString(coin.Fee)
+	if !ok {
+		fee = new(big.Rat)
+	}
+	fee.Mul(fee, level)
+	rate := api.FeeRate{Fee: formatAmount(fee, coin.FeeDecimal)}
+	switch coin.BlockchainType {
+	case "EVM":
+		maxFee := new(big.Rat).Mul(fee, big.NewRat(1e9, 21000))
+		maxPriorityFee := new(big.Rat).Quo(maxFee, big.NewRat(10, 1))
+		rate.GasLimit = "21000"
+		rate.MaxFee = formatAmount(maxFee, 9)
+		rate.MaxPriorityFee = formatAmount(maxPriorityFee, 9)
+		rate.BaseFee = formatAmount(new(big.Rat).Sub(maxFee, maxPriorityFee), 9)
+	case "UTXO":
+		if outputs < 1 {
+			outputs = 1
+		}
+		rate.BytesSize = fmt.Sprint(utxoSize(outputs))
+		rate.FeeRate = formatAmount(new(big.Rat).Mul(fee, big.NewRat(1e8, utxoSize(1))), 2)
+		rate.Fee = formatAmount(new(big.Rat).Mul(fee, utxoSizeRatio(outputs)), coin.FeeDecimal)
+	default:
+		rate.FeeRate = rate.Fee
+	}
+	return rate
+}
+
+// utxoSize is the size in bytes of a UTXO transaction with one input, a change
+// output and outputs destinations, 250 bytes for one destination.
+func utxoSize(outputs int) int64 {
+	return 216 + 34*int64(outputs)
+}
+
+// utxoSizeRatio is the size of a transaction with outputs destinations over the
+// size of one with a single destination, the Fee of a coin is for the latter.
+func utxoSizeRatio(outputs int) *big.Rat {
+	return big.NewRat(utxoSize(outputs), utxoSize(1))
+}
+
+func matchTransaction(tx *simTransaction, req api.ListTransactionsV2Request) bool {
+	return (req.SourceAccountKey == "" || tx.SourceAccountKey == req.SourceAccountKey) &&
+		(req.SourceAccountType == "" || tx.SourceAccountType == req.SourceAccountType) &&
+		(req.DestinationAccountKey == "" || tx.DestinationAccountKey == req.DestinationAccountKey) &&
+		(req.DestinationAccountType == "" || tx.DestinationAccountType == req.DestinationAccountType) &&
+		(req.AccountKey == "" || tx.SourceAccountKey == req.AccountKey || tx.DestinationAccountKey == req.AccountKey) &&
+		(req.CreateTimeMin == 0 || tx.CreateTime >= req.CreateTimeMin) &&
+		(req.CreateTimeMax == 0 || tx.CreateTime <= req.CreateTimeMax) &&
+		(req.CoinKey == "" || tx.CoinKey == req.CoinKey) &&
+		(req.FeeCoinKey == "" || tx.FeeCoinKey == req.FeeCoinKey) &&
+		(req.TransactionStatus == "" || string(tx.TransactionStatus) == req.TransactionStatus) &&
+		(req.TransactionSubStatus == "" || string(tx.TransactionSubStatus) == req.TransactionSubStatus) &&
+		(req.CompletedTimeMin == 0 || tx.CompletedTime >= req.CompletedTimeMin) &&
+		(req.CompletedTimeMax == 0 || (tx.CompletedTime != 0 && tx.CompletedTime <= req.CompletedTimeMax)) &&
+		(req.CustomerRefId == "" || tx.CustomerRefId == req.CustomerRefId) &&
+		(req.TransactionDirection == "" || tx.TransactionDirection == req.TransactionDirection)
+}
+
+// transactionsResponse converts a transaction to its list representation.
+func transactionsResponse(tx *simTransaction) api.TransactionsResponse {
+	var response api.TransactionsResponse
+	payLoad, _ := json.Marshal(tx.OneTransactionsResponse)
+	json.Unmarshal(payLoad, &response)
+	return response
+}
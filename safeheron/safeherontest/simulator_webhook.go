@@ -0,0 +1,139 @@
+package safeherontest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/api"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/utils"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/webhook"
+)
+
+// WebhookEvent is the decrypted content of a webhook.
+type WebhookEvent struct {
+	EventType   string `json:"eventType"`
+	EventDetail any    `json:"eventDetail"`
+}
+
+// WebhookDelivery records a webhook sent by the Simulator.
+type WebhookDelivery struct {
+	Event WebhookEvent
+	// Timestamp is when the event happened, kept by the webhooks resent with
+	// /v1/webhook/resend/failed.
+	Timestamp time.Time
+	// StatusCode is the HTTP status answered by WebhookURL, 0 when it could not be reached.
+	StatusCode int
+	Err        error
+	// Resent is set on a failed delivery once /v1/webhook/resend/failed sent it again.
+	Resent bool
+}
+
+var webhookHttpClient = &http.Client{Timeout: 10 * time.Second}
+
+// WebHookConfig returns the configuration a webhook.WebhookConverter needs to
+// verify and decrypt the webhooks of the simulator.
+func (s *Simulator) WebHookConfig() webhook.WebHookConfig {
+	return webhook.WebHookConfig{
+		SafeheronWebHookRsaPublicKeySource: utils.NewRsaKey(utils.PemKeySource(s.WebhookPlatformKeys.PublicKeyPem), 0),
+		WebHookRsaDecrypter:                utils.NewRsaKey(utils.PemKeySource(s.WebhookCustomerKeys.PrivateKeyPem), 0),
+	}
+}
+
+// Deliveries returns the webhooks sent so far, including failed ones.
+func (s *Simulator) Deliveries() []WebhookDelivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]WebhookDelivery(nil), s.deliveries...)
+}
+
+func (s *Simulator) emitTransaction(eventType string, tx *simTransaction) {
+	s.pending = append(s.pending, WebhookDelivery{
+		Event:     WebhookEvent{EventType: eventType, EventDetail: transactionsResponse(tx)},
+		Timestamp: s.now,
+	})
+}
+
+func (s *Simulator) registerWebhookHandlers() {
+	s.Handle("/v1/webhook/resend", s.locked(func(bizContent json.RawMessage) (any, error) {
+		var req api.ResendWebhookRequest
+		if err := json.Unmarshal(bizContent, &req); err != nil {
+			return nil, err
+		}
+		if req.Category != "" && req.Category != "TRANSACTION" {
+			return nil, &safeheron.SafeheronError{Code: CodeError, Message: "unsupported category " + req.Category}
+		}
+		tx := s.transaction(req.TxKey, "")
+		if tx == nil {
+			return nil, &safeheron.SafeheronError{Code: CodeError, Message: "transaction does not exist"}
+		}
+		s.emitTransaction("TRANSACTION_STATUS_CHANGED", tx)
+		return api.ResultResponse{Result: true}, nil
+	}))
+	s.Handle("/v1/webhook/resend/failed", s.locked(func(bizContent json.RawMessage) (any, error) {
+		var req api.ResendFailedRequest
+		if err := json.Unmarshal(bizContent, &req); err != nil {
+			return nil, err
+		}
+		var count int32
+		for i := range s.deliveries {
+			delivery := &s.deliveries[i]
+			millis := delivery.Timestamp.UnixMilli()
+			if delivery.StatusCode == http.StatusOK || delivery.Resent ||
+				(req.StartTime != 0 && millis < req.StartTime) || (req.EndTime != 0 && millis > req.EndTime) {
+				continue
+			}
+			delivery.Resent = true
+			s.pending = append(s.pending, WebhookDelivery{Event: delivery.Event, Timestamp: delivery.Timestamp})
+			count++
+		}
+		return api.MessagesCountResponse{MessagesCount: count}, nil
+	}))
+}
+
+// flush sends the pending webhooks in order, it must be called without holding the lock.
+func (s *Simulator) flush() {
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = nil
+	webhookURL := s.WebhookURL
+	s.mu.Unlock()
+
+	for _, delivery := range pending {
+		if webhookURL != "" {
+			delivery.StatusCode, delivery.Err = s.send(webhookURL, delivery)
+		}
+		s.mu.Lock()
+		s.deliveries = append(s.deliveries, delivery)
+		s.mu.Unlock()
+	}
+}
+
+func (s *Simulator) send(webhookURL string, delivery WebhookDelivery) (int, error) {
+	payLoad, err := json.Marshal(delivery.Event)
+	if err != nil {
+		return 0, err
+	}
+	envelope, err := s.sealWebHook(payLoad, delivery.Timestamp)
+	if err != nil {
+		return 0, err
+	}
+	body, _ := json.Marshal(envelope)
+	resp, err := webhookHttpClient.Post(webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, fmt.Errorf("webhook answered with http status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// sealWebHook signs and encrypts a webhook the way Safeheron does.
+func (s *Simulator) sealWebHook(payLoad []byte, timestamp time.Time) (webhook.WebHook, error) {
+	return Sealer{SignerKey: s.WebhookPlatformKeys, RecipientKey: s.WebhookCustomerKeys, Timestamp: timestamp}.WebHook(payLoad)
+}
@@ -0,0 +1,395 @@
+package speedup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/api"
+)
+
+// EventType is the kind of an Event.
+type EventType string
+
+const (
+	// EventSpeedUp reports a transaction recreated with a higher fee, TxKey is the replacement.
+	EventSpeedUp EventType = "SPEED_UP"
+	// EventFeeCeiling reports a stuck transaction that can not be sped up
+	// without going over the caps of the strategy. It is sent once per transaction.
+	EventFeeCeiling EventType = "FEE_CEILING"
+	// EventUnknownFee reports a stuck transaction watched without the fee it was
+	// sent with. It is not sped up, Safeheron does not return the fee rate of a
+	// transaction and a replacement priced without it may pay less than the
+	// original. It is sent once per transaction.
+	EventUnknownFee EventType = "UNKNOWN_FEE"
+	// EventCancelled reports a transaction cancelled with CancelTransactions.
+	EventCancelled EventType = "CANCELLED"
+	// EventDone reports a transaction that reached a terminal status, it is no longer watched.
+	EventDone EventType = "DONE"
+)
+
+// Event is passed to Manager.OnEvent.
+type Event struct {
+	Type  EventType
+	TxKey string
+	// ReplacedTxKey is the transaction replaced by TxKey, for SPEED_UP events.
+	ReplacedTxKey string
+	FeeRateDto    api.FeeRateDto
+	// Transaction is the last state of the transaction polled.
+	Transaction api.OneTransactionsResponse
+}
+
+// Replacement is one link of the lineage of a transaction: TxKey replaced ReplacedTxKey.
+type Replacement struct {
+	TxKey         string
+	ReplacedTxKey string
+	// FeeRateDto is the fee of TxKey, empty when the speed up was not made by the manager.
+	FeeRateDto api.FeeRateDto
+	Time       time.Time
+}
+
+type watchedTransaction struct {
+	// feeRateDto is the fee the transaction was sent with, empty when unknown.
+	feeRateDto api.FeeRateDto
+	status     api.TransactionStatus
+	// since and sinceHeight are the time and block height the transaction was first seen in status.
+	since       time.Time
+	sinceHeight int64
+	// reported is set once a FEE_CEILING or UNKNOWN_FEE event was sent.
+	reported bool
+}
+
+// Manager watches pending transactions and speeds up the ones stuck in
+// BROADCASTING for longer than MaxAge or MaxBlocks with RecreateTransactions,
+// at a fee priced by Strategy and at least BumpPercent above the fee they were
+// sent with. Transactions watched without their fee are not sped up. The
+// replacement is watched in place of the original transaction. Transactions that
+// never got broadcast can be cancelled with CancelTransactions after CancelAfter.
+//
+// The watched transactions and their lineage are only kept in memory. After a
+// restart, Watch the pending transactions again: the lineage of a replacement is
+// rebuilt from its SpeedUpHistory when it is first checked, without the fees of
+// the speed ups made before the restart.
+//
+// Call Check to poll once or Run to poll every Interval.
+type Manager struct {
+	Transactions *api.TransactionApi
+	// CoinApi reads block heights for MaxBlocks.
+	CoinApi *api.CoinApi
+	// MaxAge is how long a transaction may stay BROADCASTING, 0 disables it.
+	MaxAge time.Duration
+	// MaxBlocks is how many blocks a transaction may stay BROADCASTING, 0 disables it.
+	MaxBlocks int64
+	// Strategy prices a speed up, its MaxRates and MaxTxFeeRate are the fee ceiling.
+	Strategy api.FeeStrategy
+	// BumpPercent is the minimum raise over the previous fee, 10 when not set.
+	// Nodes reject replacements that do not pay enough more.
+	BumpPercent api.Amount
+	// CancelAfter is how long a transaction may stay SUBMITTED or SIGNING before it
+	// is cancelled, 0 disables it.
+	CancelAfter time.Duration
+	// Interval is the delay between polls of Run, 30s when not set.
+	Interval time.Duration
+	// OnEvent is called for every speed up, cancellation and finished transaction.
+	OnEvent func(Event)
+	// Now returns the current time, time.Now when not set.
+	Now func() time.Time
+
+	mu      sync.Mutex
+	watched map[string]*watchedTransaction
+	// lineage holds the speed ups by original txKey, origins maps every txKey to its original.
+	lineage map[string][]Replacement
+	origins map[string]string
+}
+
+// Watch adds a transaction to the manager. feeRateDto is the fee it was created
+// with, the transaction is not sped up when it is empty.
+func (m *Manager) Watch(txKey string, feeRateDto api.FeeRateDto) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.init()
+	m.watched[txKey] = &watchedTransaction{feeRateDto: feeRateDto}
+}
+
+// Unwatch removes a transaction from the manager.
+func (m *Manager) Unwatch(txKey string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.watched, txKey)
+}
+
+// Watching returns the txKeys of the watched transactions.
+func (m *Manager) Watching() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	txKeys := make([]string, 0, len(m.watched))
+	for txKey := range m.watched {
+		txKeys = append(txKeys, txKey)
+	}
+	return txKeys
+}
+
+// Lineage returns the speed ups of the transaction txKey belongs to, oldest
+// first. txKey can be the original transaction or any replacement.
+func (m *Manager) Lineage(txKey string) []Replacement {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.init()
+	return append([]Replacement(nil), m.lineage[m.origin(txKey)]...)
+}
+
+// Run calls Check every Interval until ctx is done. Errors of a check are passed
+// to onError, when not nil, and do not stop Run.
+func (m *Manager) Run(ctx context.Context, onError func(error)) error {
+	interval := m.Interval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := m.Check(ctx); err != nil && onError != nil && ctx.Err() == nil {
+			onError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check polls every watched transaction once, speeding up or cancelling the
+// stuck ones. It goes through all transactions and returns the first error.
+func (m *Manager) Check(ctx context.Context) error {
+	var firstErr error
+	for _, txKey := range m.Watching() {
+		if err := m.check(ctx, txKey); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Cancel cancels a watched transaction with CancelTransactions.
+func (m *Manager) Cancel(ctx context.Context, txKey string) error {
+	var result api.ResultResponse
+	if err := m.Transactions.CancelTransactionsCtx(ctx, api.CancelTransactionRequest{TxKey: txKey}, &result); err != nil {
+		return err
+	}
+	if !result.Result {
+		return fmt.Errorf("transaction %s was not cancelled", txKey)
+	}
+	m.Unwatch(txKey)
+	m.emit(Event{Type: EventCancelled, TxKey: txKey})
+	return nil
+}
+
+func (m *Manager) check(ctx context.Context, txKey string) error {
+	var tx api.OneTransactionsResponse
+	if err := m.Transactions.OneTransactionsCtx(ctx, api.OneTransactionsRequest{TxKey: txKey}, &tx); err != nil {
+		return err
+	}
+	now := m.now()
+	m.mu.Lock()
+	watched, ok := m.watched[txKey]
+	if !ok {
+		m.mu.Unlock()
+		return nil
+	}
+	if tx.ReplacedTxKey != "" && m.origins[txKey] == "" {
+		// Sped up outside the manager, or before a restart
+		m.relink(tx)
+	}
+	if tx.TransactionStatus.IsTerminal() {
+		delete(m.watched, txKey)
+		m.mu.Unlock()
+		m.emit(Event{Type: EventDone, TxKey: txKey, Transaction: tx})
+		return nil
+	}
+	statusChanged := watched.status != tx.TransactionStatus
+	if statusChanged {
+		watched.status, watched.since = tx.TransactionStatus, now
+	}
+	since, sinceHeight := watched.since, watched.sinceHeight
+	m.mu.Unlock()
+
+	switch tx.TransactionStatus {
+	case api.TransactionStatusSubmitted, api.TransactionStatusSigning:
+		if m.CancelAfter > 0 && now.Sub(since) >= m.CancelAfter {
+			return m.Cancel(ctx, txKey)
+		}
+	case api.TransactionStatusBroadcasting:
+		if m.MaxBlocks > 0 && m.CoinApi != nil {
+			height, err := m.blockHeight(ctx, tx.CoinKey)
+			if err != nil {
+				return err
+			}
+			if statusChanged {
+				m.mu.Lock()
+				watched.sinceHeight = height
+				m.mu.Unlock()
+			} else if height-sinceHeight >= m.MaxBlocks {
+				return m.speedUp(ctx, tx, watched)
+			}
+		}
+		if m.MaxAge > 0 && now.Sub(since) >= m.MaxAge {
+			return m.speedUp(ctx, tx, watched)
+		}
+	}
+	return nil
+}
+
+// speedUp recreates a stuck transaction with a higher fee.
+func (m *Manager) speedUp(ctx context.Context, tx api.OneTransactionsResponse, watched *watchedTransaction) error {
+	if watched.feeRateDto == (api.FeeRateDto{}) {
+		m.report(EventUnknownFee, tx, watched)
+		return nil
+	}
+	coin := api.Coin{CoinKey: tx.CoinKey, FeeCoinKey: tx.FeeCoinKey}
+	if m.Transactions.Coins != nil {
+		if registered, err := m.Transactions.Coins.CoinCtx(ctx, tx.CoinKey); err == nil {
+			coin = registered
+		}
+	}
+	estimate, err := m.Transactions.EstimateFee(ctx, api.TransactionsFeeRateRequest{
+		CoinKey:            tx.CoinKey,
+		TxHash:             tx.TxHash,
+		SourceAccountKey:   tx.SourceAccountKey,
+		DestinationAddress: tx.DestinationAddress,
+		Value:              tx.TxAmount,
+	}, coin, m.Strategy)
+	if errors.Is(err, api.ErrFeeBelowMinimum) {
+		m.report(EventFeeCeiling, tx, watched)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	bumpPercent := m.BumpPercent
+	if bumpPercent.IsZero() {
+		bumpPercent = api.NewAmount(10, 0)
+	}
+	minimum, err := watched.feeRateDto.Raise(bumpPercent)
+	if err != nil {
+		return err
+	}
+	feeRateDto := estimate.FeeRateDto
+	if compareFeeRates(feeRateDto, minimum) < 0 {
+		feeRateDto = minimum
+	}
+	if m.Strategy.Exceeds(feeRateDto) {
+		m.report(EventFeeCeiling, tx, watched)
+		return nil
+	}
+
+	var result api.TxKeyResult
+	if err := m.Transactions.RecreateTransactionsCtx(ctx, api.RecreateTransactionRequest{
+		TxKey:      tx.TxKey,
+		TxHash:     tx.TxHash,
+		CoinKey:    tx.CoinKey,
+		FeeRateDto: feeRateDto,
+	}, &result); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	delete(m.watched, tx.TxKey)
+	m.watched[result.TxKey] = &watchedTransaction{feeRateDto: feeRateDto}
+	m.link(Replacement{TxKey: result.TxKey, ReplacedTxKey: tx.TxKey, FeeRateDto: feeRateDto, Time: m.now()})
+	m.mu.Unlock()
+	m.emit(Event{Type: EventSpeedUp, TxKey: result.TxKey, ReplacedTxKey: tx.TxKey, FeeRateDto: feeRateDto, Transaction: tx})
+	return nil
+}
+
+// report sends an event about a transaction that is not sped up, once.
+func (m *Manager) report(eventType EventType, tx api.OneTransactionsResponse, watched *watchedTransaction) {
+	m.mu.Lock()
+	reported := watched.reported
+	watched.reported = true
+	m.mu.Unlock()
+	if !reported {
+		m.emit(Event{Type: eventType, TxKey: tx.TxKey, FeeRateDto: watched.feeRateDto, Transaction: tx})
+	}
+}
+
+func (m *Manager) blockHeight(ctx context.Context, coinKey string) (int64, error) {
+	var heights api.CoinBlockHeightResponse
+	if err := m.CoinApi.CoinBlockHeightCtx(ctx, api.CoinBlockHeightRequest{CoinKey: coinKey}, &heights); err != nil {
+		return 0, err
+	}
+	for _, height := range heights {
+		if height.CoinKey == coinKey {
+			return height.LocalBlockHeight, nil
+		}
+	}
+	return 0, fmt.Errorf("no block height for %s", coinKey)
+}
+
+// link records a speed up, the lock must be held.
+func (m *Manager) link(replacement Replacement) {
+	m.init()
+	origin := m.origin(replacement.ReplacedTxKey)
+	m.origins[replacement.TxKey] = origin
+	m.lineage[origin] = append(m.lineage[origin], replacement)
+}
+
+// relink records the speed ups of tx unknown to the manager from its
+// SpeedUpHistory, the lock must be held.
+func (m *Manager) relink(tx api.OneTransactionsResponse) {
+	history := append([]api.TransactionsResponse(nil), tx.SpeedUpHistory...)
+	sort.SliceStable(history, func(i, j int) bool { return history[i].CreateTime < history[j].CreateTime })
+	history = append(history, api.TransactionsResponse{TxKey: tx.TxKey, ReplacedTxKey: tx.ReplacedTxKey, CreateTime: tx.CreateTime})
+	for _, replacement := range history {
+		if replacement.ReplacedTxKey != "" && m.origins[replacement.TxKey] == "" {
+			m.link(Replacement{TxKey: replacement.TxKey, ReplacedTxKey: replacement.ReplacedTxKey, Time: time.UnixMilli(replacement.CreateTime)})
+		}
+	}
+}
+
+// origin returns the original transaction of txKey, the lock must be held.
+func (m *Manager) origin(txKey string) string {
+	if origin, ok := m.origins[txKey]; ok {
+		return origin
+	}
+	return txKey
+}
+
+func (m *Manager) init() {
+	if m.watched == nil {
+		m.watched = map[string]*watchedTransaction{}
+		m.lineage = map[string][]Replacement{}
+		m.origins = map[string]string{}
+	}
+}
+
+func (m *Manager) emit(event Event) {
+	if m.OnEvent != nil {
+		m.OnEvent(event)
+	}
+}
+
+func (m *Manager) now() time.Time {
+	if m.Now != nil {
+		return m.Now()
+	}
+	return time.Now()
+}
+
+// compareFeeRates compares the rates a fee ceiling applies to, unparsable rates are the lowest.
+func compareFeeRates(a api.FeeRateDto, b api.FeeRateDto) int {
+	rateA, errA := api.ParseAmount(a.PrimaryRate())
+	rateB, errB := api.ParseAmount(b.PrimaryRate())
+	switch {
+	case errA != nil && errB != nil:
+		return 0
+	case errA != nil:
+		return -1
+	case errB != nil:
+		return 1
+	}
+	return rateA.Cmp(rateB)
+}
@@ -0,0 +1,106 @@
+package sweep
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/api"
+)
+
+// Sent reports whether the sweep was sent and did not fail.
+func (r Result) Sent() bool {
+	return r.TxKey != "" && r.Err == nil && !(r.TransactionStatus.IsTerminal() && !r.TransactionStatus.IsSuccess())
+}
+
+// Fee returns the fee of the sweep, the estimated fee until its transaction
+// reports one and zero when it was not sent.
+func (r Result) Fee() (api.Amount, error) {
+	if !r.Sent() {
+		return api.Amount{}, nil
+	}
+	if r.TxFee == "" {
+		return r.EstimatedFee, nil
+	}
+	return api.ParseAmount(r.TxFee)
+}
+
+// Collected returns the amount the sweep moves to the treasury, Amount less the
+// fee when the coin pays its own fee.
+func (r Result) Collected() (api.Amount, error) {
+	if !r.Sent() {
+		return api.Amount{}, nil
+	}
+	if r.FeeCoinKey != r.CoinKey {
+		return r.Amount, nil
+	}
+	fee, err := r.Fee()
+	if err != nil {
+		return api.Amount{}, err
+	}
+	return r.Amount.Sub(fee), nil
+}
+
+// Collected sums the amounts moved to the treasury by coin.
+func (r *Report) Collected() (map[string]api.Amount, error) {
+	totals := map[string]api.Amount{}
+	for _, result := range r.Results {
+		if !result.Sent() {
+			continue
+		}
+		collected, err := result.Collected()
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", result.AccountKey, result.CoinKey, err)
+		}
+		totals[result.CoinKey] = totals[result.CoinKey].Add(collected)
+	}
+	return totals, nil
+}
+
+// Fees sums the fees spent by fee coin.
+func (r *Report) Fees() (map[string]api.Amount, error) {
+	totals := map[string]api.Amount{}
+	for _, result := range r.Results {
+		if !result.Sent() {
+			continue
+		}
+		fee, err := result.Fee()
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", result.AccountKey, result.CoinKey, err)
+		}
+		totals[result.FeeCoinKey] = totals[result.FeeCoinKey].Add(fee)
+	}
+	return totals, nil
+}
+
+// Failed returns the sweeps that could not be sent or did not complete.
+func (r *Report) Failed() []Result {
+	var failed []Result
+	for _, result := range r.Results {
+		if result.Err != nil || (result.TransactionStatus.IsTerminal() && !result.TransactionStatus.IsSuccess()) {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// WriteCSV writes the report as CSV with a header row.
+func (r *Report) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"accountKey", "coinKey", "balance", "amount", "collected", "feeCoinKey", "estimatedFee", "fee",
+		"fueled", "txKey", "alreadySent", "transactionStatus", "transactionSubStatus", "skipped", "error"})
+	for _, result := range r.Results {
+		collected, _ := result.Collected()
+		fee, _ := result.Fee()
+		errorMessage := ""
+		if result.Err != nil {
+			errorMessage = result.Err.Error()
+		}
+		writer.Write([]string{result.AccountKey, result.CoinKey, result.Balance.String(), result.Amount.String(), collected.String(),
+			result.FeeCoinKey, result.EstimatedFee.String(), fee.String(), strconv.FormatBool(result.Fueled), result.TxKey, strconv.FormatBool(result.AlreadySent),
+			string(result.TransactionStatus), string(result.TransactionSubStatus), result.Skipped, errorMessage})
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,483 @@
+package sweep
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron"
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/api"
+)
+
+// Rule is the sweeping configuration of a coin, coins without a rule are not swept.
+type Rule struct {
+	CoinKey string
+	// MinAmount is the smallest balance swept, smaller balances stay in the
+	// deposit account until they grow.
+	MinAmount api.Amount
+	// MinCollectionAmount leaves out the UTXOs smaller than it, UTXO coins only.
+	MinCollectionAmount api.Amount
+	// Reserve is left in the account when sweeping a coin that pays its own fee,
+	// the gas of later token sweeps for example.
+	Reserve api.Amount
+	// Strategy sets the fee of the sweeps. UTXO collections only use its Level
+	// and MaxTxFeeRate.
+	Strategy api.FeeStrategy
+}
+
+// Sweeper moves the deposits of a set of accounts to a treasury account.
+//
+// UTXO coins are swept with CollectionTransactionsUTXO. Account model coins are
+// swept with one CreateTransactionsV3 per account and coin. A coin paying its own
+// fee is swept in full with the fee deducted. A token needs the fee coin of its
+// chain in the account: when it is short, the sweep relies on the gas station
+// for AutoFuel accounts and is skipped for the others.
+//
+// Every sweep is sent with the customerRefId "<runId>-<accountKey>-<coinKey>",
+// running the same run again does not sweep an account twice: a sweep sent
+// before is reported AlreadySent, with the amount and status of its transaction.
+// A UTXO collection sent before is recognized with
+// ApiConfig.ErrorCodes.DuplicateCustomerRefId, set it to run a UTXO sweep again.
+// A customerRefId longer than api.MaxCustomerRefIdLength fails the sweep before
+// it is sent. Every sweep of a run is sent before any is waited for.
+type Sweeper struct {
+	Accounts     *api.AccountApi
+	Transactions *api.TransactionApi
+	// Gas reports the gas station balance. Without it token sweeps of accounts
+	// short of the fee coin are skipped, AutoFuel or not.
+	Gas *api.GasApi
+	// Coins has the metadata of the coins, Transactions.Coins when not set.
+	Coins              *api.CoinRegistry
+	TreasuryAccountKey string
+	// AccountFilter selects the deposit accounts, the treasury account is always left out.
+	AccountFilter api.ListAccountRequest
+	Rules         []Rule
+	// Concurrency is the number of accounts swept, then sweeps waited for, at once, 4 when not set.
+	Concurrency int
+	// SkipWait reports the sweeps as soon as they are sent instead of waiting for
+	// the final status and fee of their transaction.
+	SkipWait    bool
+	WaitOptions api.WaitOptions
+}
+
+// Result is the outcome of the sweep of a coin of an account.
+type Result struct {
+	AccountKey string
+	CoinKey    string
+	Balance    api.Amount
+	// Amount is the amount sent. The fee is deducted from it when the coin pays
+	// its own fee, Collected returns what reaches the treasury.
+	Amount     api.Amount
+	FeeCoinKey string
+	// EstimatedFee is the fee estimated before sending, zero for UTXO coins.
+	EstimatedFee api.Amount
+	// Fueled is true when the gas station pays the fee of a token sweep.
+	Fueled bool
+	TxKey  string
+	// AlreadySent is true when the transaction was sent before under the same
+	// customerRefId, by an earlier run with the same runId.
+	AlreadySent          bool
+	TransactionStatus    api.TransactionStatus
+	TransactionSubStatus api.TransactionSubStatus
+	TxFee                string
+	// Skipped is the reason the coin was not swept.
+	Skipped string
+	Err     error
+}
+
+// Report is the outcome of a sweeping run.
+type Report struct {
+	RunId   string
+	Results []Result
+}
+
+// Run sweeps the accounts selected by AccountFilter once. Failures of a single
+// account or coin are reported in its Result, the error is only set when the
+// run could not be planned or ctx is done.
+func (s *Sweeper) Run(ctx context.Context, runId string) (*Report, error) {
+	coins := s.Coins
+	if coins == nil {
+		coins = s.Transactions.Coins
+	}
+	if coins == nil {
+		return nil, errors.New("sweep: a CoinRegistry is required")
+	}
+	if s.TreasuryAccountKey == "" {
+		return nil, errors.New("sweep: TreasuryAccountKey is required")
+	}
+	run := &sweepRun{Sweeper: s, runId: runId, coins: coins, rules: map[string]Rule{}, treasury: map[string]string{}, gas: map[string]api.Amount{}, gasEnabled: map[string]bool{}}
+	for _, rule := range s.Rules {
+		run.rules[rule.CoinKey] = rule
+	}
+
+	var treasuryCoins api.AccountCoinResponse
+	if err := s.Accounts.ListAccountCoinCtx(ctx, api.ListAccountCoinRequest{AccountKey: s.TreasuryAccountKey}, &treasuryCoins); err != nil {
+		return nil, fmt.Errorf("sweep: treasury account: %w", err)
+	}
+	for _, coin := range treasuryCoins {
+		if len(coin.AddressList) > 0 {
+			run.treasury[coin.CoinKey] = coin.AddressList[0].Address
+		}
+	}
+	if s.Gas != nil {
+		var status api.GasStatusResponse
+		if err := s.Gas.GasStatusCtx(ctx, &status); err != nil {
+			return nil, fmt.Errorf("sweep: gas status: %w", err)
+		}
+		for _, balance := range status.GasBalance {
+			amount, err := api.ParseAmount(balance.Amount)
+			if err != nil {
+				return nil, fmt.Errorf("sweep: gas balance of %s: %w", balance.Symbol, err)
+			}
+			run.gas[balance.Symbol] = amount
+		}
+		for _, configuration := range status.Configuration {
+			run.gasEnabled[configuration.Network] = configuration.Enabled
+		}
+	}
+	accounts, err := s.Accounts.IterateAccounts(ctx, s.AccountFilter).Collect()
+	if err != nil {
+		return nil, fmt.Errorf("sweep: list accounts: %w", err)
+	}
+
+	concurrency := s.Concurrency
+	if concurrency <= 0 {
+		concurrency = 4
+	}
+	results := make([][]Result, len(accounts))
+	var wg sync.WaitGroup
+	indexes := make(chan int)
+	for worker := 0; worker < concurrency; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = run.account(ctx, accounts[i])
+			}
+		}()
+	}
+send:
+	for i, account := range accounts {
+		if account.AccountKey == s.TreasuryAccountKey {
+			continue
+		}
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	report := &Report{RunId: runId}
+	for _, accountResults := range results {
+		report.Results = append(report.Results, accountResults...)
+	}
+	if !s.SkipWait && ctx.Err() == nil {
+		// Every sweep is sent before any is waited for
+		run.waitAll(ctx, concurrency, report.Results)
+	}
+	return report, ctx.Err()
+}
+
+// Schedule runs a sweep right away and then every interval until ctx is done.
+// onReport receives the outcome of every run. Every run has the id
+// "sweep-<UTC start of its slot>", the slots being the multiples of interval:
+// a process restarted within a slot runs it again under the same id and does
+// not sweep the accounts swept before the restart twice.
+func (s *Sweeper) Schedule(ctx context.Context, interval time.Duration, onReport func(*Report, error)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		report, err := s.Run(ctx, "sweep-"+time.Now().UTC().Truncate(interval).Format("20060102150405"))
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		onReport(report, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh polls the status and fee of every sent sweep not in a terminal status,
+// for reports of runs with SkipWait.
+func (s *Sweeper) Refresh(ctx context.Context, report *Report) error {
+	for i := range report.Results {
+		result := &report.Results[i]
+		if result.TxKey == "" || result.TransactionStatus.IsTerminal() {
+			continue
+		}
+		var tx api.OneTransactionsResponse
+		if err := s.Transactions.OneTransactionsCtx(ctx, api.OneTransactionsRequest{TxKey: result.TxKey}, &tx); err != nil {
+			return err
+		}
+		result.update(tx)
+	}
+	return nil
+}
+
+// sweepRun is the state of one Run.
+type sweepRun struct {
+	*Sweeper
+	runId string
+	coins *api.CoinRegistry
+	rules map[string]Rule
+	// treasury is the address of the treasury account by coin key.
+	treasury map[string]string
+
+	gasMu sync.Mutex
+	// gas is the gas station balance by symbol, less the fuel of the sweeps sent.
+	gas map[string]api.Amount
+	// gasEnabled is the gas station configuration by network.
+	gasEnabled map[string]bool
+}
+
+// account sweeps the coins of an account. Tokens are swept first, the coins that
+// pay their own fee are then swept with what the token fees left.
+func (r *sweepRun) account(ctx context.Context, account api.AccountResponse) []Result {
+	var accountCoins api.AccountCoinResponse
+	if err := r.Accounts.ListAccountCoinCtx(ctx, api.ListAccountCoinRequest{AccountKey: account.AccountKey}, &accountCoins); err != nil {
+		return []Result{{AccountKey: account.AccountKey, Err: err}}
+	}
+	available := map[string]api.Amount{}
+	var tokens, natives []api.AccountCoin
+	for _, accountCoin := range accountCoins {
+		balance, err := accountCoin.BalanceValue()
+		if err != nil {
+			return []Result{{AccountKey: account.AccountKey, CoinKey: accountCoin.CoinKey, Err: err}}
+		}
+		available[accountCoin.CoinKey] = balance
+		if _, ok := r.rules[accountCoin.CoinKey]; !ok || balance.Sign() <= 0 {
+			continue
+		}
+		if accountCoin.FeeCoinKey != "" && accountCoin.FeeCoinKey != accountCoin.CoinKey {
+			tokens = append(tokens, accountCoin)
+		} else {
+			natives = append(natives, accountCoin)
+		}
+	}
+
+	var results []Result
+	for _, accountCoin := range append(tokens, natives...) {
+		if ctx.Err() != nil {
+			break
+		}
+		result := Result{AccountKey: account.AccountKey, CoinKey: accountCoin.CoinKey, Balance: available[accountCoin.CoinKey], FeeCoinKey: accountCoin.FeeCoinKey}
+		r.sweep(ctx, account, &result, available)
+		results = append(results, result)
+	}
+	return results
+}
+
+func (r *sweepRun) sweep(ctx context.Context, account api.AccountResponse, result *Result, available map[string]api.Amount) {
+	rule := r.rules[result.CoinKey]
+	coin, err := r.coins.CoinCtx(ctx, result.CoinKey)
+	if err != nil {
+		result.Err = err
+		return
+	}
+	if result.FeeCoinKey == "" {
+		result.FeeCoinKey = coin.FeeCoinKey
+	}
+	if result.Balance.Cmp(rule.MinAmount) < 0 {
+		result.Skipped = fmt.Sprintf("balance is below %s", rule.MinAmount)
+		return
+	}
+	customerRefId := fmt.Sprintf("%s-%s-%s", r.runId, account.AccountKey, result.CoinKey)
+	if len(customerRefId) > api.MaxCustomerRefIdLength {
+		result.Err = fmt.Errorf("customerRefId %s is longer than %d characters", customerRefId, api.MaxCustomerRefIdLength)
+		return
+	}
+	if coin.UtxoBased() {
+		r.collect(ctx, coin, rule, customerRefId, result)
+		return
+	}
+
+	token := result.FeeCoinKey != result.CoinKey
+	result.Amount = result.Balance
+	if !token {
+		result.Amount = result.Balance.Sub(rule.Reserve)
+		if result.Amount.Cmp(rule.MinAmount) < 0 || result.Amount.Sign() <= 0 {
+			result.Skipped = fmt.Sprintf("balance less the reserve is below %s", rule.MinAmount)
+			return
+		}
+	}
+	estimate, err := r.Transactions.EstimateFee(ctx, api.TransactionsFeeRateRequest{
+		CoinKey:            result.CoinKey,
+		SourceAccountKey:   account.AccountKey,
+		DestinationAddress: r.treasury[result.CoinKey],
+		Value:              result.Amount.String(),
+	}, coin, rule.Strategy)
+	if err != nil {
+		result.Err = err
+		return
+	}
+	result.EstimatedFee = estimate.Fee
+	if token {
+		if !r.payFee(ctx, account, coin, result, available) {
+			return
+		}
+	} else if result.Amount.Cmp(estimate.Fee) <= 0 {
+		result.Skipped = fmt.Sprintf("balance does not cover the fee of %s", estimate.Fee)
+		return
+	}
+
+	request := api.CreateTransactionsRequest{
+		CustomerRefId:          customerRefId,
+		CoinKey:                result.CoinKey,
+		TxAmount:               result.Amount.String(),
+		TreatAsGrossAmount:     !token,
+		SourceAccountKey:       account.AccountKey,
+		SourceAccountType:      "VAULT_ACCOUNT",
+		DestinationAccountKey:  r.TreasuryAccountKey,
+		DestinationAccountType: "VAULT_ACCOUNT",
+	}
+	estimate.Apply(&request)
+	var res api.CreateTransactionV3Response
+	if err := r.Transactions.CreateTransactionsV3Ctx(ctx, request, &res); err != nil {
+		result.Err = err
+		return
+	}
+	if res.IdempotentRequest {
+		r.adopt(ctx, api.OneTransactionsRequest{TxKey: res.TxKey}, result)
+		return
+	}
+	result.TxKey, result.TransactionStatus = res.TxKey, api.TransactionStatusSubmitted
+}
+
+// payFee checks that the account can pay the fee of a token sweep and reserves
+// it, from the fee coin of the account or from the gas station.
+func (r *sweepRun) payFee(ctx context.Context, account api.AccountResponse, coin api.Coin, result *Result, available map[string]api.Amount) bool {
+	feeBalance := available[result.FeeCoinKey]
+	if feeBalance.Cmp(result.EstimatedFee) >= 0 {
+		available[result.FeeCoinKey] = feeBalance.Sub(result.EstimatedFee)
+		return true
+	}
+	if !account.AutoFuel {
+		result.Skipped = fmt.Sprintf("%s balance does not cover the fee of %s", result.FeeCoinKey, result.EstimatedFee)
+		return false
+	}
+	feeCoin, err := r.coins.CoinCtx(ctx, result.FeeCoinKey)
+	if err != nil {
+		result.Err = err
+		return false
+	}
+	missing := result.EstimatedFee.Sub(feeBalance)
+	r.gasMu.Lock()
+	defer r.gasMu.Unlock()
+	enabled, configured := r.gasEnabled[coin.BlockChain]
+	gas, ok := r.gas[feeCoin.Symbol]
+	if r.Gas == nil || (configured && !enabled) || !ok || gas.Cmp(missing) < 0 {
+		result.Skipped = fmt.Sprintf("%s balance and gas station do not cover the fee of %s", result.FeeCoinKey, result.EstimatedFee)
+		return false
+	}
+	r.gas[feeCoin.Symbol] = gas.Sub(missing)
+	available[result.FeeCoinKey] = api.Amount{}
+	result.Fueled = true
+	return true
+}
+
+// collect sweeps a UTXO coin. A collection already sent by this run, rejected
+// for its customerRefId, is looked up instead of sent again.
+func (r *sweepRun) collect(ctx context.Context, coin api.Coin, rule Rule, customerRefId string, result *Result) {
+	request := api.CollectionTransactionsUTXORequest{
+		CustomerRefId:          customerRefId,
+		CoinKey:                coin.CoinKey,
+		TxFeeLevel:             string(rule.Strategy.Level),
+		SourceAccountKey:       result.AccountKey,
+		SourceAccountType:      "VAULT_ACCOUNT",
+		DestinationAccountKey:  r.TreasuryAccountKey,
+		DestinationAccountType: "VAULT_ACCOUNT",
+	}
+	if request.TxFeeLevel == "" {
+		request.TxFeeLevel = string(api.FeeLevelMiddle)
+	}
+	if !rule.Strategy.MaxTxFeeRate.IsZero() {
+		request.MaxTxFeeRate = rule.Strategy.MaxTxFeeRate.String()
+	}
+	if !rule.MinCollectionAmount.IsZero() {
+		request.MinCollectionAmount = rule.MinCollectionAmount.String()
+	}
+	var res api.CollectionTransactionsUTXOResponse
+	err := r.Transactions.CollectionTransactionsUTXOCtx(ctx, request, &res)
+	if safeheron.IsDuplicateCustomerRefId(err) {
+		r.adopt(ctx, api.OneTransactionsRequest{CustomerRefId: customerRefId}, result)
+		return
+	}
+	if err != nil {
+		result.Err = err
+		return
+	}
+	if result.Amount, err = api.ParseAmount(res.CollectionAmount); err != nil {
+		result.Err = fmt.Errorf("collection amount: %w", err)
+	}
+	result.TxKey, result.TransactionStatus = res.TxKey, api.TransactionStatusSubmitted
+}
+
+// adopt reports the transaction sent before under the customerRefId of a sweep.
+func (r *sweepRun) adopt(ctx context.Context, request api.OneTransactionsRequest, result *Result) {
+	var existing api.OneTransactionsResponse
+	if err := r.Transactions.OneTransactionsCtx(ctx, request, &existing); err != nil {
+		result.Err = err
+		return
+	}
+	amount, err := api.ParseAmount(existing.TxAmount)
+	if err != nil {
+		result.Err = fmt.Errorf("amount of %s: %w", existing.TxKey, err)
+		return
+	}
+	result.TxKey, result.Amount, result.AlreadySent = existing.TxKey, amount, true
+	result.TransactionStatus, result.TransactionSubStatus, result.TxFee = existing.TransactionStatus, existing.TransactionSubStatus, existing.TxFee
+}
+
+// waitAll waits for the sweeps sent, concurrency at a time.
+func (r *sweepRun) waitAll(ctx context.Context, concurrency int, results []Result) {
+	var wg sync.WaitGroup
+	indexes := make(chan int)
+	for worker := 0; worker < concurrency; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				r.wait(ctx, &results[i])
+			}
+		}()
+	}
+send:
+	for i, result := range results {
+		if result.TxKey == "" {
+			continue
+		}
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(indexes)
+	wg.Wait()
+}
+
+func (r *sweepRun) wait(ctx context.Context, result *Result) {
+	var tx api.OneTransactionsResponse
+	err := r.Transactions.WaitForTransaction(ctx, api.OneTransactionsRequest{TxKey: result.TxKey}, &tx, r.WaitOptions)
+	var failed *api.TransactionFailedError
+	if err != nil && !errors.As(err, &failed) {
+		if ctx.Err() == nil {
+			result.Err = err
+		}
+		return
+	}
+	result.update(tx)
+}
+
+func (r *Result) update(tx api.OneTransactionsResponse) {
+	r.TransactionStatus, r.TransactionSubStatus = tx.TransactionStatus, tx.TransactionSubStatus
+	r.TxFee, r.FeeCoinKey = tx.TxFee, tx.FeeCoinKey
+}
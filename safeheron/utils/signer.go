@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+)
+
+// SignerDecrypter performs the RSA private key operations used by the Safeheron
+// protocols, so the key can live in an HSM, a cloud KMS or a remote signing service.
+// RsaKey is the software implementation.
+type SignerDecrypter interface {
+	// SignPKCS1v15 signs a SHA-256 digest with RSASSA-PKCS1-v1_5.
+	SignPKCS1v15(digest []byte) ([]byte, error)
+	// SignPSS signs a SHA-256 digest with RSASSA-PSS, the salt length equals the hash length.
+	SignPSS(digest []byte) ([]byte, error)
+	// DecryptOAEP decrypts with RSAES-OAEP using SHA-256 and no label.
+	DecryptOAEP(ciphertext []byte) ([]byte, error)
+	// DecryptPKCS1v15 decrypts with RSAES-PKCS1-v1_5.
+	DecryptPKCS1v15(ciphertext []byte) ([]byte, error)
+}
+
+func (k *RsaKey) SignPKCS1v15(digest []byte) ([]byte, error) {
+	privateKey, err := k.PrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	return rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, digest)
+}
+
+func (k *RsaKey) SignPSS(digest []byte) ([]byte, error) {
+	privateKey, err := k.PrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	return rsa.SignPSS(rand.Reader, privateKey, crypto.SHA256, digest, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256})
+}
+
+func (k *RsaKey) DecryptOAEP(ciphertext []byte) ([]byte, error) {
+	privateKey, err := k.PrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	return rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, ciphertext, nil)
+}
+
+func (k *RsaKey) DecryptPKCS1v15(ciphertext []byte) ([]byte, error) {
+	privateKey, err := k.PrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	return rsa.DecryptPKCS1v15(rand.Reader, privateKey, ciphertext)
+}
+
+// SignParams signs data with RSASSA-PKCS1-v1_5 and encodes the signature to base64.
+func SignParams(data string, signer SignerDecrypter) (string, error) {
+	hashed := sha256.Sum256([]byte(data))
+	signature, err := signer.SignPKCS1v15(hashed[:])
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(signature), nil
+}
+
+// SignParamsPSS signs data with RSASSA-PSS and encodes the signature to base64.
+func SignParamsPSS(data string, signer SignerDecrypter) (string, error) {
+	hashed := sha256.Sum256([]byte(data))
+	signature, err := signer.SignPSS(hashed[:])
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(signature), nil
+}
+
+// DecryptKey decrypts a base64 encoded aesKey and aesIv with the padding named by rsaType.
+func DecryptKey(base64Data string, rsaType string, decrypter SignerDecrypter) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(base64Data)
+	if err != nil {
+		return nil, err
+	}
+	if rsaType == ECB_OAEP {
+		return decrypter.DecryptOAEP(data)
+	}
+	return decrypter.DecryptPKCS1v15(data)
+}
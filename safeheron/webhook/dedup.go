@@ -0,0 +1,165 @@
+package webhook
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// DedupStore remembers the events already processed. Handler marks an event
+// once its callback succeeded and acknowledges the redeliveries of a marked
+// event without calling the callback again.
+type DedupStore interface {
+	Seen(ctx context.Context, key string) (bool, error)
+	Mark(ctx context.Context, key string) error
+}
+
+// EventKey is the default identity of an event: its type, txKey, status, sub
+// status and txHash. Retries and resends of a webhook may be sealed again with a
+// new timestamp, so the timestamp is only used for the events without a txKey,
+// together with a hash of their detail. A status reached again after a speed-up
+// comes with the new txHash and is processed again.
+func EventKey(event Event) string {
+	var detail struct {
+		TxKey                string `json:"txKey"`
+		TransactionStatus    string `json:"transactionStatus"`
+		TransactionSubStatus string `json:"transactionSubStatus"`
+		TxHash               string `json:"txHash"`
+	}
+	json.Unmarshal(event.EventDetail, &detail)
+	if detail.TxKey != "" {
+		return event.EventType + "|" + detail.TxKey + "|" + detail.TransactionStatus + "|" + detail.TransactionSubStatus + "|" + detail.TxHash
+	}
+	sum := sha256.Sum256(event.EventDetail)
+	return event.EventType + "|" + strconv.FormatInt(event.Timestamp.UnixMilli(), 10) + "|" + hex.EncodeToString(sum[:])
+}
+
+// LRUDedupStore is an in-memory DedupStore keeping the Size most recent keys.
+type LRUDedupStore struct {
+	Size int
+
+	mu    sync.Mutex
+	order *list.List
+	keys  map[string]*list.Element
+}
+
+// NewLRUDedupStore returns an LRUDedupStore keeping size keys.
+func NewLRUDedupStore(size int) *LRUDedupStore {
+	return &LRUDedupStore{Size: size, order: list.New(), keys: map[string]*list.Element{}}
+}
+
+func (s *LRUDedupStore) Seen(ctx context.Context, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	element, ok := s.keys[key]
+	if ok {
+		s.order.MoveToFront(element)
+	}
+	return ok, nil
+}
+
+func (s *LRUDedupStore) Mark(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if element, ok := s.keys[key]; ok {
+		s.order.MoveToFront(element)
+		return nil
+	}
+	s.keys[key] = s.order.PushFront(key)
+	for s.Size > 0 && s.order.Len() > s.Size {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.keys, oldest.Value.(string))
+	}
+	return nil
+}
+
+// FileDedupStore is a DedupStore appending every key to a file, one JSON string
+// per line, synced to disk before Mark returns. It keeps every key in memory,
+// start a new file from time to time.
+type FileDedupStore struct {
+	mu   sync.Mutex
+	file *os.File
+	keys map[string]bool
+}
+
+// OpenFileDedupStore opens or creates the file at path and loads its keys. A last
+// line cut short by a crash is dropped.
+func OpenFileDedupStore(path string) (*FileDedupStore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	keys := map[string]bool{}
+	size := int64(len(data))
+	lines := bytes.Split(data, []byte("\n"))
+	for i, line := range lines {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var key string
+		if err := json.Unmarshal(line, &key); err != nil {
+			if i == len(lines)-1 {
+				size -= int64(len(line))
+				break
+			}
+			return nil, fmt.Errorf("dedup store %s line %d: %w", path, i+1, err)
+		}
+		keys[key] = true
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if size < int64(len(data)) {
+		// Drop the cut line
+		if err := file.Truncate(size); err != nil {
+			file.Close()
+			return nil, err
+		}
+	} else if size > 0 && data[size-1] != '\n' {
+		if _, err := file.Write([]byte("\n")); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return &FileDedupStore{file: file, keys: keys}, nil
+}
+
+func (s *FileDedupStore) Seen(ctx context.Context, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.keys[key], nil
+}
+
+func (s *FileDedupStore) Mark(ctx context.Context, key string) error {
+	line, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.keys[key] {
+		return nil
+	}
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	s.keys[key] = true
+	return nil
+}
+
+// Close closes the file.
+func (s *FileDedupStore) Close() error {
+	return s.file.Close()
+}
@@ -0,0 +1,25 @@
+package webhook
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Event types sent by Safeheron.
+const (
+	EventTransactionCreated       = "TRANSACTION_CREATED"
+	EventTransactionStatusChanged = "TRANSACTION_STATUS_CHANGED"
+	EventMPCSignCreated           = "MPC_SIGN_CREATED"
+	EventMPCSignStatusChanged     = "MPC_SIGN_STATUS_CHANGED"
+	EventWeb3SignCreated          = "WEB3_SIGN_CREATED"
+	EventWeb3SignStatusChanged    = "WEB3_SIGN_STATUS_CHANGED"
+)
+
+// Event is the decrypted content of a webhook.
+type Event struct {
+	EventType string `json:"eventType"`
+	// EventDetail is the raw detail, for the event types without a typed callback.
+	EventDetail json.RawMessage `json:"eventDetail"`
+	// Timestamp is the time Safeheron sent the webhook, from its envelope.
+	Timestamp time.Time `json:"-"`
+}
@@ -0,0 +1,265 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/api"
+)
+
+// maxWebHookSize bounds the body read from a webhook request.
+const maxWebHookSize = 1 << 20
+
+// DefaultMaxClockSkew is the MaxClockSkew of the handlers returned by NewHandler.
+const DefaultMaxClockSkew = 5 * time.Minute
+
+// DefaultMaxResendAge is the MaxResendAge of the handlers returned by NewHandler.
+const DefaultMaxResendAge = 24 * time.Hour
+
+// ErrStaleWebHook is returned for a webhook whose timestamp is further from the
+// current time than MaxClockSkew, an old payload replayed for example.
+var ErrStaleWebHook = errors.New("webhook timestamp is outside the allowed clock skew")
+
+// Handler is an http.Handler receiving Safeheron webhooks. It verifies and
+// decrypts every webhook, calls the callback registered for its event type and
+// answers with a WebHookResponse: code 200 when the callback succeeded, so that
+// Safeheron stops sending it, and an error code otherwise, so that Safeheron
+// sends it again later.
+//
+// Webhooks older or newer than MaxClockSkew are rejected. With a Dedup store,
+// an event is processed once: its redeliveries are acknowledged without calling
+// the callback, concurrent deliveries of an event wait for each other. A failed
+// webhook resent later may keep its original timestamp, so with a Dedup store
+// webhooks up to MaxResendAge old are accepted too.
+type Handler struct {
+	Converter WebhookConverter
+	// MaxClockSkew is the largest difference allowed between the timestamp of a
+	// webhook and the current time, no check when 0.
+	MaxClockSkew time.Duration
+	// MaxResendAge is the largest age of the webhooks accepted with a Dedup
+	// store, which must remember the events at least as long. No longer than
+	// MaxClockSkew when 0.
+	MaxResendAge time.Duration
+	// Now returns the current time, time.Now when not set.
+	Now func() time.Time
+	// Dedup remembers the events processed, none are skipped when not set.
+	Dedup DedupStore
+	// EventKey identifies an event in Dedup, the EventKey function when not set.
+	EventKey func(event Event) string
+	// Default handles the event types without a callback, they are acknowledged
+	// without being handled when it is not set.
+	Default func(ctx context.Context, event Event) error
+	// OnError is told why a webhook was not acknowledged.
+	OnError func(event Event, err error)
+	// OnAcknowledged is told about every event acknowledged, processed now or,
+	// for a duplicate, before.
+	OnAcknowledged func(event Event)
+
+	mu        sync.RWMutex
+	callbacks map[string]func(ctx context.Context, event Event) error
+	// processing holds the keys of the events being processed, closed when done.
+	processing map[string]chan struct{}
+}
+
+// NewHandler returns a Handler decrypting webhooks with config and rejecting
+// webhooks older or newer than DefaultMaxClockSkew, or older than
+// DefaultMaxResendAge once it has a Dedup store.
+func NewHandler(config WebHookConfig) *Handler {
+	return &Handler{Converter: WebhookConverter{Config: config}, MaxClockSkew: DefaultMaxClockSkew, MaxResendAge: DefaultMaxResendAge}
+}
+
+// Handle registers the callback of an event type, replacing the previous one.
+func (h *Handler) Handle(eventType string, fn func(ctx context.Context, event Event) error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.callbacks == nil {
+		h.callbacks = map[string]func(ctx context.Context, event Event) error{}
+	}
+	h.callbacks[eventType] = fn
+}
+
+// On registers a callback of an event type receiving its detail as a T.
+func On[T any](h *Handler, eventType string, fn func(ctx context.Context, detail T) error) {
+	h.Handle(eventType, func(ctx context.Context, event Event) error {
+		var detail T
+		if err := json.Unmarshal(event.EventDetail, &detail); err != nil {
+			return fmt.Errorf("%s detail: %w", event.EventType, err)
+		}
+		return fn(ctx, detail)
+	})
+}
+
+func (h *Handler) OnTransactionCreated(fn func(ctx context.Context, tx api.TransactionsResponse) error) {
+	On(h, EventTransactionCreated, fn)
+}
+
+func (h *Handler) OnTransactionStatusChanged(fn func(ctx context.Context, tx api.TransactionsResponse) error) {
+	On(h, EventTransactionStatusChanged, fn)
+}
+
+func (h *Handler) OnMPCSignCreated(fn func(ctx context.Context, sign api.MPCSignTransactionsResponse) error) {
+	On(h, EventMPCSignCreated, fn)
+}
+
+func (h *Handler) OnMPCSignStatusChanged(fn func(ctx context.Context, sign api.MPCSignTransactionsResponse) error) {
+	On(h, EventMPCSignStatusChanged, fn)
+}
+
+func (h *Handler) OnWeb3SignCreated(fn func(ctx context.Context, sign api.Web3SignQueryResponse) error) {
+	On(h, EventWeb3SignCreated, fn)
+}
+
+func (h *Handler) OnWeb3SignStatusChanged(fn func(ctx context.Context, sign api.Web3SignQueryResponse) error) {
+	On(h, EventWeb3SignStatusChanged, fn)
+}
+
+// Decode verifies and decrypts a webhook.
+func (h *Handler) Decode(d WebHook) (Event, error) {
+	content, err := h.Converter.Convert(d)
+	if err != nil {
+		return Event{}, err
+	}
+	var event Event
+	if err := json.Unmarshal([]byte(content), &event); err != nil {
+		return Event{}, fmt.Errorf("invalid webhook content: %w", err)
+	}
+	if millis, err := strconv.ParseInt(d.Timestamp, 10, 64); err == nil {
+		event.Timestamp = time.UnixMilli(millis)
+	}
+	return event, nil
+}
+
+// Dispatch calls the callback of the event type of event.
+func (h *Handler) Dispatch(ctx context.Context, event Event) error {
+	h.mu.RLock()
+	fn, ok := h.callbacks[event.EventType]
+	h.mu.RUnlock()
+	if !ok {
+		fn = h.Default
+	}
+	if fn == nil {
+		return nil
+	}
+	return fn(ctx, event)
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var d WebHook
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxWebHookSize)).Decode(&d); err != nil {
+		h.fail(w, http.StatusBadRequest, Event{}, fmt.Errorf("invalid webhook: %w", err))
+		return
+	}
+	event, err := h.Decode(d)
+	if err != nil {
+		h.fail(w, http.StatusBadRequest, Event{}, err)
+		return
+	}
+	if err := h.checkTimestamp(event); err != nil {
+		h.fail(w, http.StatusBadRequest, event, err)
+		return
+	}
+	if err := h.process(r.Context(), event); err != nil {
+		h.fail(w, http.StatusInternalServerError, event, err)
+		return
+	}
+	if h.OnAcknowledged != nil {
+		h.OnAcknowledged(event)
+	}
+	writeResponse(w, http.StatusOK, "SUCCESS")
+}
+
+func (h *Handler) checkTimestamp(event Event) error {
+	if h.MaxClockSkew <= 0 {
+		return nil
+	}
+	now := time.Now()
+	if h.Now != nil {
+		now = h.Now()
+	}
+	maxAge := h.MaxClockSkew
+	if h.Dedup != nil && h.MaxResendAge > maxAge {
+		maxAge = h.MaxResendAge
+	}
+	if skew := now.Sub(event.Timestamp); event.Timestamp.IsZero() || skew > maxAge || skew < -h.MaxClockSkew {
+		return fmt.Errorf("%w, sent at %s", ErrStaleWebHook, event.Timestamp.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// process dispatches an event unless Dedup has it and marks it once done.
+func (h *Handler) process(ctx context.Context, event Event) error {
+	if h.Dedup == nil {
+		return h.Dispatch(ctx, event)
+	}
+	eventKey := EventKey
+	if h.EventKey != nil {
+		eventKey = h.EventKey
+	}
+	key := eventKey(event)
+	unlock, err := h.lock(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if seen, err := h.Dedup.Seen(ctx, key); err != nil || seen {
+		return err
+	}
+	if err := h.Dispatch(ctx, event); err != nil {
+		return err
+	}
+	return h.Dedup.Mark(ctx, key)
+}
+
+// lock waits until no other delivery of the event is being processed.
+func (h *Handler) lock(ctx context.Context, key string) (func(), error) {
+	h.mu.Lock()
+	for {
+		done, busy := h.processing[key]
+		if !busy {
+			break
+		}
+		h.mu.Unlock()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		h.mu.Lock()
+	}
+	if h.processing == nil {
+		h.processing = map[string]chan struct{}{}
+	}
+	done := make(chan struct{})
+	h.processing[key] = done
+	h.mu.Unlock()
+	return func() {
+		h.mu.Lock()
+		delete(h.processing, key)
+		close(done)
+		h.mu.Unlock()
+	}, nil
+}
+
+func (h *Handler) fail(w http.ResponseWriter, status int, event Event, err error) {
+	if h.OnError != nil {
+		h.OnError(event, err)
+	}
+	writeResponse(w, status, err.Error())
+}
+
+func writeResponse(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(WebHookResponse{Code: strconv.Itoa(status), Message: message})
+}
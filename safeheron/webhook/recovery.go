@@ -0,0 +1,304 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Safeheron/safeheron-api-sdk-go/safeheron/api"
+)
+
+// Recovery finds the transaction webhooks missed while the webhook endpoint was
+// down and has Safeheron send them again. It is told about every event processed
+// with Observe, typically from Handler.OnAcknowledged, and tracks the checkpoint:
+// the time until which every webhook was received.
+//
+// Check lists the transactions created since the checkpoint with
+// ListTransactionsV2 and compares their status with the last one received. The
+// missing webhooks are resent with ResendWebhook, one transaction at a time, or
+// with ResendFailed for the whole window when too many are missing. Resent
+// webhooks may have been received already, use a Handler with a Dedup store.
+type Recovery struct {
+	Webhooks     *api.WebhookApi
+	Transactions *api.TransactionApi
+	// CheckpointPath persists the checkpoint and the last status received of the
+	// transactions still checked across restarts, they are saved by every Check.
+	// The statuses received after the last Check are lost by a restart and their
+	// webhooks resent. Both are only kept in memory when it is empty.
+	CheckpointPath string
+	// Lookback moves the start of every check before the checkpoint, for the
+	// webhooks received out of order.
+	Lookback time.Duration
+	// Grace leaves the transactions created in the last Grace out of a check,
+	// their webhooks may still be on their way. One minute when 0.
+	Grace time.Duration
+	// MaxResends is the number of missing transactions above which the window is
+	// resent with ResendFailed rather than with ResendWebhook, 20 when 0.
+	MaxResends int
+	// Now returns the current time, time.Now when not set.
+	Now func() time.Time
+
+	mu         sync.Mutex
+	loaded     bool
+	checkpoint time.Time
+	lastEvent  time.Time
+	// received holds the last status received of the transactions checked, by txKey.
+	received map[string]receivedTransaction
+}
+
+type receivedTransaction struct {
+	Status     api.TransactionStatus    `json:"status"`
+	SubStatus  api.TransactionSubStatus `json:"subStatus"`
+	CreateTime int64                    `json:"createTime"`
+}
+
+// RecoveryReport is the outcome of a Check.
+type RecoveryReport struct {
+	// Start and End bound the creation time of the transactions checked.
+	Start   time.Time
+	End     time.Time
+	Checked int
+	// Missing lists the transactions whose last status was not received.
+	Missing []string
+	// ResendFailed is set when the window was resent with ResendFailed.
+	ResendFailed bool
+	// MessagesCount is the number of webhooks Safeheron sends again.
+	MessagesCount int32
+}
+
+type recoveryCheckpoint struct {
+	Checkpoint time.Time                      `json:"checkpoint"`
+	Received   map[string]receivedTransaction `json:"received,omitempty"`
+}
+
+// Observe records an event processed. Events received out of order never move
+// a transaction back to an earlier status.
+func (r *Recovery) Observe(event Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if event.Timestamp.After(r.lastEvent) {
+		r.lastEvent = event.Timestamp
+	}
+	if event.EventType != EventTransactionCreated && event.EventType != EventTransactionStatusChanged {
+		return
+	}
+	var tx api.TransactionsResponse
+	if err := json.Unmarshal(event.EventDetail, &tx); err != nil || tx.TxKey == "" {
+		return
+	}
+	r.receive(tx.TxKey, receivedTransaction{Status: tx.TransactionStatus, SubStatus: tx.TransactionSubStatus, CreateTime: tx.CreateTime})
+}
+
+func (r *Recovery) receive(txKey string, tx receivedTransaction) {
+	if r.received == nil {
+		r.received = map[string]receivedTransaction{}
+	}
+	if last, ok := r.received[txKey]; ok && !last.Status.CanTransitionTo(tx.Status) {
+		return
+	}
+	r.received[txKey] = tx
+}
+
+// LastEvent returns the time the last event observed was sent at.
+func (r *Recovery) LastEvent() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lastEvent
+}
+
+// Checkpoint returns the time until which every webhook was received, zero
+// before the first Check.
+func (r *Recovery) Checkpoint() (time.Time, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.load(); err != nil {
+		return time.Time{}, err
+	}
+	return r.checkpoint, nil
+}
+
+// Check looks for the webhooks missed since the checkpoint and has Safeheron send
+// them again. The checkpoint moves to the end of the window when nothing is
+// missing, the next check looks at the same window again otherwise. The first
+// check without a checkpoint only sets it. The report is returned with the error,
+// if any.
+func (r *Recovery) Check(ctx context.Context) (*RecoveryReport, error) {
+	now := time.Now()
+	if r.Now != nil {
+		now = r.Now()
+	}
+	grace := r.Grace
+	if grace <= 0 {
+		grace = time.Minute
+	}
+	r.mu.Lock()
+	if err := r.load(); err != nil {
+		r.mu.Unlock()
+		return &RecoveryReport{}, err
+	}
+	report := &RecoveryReport{Start: r.checkpoint.Add(-r.Lookback), End: now.Add(-grace)}
+	if r.checkpoint.IsZero() {
+		r.checkpoint = report.End
+		err := r.save()
+		r.mu.Unlock()
+		return &RecoveryReport{Start: report.End, End: report.End}, err
+	}
+	// The transactions still in progress before the window are checked one by one
+	var earlier []string
+	for txKey, tx := range r.received {
+		if tx.CreateTime >= report.Start.UnixMilli() {
+			continue
+		}
+		if tx.Status.IsTerminal() {
+			delete(r.received, txKey)
+		} else {
+			earlier = append(earlier, txKey)
+		}
+	}
+	received := make(map[string]receivedTransaction, len(r.received))
+	for txKey, tx := range r.received {
+		received[txKey] = tx
+	}
+	r.mu.Unlock()
+
+	check := func(txKey string, status api.TransactionStatus, subStatus api.TransactionSubStatus) {
+		report.Checked++
+		if tx, ok := received[txKey]; !ok || tx.Status != status || tx.SubStatus != subStatus {
+			report.Missing = append(report.Missing, txKey)
+		}
+	}
+	for _, txKey := range earlier {
+		var tx api.OneTransactionsResponse
+		if err := r.Transactions.OneTransactionsCtx(ctx, api.OneTransactionsRequest{TxKey: txKey}, &tx); err != nil {
+			return report, err
+		}
+		check(txKey, tx.TransactionStatus, tx.TransactionSubStatus)
+	}
+	if report.End.After(report.Start) {
+		pager := r.Transactions.IterateTransactionsV2(ctx, api.ListTransactionsV2Request{Limit: 100,
+			CreateTimeMin: report.Start.UnixMilli(), CreateTimeMax: report.End.UnixMilli()})
+		for pager.Next() {
+			tx := pager.Item()
+			check(tx.TxKey, tx.TransactionStatus, tx.TransactionSubStatus)
+		}
+		pager.Close()
+		if err := pager.Err(); err != nil {
+			return report, err
+		}
+	}
+
+	var err error
+	if len(report.Missing) > 0 {
+		err = r.resend(ctx, report)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(report.Missing) == 0 && report.End.After(r.checkpoint) {
+		r.checkpoint = report.End
+	}
+	if saveErr := r.save(); err == nil {
+		err = saveErr
+	}
+	return report, err
+}
+
+func (r *Recovery) resend(ctx context.Context, report *RecoveryReport) error {
+	maxResends := r.MaxResends
+	if maxResends <= 0 {
+		maxResends = 20
+	}
+	if len(report.Missing) > maxResends {
+		report.ResendFailed = true
+		var res api.MessagesCountResponse
+		err := r.Webhooks.ResendFailedCtx(ctx, api.ResendFailedRequest{StartTime: report.Start.UnixMilli(), EndTime: report.End.UnixMilli()}, &res)
+		report.MessagesCount = res.MessagesCount
+		return err
+	}
+	for _, txKey := range report.Missing {
+		var res api.ResultResponse
+		if err := r.Webhooks.ResendWebhookCtx(ctx, api.ResendWebhookRequest{Category: "TRANSACTION", TxKey: txKey}, &res); err != nil {
+			return err
+		}
+		if res.Result {
+			report.MessagesCount++
+		}
+	}
+	return nil
+}
+
+// Schedule runs Check every interval until ctx is done and passes every report
+// to onReport.
+func (r *Recovery) Schedule(ctx context.Context, interval time.Duration, onReport func(*RecoveryReport, error)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		report, err := r.Check(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		onReport(report, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Recovery) load() error {
+	if r.loaded || r.CheckpointPath == "" {
+		return nil
+	}
+	data, err := os.ReadFile(r.CheckpointPath)
+	if errors.Is(err, os.ErrNotExist) {
+		r.loaded = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var checkpoint recoveryCheckpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return err
+	}
+	r.checkpoint, r.loaded = checkpoint.Checkpoint, true
+	// The events observed before the load are newer than the saved ones
+	for txKey, tx := range checkpoint.Received {
+		if _, ok := r.received[txKey]; !ok {
+			r.receive(txKey, tx)
+		}
+	}
+	return nil
+}
+
+func (r *Recovery) save() error {
+	if r.CheckpointPath == "" {
+		return nil
+	}
+	data, err := json.Marshal(recoveryCheckpoint{Checkpoint: r.checkpoint, Received: r.received})
+	if err != nil {
+		return err
+	}
+	// Written to a temporary file first, a crash never leaves a cut checkpoint
+	tmp, err := os.CreateTemp(filepath.Dir(r.CheckpointPath), filepath.Base(r.CheckpointPath)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), r.CheckpointPath)
+}
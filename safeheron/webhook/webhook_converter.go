@@ -16,6 +16,23 @@ type WebhookConverter struct {
 type WebHookConfig struct {
 	SafeheronWebHookRsaPublicKey string `comment:"safeheronWebHookRsaPublicKey"`
 	WebHookRsaPrivateKey         string `comment:"webHookRsaPrivateKey"`
+
+	SafeheronWebHookRsaPublicKeySource *utils.RsaKey         `comment:"safeheronWebHookRsaPublicKey from memory, env or a secret provider, takes precedence over SafeheronWebHookRsaPublicKey"`
+	WebHookRsaDecrypter                utils.SignerDecrypter `comment:"Decrypts webhooks with a key held elsewhere (HSM, KMS), takes precedence over WebHookRsaPrivateKey"`
+}
+
+func (c *WebHookConfig) getSafeheronWebHookRsaPublicKey() *utils.RsaKey {
+	if c.SafeheronWebHookRsaPublicKeySource != nil {
+		return c.SafeheronWebHookRsaPublicKeySource
+	}
+	return utils.FileKey(c.SafeheronWebHookRsaPublicKey)
+}
+
+func (c *WebHookConfig) getWebHookRsaDecrypter() utils.SignerDecrypter {
+	if c.WebHookRsaDecrypter != nil {
+		return c.WebHookRsaDecrypter
+	}
+	return utils.FileKey(c.WebHookRsaPrivateKey)
 }
 
 type WebHook struct {
@@ -39,20 +56,16 @@ func (c *WebhookConverter) Convert(d WebHook) (string, error) {
 		"bizContent": d.BizContent,
 	}
 	// Verify sign
-	verifyRet := utils.VerifySignWithRSA(serializeParams(responseStringMap), d.Sig, c.Config.SafeheronWebHookRsaPublicKey)
+	publicKey, err := c.Config.getSafeheronWebHookRsaPublicKey().PublicKey()
+	if err != nil {
+		return "", err
+	}
+	verifyRet := utils.VerifySignWithRSAKey(serializeParams(responseStringMap), d.Sig, publicKey)
 	if !verifyRet {
 		return "", errors.New("webhook signature verification failed")
 	}
 	// Use your RSA private key to decrypt response's aesKey and aesIv
-	var plaintext []byte
-	var err error
-
-	if d.RsaType == utils.ECB_OAEP {
-		plaintext, err = utils.DecryptWithOAEP(d.Key, c.Config.WebHookRsaPrivateKey)
-	} else {
-		plaintext, err = utils.DecryptWithRSA(d.Key, c.Config.WebHookRsaPrivateKey)
-	}
-
+	plaintext, err := utils.DecryptKey(d.Key, d.RsaType, c.Config.getWebHookRsaDecrypter())
 	if err != nil {
 		return "", errors.New("RSA decryption failed")
 	}